@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+	MethodAPIKey = "api_key"
+
+	// APIKeyPrefix - Makes keys recognizable, e.g. by secret scanners
+	APIKeyPrefix = "oak"
+	// APIKeyTouchInterval - The last use of a key is recorded at most this often
+	APIKeyTouchInterval = time.Minute
+
+	apiKeySecretBytes = 32
+)
+
+var (
+	InvalidAPIKeyErr = errors.New("invalid api key")
+	RevokedAPIKeyErr = errors.New("api key is revoked")
+	ExpiredAPIKeyErr = errors.New("api key is expired")
+	// UnavailableErr - Credentials couldn't be checked, which says nothing about their validity
+	UnavailableErr = errors.New("authentication is unavailable")
+)
+
+// NewAPIKey - Generates the key handed to the client for the API key with the given ID, and the hash to store
+func NewAPIKey(id primitive.ObjectID) (key string, hash string, err error) {
+	secret := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	return APIKeyPrefix + "_" + id.Hex() + "_" + encoded, hashSecret(encoded), nil
+}
+
+// ParseAPIKey - Splits a key into the ID of the API key and its secret
+func ParseAPIKey(key string) (id string, secret string, err error) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != APIKeyPrefix || !primitive.IsValidObjectID(parts[1]) || parts[2] == "" {
+		return "", "", InvalidAPIKeyErr
+	}
+	return parts[1], parts[2], nil
+}
+
+// hashSecret - Secrets are 256 random bits, which can't be brute forced, so a fast hash is as good as a slow one
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyAuthenticator - Authenticates requests carrying an API key in the X-API-Key header
+type APIKeyAuthenticator struct {
+	svc db.APIKeysDataService
+}
+
+func NewAPIKeyAuthenticator(svc db.APIKeysDataService) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		svc: svc,
+	}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*models.Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, nil
+	}
+	id, secret, err := ParseAPIKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := a.svc.GetById(r.Context(), id)
+	if errors.Is(err, db.APIKeyNotFoundErr) {
+		return nil, InvalidAPIKeyErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", UnavailableErr, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(stored.Hash)) != 1 {
+		return nil, fmt.Errorf("%w: key %s", InvalidAPIKeyErr, id)
+	}
+
+	now := time.Now()
+	switch {
+	case stored.RevokedAt != nil:
+		return nil, fmt.Errorf("%w: key %s", RevokedAPIKeyErr, id)
+	case !stored.Active(now):
+		return nil, fmt.Errorf("%w: key %s", ExpiredAPIKeyErr, id)
+	}
+
+	if stored.LastUsedAt == nil || now.Sub(*stored.LastUsedAt) > APIKeyTouchInterval {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+		if err := a.svc.Touch(ctx, id, now); err != nil {
+			log.Ctx(r.Context()).Warn().Err(err).Str("key_id", id).Msg("unable to record api key use")
+		}
+		cancel()
+	}
+	log.Ctx(r.Context()).Debug().Str("key_id", id).Str("owner", stored.Owner).Msg("api key used")
+
+	return &models.Principal{
+		Subject: stored.Owner,
+		Method:  MethodAPIKey,
+		KeyID:   id,
+		Org:     stored.Org,
+		Scopes:  stored.Scopes,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/mocks"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	key, hash, err := NewAPIKey(id)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, APIKeyPrefix+"_"+id.Hex()+"_"))
+	assert.NotContains(t, key, hash)
+
+	parsedId, secret, err := ParseAPIKey(key)
+	assert.NoError(t, err)
+	assert.EqualValues(t, id.Hex(), parsedId)
+	assert.EqualValues(t, hash, hashSecret(secret))
+
+	other, _, _ := NewAPIKey(id)
+	assert.NotEqual(t, key, other)
+}
+
+func TestParseAPIKey_Invalid(t *testing.T) {
+	for _, key := range []string{"", "secret", "oak_123_secret", "xyz_629536b3fac02728de50c042_secret", "oak_629536b3fac02728de50c042_"} {
+		_, _, err := ParseAPIKey(key)
+		assert.ErrorIs(t, err, InvalidAPIKeyErr, key)
+	}
+}
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	id := primitive.NewObjectID()
+	key, hash, _ := NewAPIKey(id)
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	recently := time.Now().Add(-time.Second)
+
+	type apiKeyTestCase struct {
+		Description string
+		Header      string
+		Stored      *models.APIKey
+		StoreErr    error
+		Err         error
+		Touched     bool
+	}
+
+	var testCases = []apiKeyTestCase{
+		{"no key", "", nil, nil, nil, false},
+		{"malformed", "not-a-key", nil, nil, InvalidAPIKeyErr, false},
+		{"unknown", key, nil, db.APIKeyNotFoundErr, InvalidAPIKeyErr, false},
+		{"store down", key, nil, errors.New("db error"), UnavailableErr, false},
+		{"wrong secret", key + "x", &models.APIKey{ID: id, Hash: hash}, nil, InvalidAPIKeyErr, false},
+		{"revoked", key, &models.APIKey{ID: id, Hash: hash, RevokedAt: &past}, nil, RevokedAPIKeyErr, false},
+		{"expired", key, &models.APIKey{ID: id, Hash: hash, ExpiresAt: &past}, nil, ExpiredAPIKeyErr, false},
+		{"valid", key, &models.APIKey{ID: id, Hash: hash, Owner: "billing", Scopes: []string{"orders:read"}, ExpiresAt: &future}, nil, nil, true},
+		{"used recently", key, &models.APIKey{ID: id, Hash: hash, Owner: "billing", LastUsedAt: &recently}, nil, nil, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			touched := false
+			mocks.GetAPIKeyByIdFunc = func(ctx context.Context, keyId string) (*models.APIKey, error) {
+				assert.EqualValues(t, id.Hex(), keyId)
+				return tc.Stored, tc.StoreErr
+			}
+			mocks.TouchAPIKeyFunc = func(ctx context.Context, keyId string, at time.Time) error {
+				touched = true
+				return nil
+			}
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			if tc.Header != "" {
+				req.Header.Set(APIKeyHeader, tc.Header)
+			}
+
+			p, err := NewAPIKeyAuthenticator(&mocks.MockAPIKeysDataService{}).Authenticate(req)
+
+			assert.ErrorIs(t, err, tc.Err)
+			assert.EqualValues(t, tc.Touched, touched)
+			switch {
+			case err == nil && tc.Stored != nil:
+				assert.EqualValues(t, tc.Stored.Owner, p.Subject)
+				assert.EqualValues(t, MethodAPIKey, p.Method)
+				assert.EqualValues(t, id.Hex(), p.KeyID)
+				assert.EqualValues(t, tc.Stored.Scopes, p.Scopes)
+			case err != nil:
+				// Never the secret, only the key id
+				assert.NotContains(t, err.Error(), strings.TrimPrefix(key, APIKeyPrefix+"_"+id.Hex()+"_"))
+				fallthrough
+			default:
+				assert.Nil(t, p)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// PrincipalKey - Key of the principal in the gin context
+const PrincipalKey = models.PrincipalKey
+
+// SetPrincipal - Attaches the authenticated caller to the request, for controllers, repositories and logs
+func SetPrincipal(c *gin.Context, p *models.Principal) {
+	c.Set(PrincipalKey, p)
+	ctx := models.ContextWithPrincipal(c.Request.Context(), p)
+	logger := log.Ctx(ctx).With().Object(PrincipalKey, p).Logger()
+	c.Request = c.Request.WithContext(logger.WithContext(ctx))
+}
+
+// PrincipalFrom - Caller of the request ctx belongs to, nil when the request wasn't authenticated
+func PrincipalFrom(ctx context.Context) *models.Principal {
+	return models.PrincipalFromContext(ctx)
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetPrincipal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+	assert.Nil(t, PrincipalFrom(c))
+
+	p := &models.Principal{Subject: "user-1", Method: MethodJWT}
+	SetPrincipal(c, p)
+
+	assert.Same(t, p, PrincipalFrom(c))
+	assert.Same(t, p, PrincipalFrom(c.Request.Context()))
+	assert.Equal(t, p, c.MustGet(PrincipalKey))
+	assert.Nil(t, PrincipalFrom(context.Background()))
+}
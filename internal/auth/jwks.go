@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// JWKSFetchTimeOut - Max time to download a JWKS
+	JWKSFetchTimeOut = 10 * time.Second
+	// JWKSMinRefresh - Tokens signed by an unknown key trigger a reload of the JWKS at most this often
+	JWKSMinRefresh = time.Minute
+)
+
+var UnknownKeyErr = errors.New("token is signed by an unknown key")
+
+// keySet - Public keys of a JWKS (RFC 7517) by key id, reloaded from their source once they are older than refresh
+type keySet struct {
+	source  string
+	refresh time.Duration
+	client  *http.Client
+
+	mu      sync.RWMutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+	// reloadMu - A single request reloads the set when it's due, the others wait for the result
+	reloadMu sync.Mutex
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// newKeySet - Loads the JWKS at source, an http(s) URL or a file path
+func newKeySet(source string, refresh time.Duration) (*keySet, error) {
+	ks := &keySet{
+		source:  source,
+		refresh: refresh,
+		client:  &http.Client{Timeout: JWKSFetchTimeOut},
+	}
+	if err := ks.load(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// key - Public key with the given id, an empty id being accepted when the set holds a single key
+func (ks *keySet) key(kid string) (crypto.PublicKey, error) {
+	ks.mu.RLock()
+	k, found := ks.lookup(kid)
+	age := time.Since(ks.fetched)
+	ks.mu.RUnlock()
+
+	if (found && age > ks.refresh) || (!found && age > JWKSMinRefresh) {
+		k, found = ks.reload(kid)
+	}
+	if !found {
+		return nil, UnknownKeyErr
+	}
+	return k, nil
+}
+
+func (ks *keySet) reload(kid string) (crypto.PublicKey, bool) {
+	ks.reloadMu.Lock()
+	defer ks.reloadMu.Unlock()
+
+	ks.mu.RLock()
+	k, ok := ks.lookup(kid)
+	age := time.Since(ks.fetched)
+	ks.mu.RUnlock()
+	// Reloaded while waiting
+	if (ok && age <= ks.refresh) || (!ok && age <= JWKSMinRefresh) {
+		return k, ok
+	}
+
+	if err := ks.load(); err != nil {
+		// Keep using the keys we have and don't hit the source on every request, it may be back by the next attempt
+		log.Error().Err(err).Str("jwks", ks.source).Msg("unable to reload JWKS")
+		ks.mu.Lock()
+		ks.fetched = time.Now()
+		ks.mu.Unlock()
+		return k, ok
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.lookup(kid)
+}
+
+func (ks *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, true
+		}
+	}
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+func (ks *keySet) load() error {
+	raw, err := ks.read()
+	if err != nil {
+		return err
+	}
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			log.Warn().Err(err).Str("kid", k.Kid).Msg("skipping JWKS key")
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS has no usable signing key")
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.fetched = time.Now()
+	ks.mu.Unlock()
+	return nil
+}
+
+func (ks *keySet) read() ([]byte, error) {
+	if !isURL(ks.source) {
+		return os.ReadFile(ks.source)
+	}
+	resp, err := ks.client.Get(ks.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS request failed with status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
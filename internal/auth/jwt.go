@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+)
+
+const (
+	MethodJWT = "jwt"
+
+	DefaultClockSkew   = 30 * time.Second
+	DefaultJWKSRefresh = time.Hour
+)
+
+var (
+	NoJWTKeyErr     = errors.New("JWT authentication needs a secret or a JWKS")
+	MissingSubjErr  = errors.New("token has no subject")
+	InvalidTokenErr = errors.New("invalid token")
+)
+
+// Authenticator - Identifies the caller of a request. Returns no principal and no error when the request doesn't carry
+// the kind of credentials it handles, so that the next authenticator can try.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*models.Principal, error)
+}
+
+type JWTConfig struct {
+	// Secret - Shared secret of HS256 tokens
+	Secret string
+	// JWKS - File path or URL of the keys of RS256 and ES256 tokens
+	JWKS        string
+	JWKSRefresh time.Duration
+	Issuer      string
+	Audience    string
+	// ClockSkew - Leeway given when checking exp and nbf
+	ClockSkew time.Duration
+}
+
+// JWTAuthenticator - Authenticates requests bearing a JWT (RFC 6750)
+type JWTAuthenticator struct {
+	secret []byte
+	keys   *keySet
+	parser *jwt.Parser
+}
+
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Scope string   `json:"scope,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+	Org   string   `json:"org,omitempty"`
+}
+
+func NewJWTAuthenticator(cfg JWTConfig) (*JWTAuthenticator, error) {
+	if cfg.Secret == "" && cfg.JWKS == "" {
+		return nil, NoJWTKeyErr
+	}
+	if cfg.ClockSkew == 0 {
+		cfg.ClockSkew = DefaultClockSkew
+	}
+	if cfg.JWKSRefresh == 0 {
+		cfg.JWKSRefresh = DefaultJWKSRefresh
+	}
+
+	a := &JWTAuthenticator{}
+	var methods []string
+	if cfg.Secret != "" {
+		a.secret = []byte(cfg.Secret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.JWKS != "" {
+		keys, err := newKeySet(cfg.JWKS, cfg.JWKSRefresh)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+
+	opts := []jwt.ParserOption{
+		// Only the algorithms we have keys for, which rules out 'none' and algorithm confusion
+		jwt.WithValidMethods(methods),
+		jwt.WithLeeway(cfg.ClockSkew),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	a.parser = jwt.NewParser(opts...)
+	return a, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*models.Principal, error) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return nil, nil
+	}
+	return a.Verify(strings.TrimSpace(token))
+}
+
+// Verify - Checks the signature and the claims of the token, and returns the principal it was issued to
+func (a *JWTAuthenticator) Verify(token string) (*models.Principal, error) {
+	var claims jwtClaims
+	if _, err := a.parser.ParseWithClaims(token, &claims, a.key); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, MissingSubjErr
+	}
+
+	p := &models.Principal{
+		Subject: claims.Subject,
+		Issuer:  claims.Issuer,
+		Method:  MethodJWT,
+		Org:     claims.Org,
+		Scopes:  strings.Fields(claims.Scope),
+		Roles:   claims.Roles,
+	}
+	if claims.ExpiresAt != nil {
+		p.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return p, nil
+}
+
+// key - Key verifying the signature of the token, picked by its algorithm and 'kid' header
+func (a *JWTAuthenticator) key(t *jwt.Token) (interface{}, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+		return a.secret, nil
+	}
+	if a.keys == nil {
+		return nil, InvalidTokenErr
+	}
+	kid, _ := t.Header["kid"].(string)
+	return a.keys.key(kid)
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testSecret   = "test-secret"
+	testIssuer   = "test-issuer"
+	testAudience = "test-audience"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "user-1",
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "orders:read orders:write",
+		"roles": []string{"admin"},
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, claims jwt.MapClaims, key interface{}, kid string) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return signed
+}
+
+// writeJWKS - JWKS file holding the public parts of the given keys, by kid
+func writeJWKS(t *testing.T, keys map[string]interface{}) string {
+	var doc struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, k := range keys {
+		switch pub := k.(type) {
+		case *rsa.PublicKey:
+			doc.Keys = append(doc.Keys, map[string]string{
+				"kid": kid, "kty": "RSA", "use": "sig",
+				"n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			doc.Keys = append(doc.Keys, map[string]string{
+				"kid": kid, "kty": "EC", "crv": "P-256",
+				"x": b64(pub.X.FillBytes(make([]byte, 32))), "y": b64(pub.Y.FillBytes(make([]byte, 32))),
+			})
+		}
+	}
+	raw, _ := json.Marshal(doc)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, raw, 0o600))
+	return path
+}
+
+func TestNewJWTAuthenticator_NoKey(t *testing.T) {
+	_, err := NewJWTAuthenticator(JWTConfig{})
+	assert.ErrorIs(t, err, NoJWTKeyErr)
+
+	_, err = NewJWTAuthenticator(JWTConfig{JWKS: "missing.json"})
+	assert.Error(t, err)
+}
+
+func TestVerify_HS256(t *testing.T) {
+	a, err := NewJWTAuthenticator(JWTConfig{Secret: testSecret, Issuer: testIssuer, Audience: testAudience})
+	assert.NoError(t, err)
+
+	p, err := a.Verify(sign(t, jwt.SigningMethodHS256, validClaims(), []byte(testSecret), ""))
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, "user-1", p.Subject)
+	assert.EqualValues(t, testIssuer, p.Issuer)
+	assert.EqualValues(t, MethodJWT, p.Method)
+	assert.EqualValues(t, []string{"orders:read", "orders:write"}, p.Scopes)
+	assert.EqualValues(t, []string{"admin"}, p.Roles)
+	assert.False(t, p.ExpiresAt.IsZero())
+}
+
+func TestVerify_InvalidClaims(t *testing.T) {
+	type invalidClaimsTestCase struct {
+		Description string
+		Change      func(c jwt.MapClaims)
+		Valid       bool
+	}
+
+	var testCases = []invalidClaimsTestCase{
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, false},
+		{"expired within clock skew", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-10 * time.Second).Unix() }, true},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }, false},
+		{"not yet valid", func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() }, false},
+		{"valid within clock skew", func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(10 * time.Second).Unix() }, true},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "someone-else" }, false},
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "other-api" }, false},
+		{"one of the audiences", func(c jwt.MapClaims) { c["aud"] = []string{"other-api", testAudience} }, true},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }, false},
+	}
+
+	a, _ := NewJWTAuthenticator(JWTConfig{Secret: testSecret, Issuer: testIssuer, Audience: testAudience})
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			claims := validClaims()
+			tc.Change(claims)
+
+			_, err := a.Verify(sign(t, jwt.SigningMethodHS256, claims, []byte(testSecret), ""))
+
+			assert.Equal(t, tc.Valid, err == nil, err)
+		})
+	}
+}
+
+func TestVerify_InvalidSignature(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks := writeJWKS(t, map[string]interface{}{"rsa": &rsaKey.PublicKey})
+	a, _ := NewJWTAuthenticator(JWTConfig{Secret: testSecret, JWKS: jwks})
+	jwksOnly, _ := NewJWTAuthenticator(JWTConfig{JWKS: jwks})
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pubKeyBytes := rsaKey.PublicKey.N.Bytes()
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims())
+	unsigned, _ := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	_, err := a.Verify(sign(t, jwt.SigningMethodHS256, validClaims(), []byte("wrong-secret"), ""))
+	assert.Error(t, err)
+	_, err = a.Verify(unsigned)
+	assert.Error(t, err)
+	_, err = a.Verify(sign(t, jwt.SigningMethodRS256, validClaims(), otherKey, "rsa"))
+	assert.Error(t, err)
+	_, err = a.Verify(sign(t, jwt.SigningMethodRS384, validClaims(), rsaKey, "rsa"))
+	assert.Error(t, err)
+	// Algorithm confusion, the public key used as HMAC secret
+	_, err = jwksOnly.Verify(sign(t, jwt.SigningMethodHS256, validClaims(), pubKeyBytes, "rsa"))
+	assert.Error(t, err)
+	_, err = a.Verify("not.a.token")
+	assert.Error(t, err)
+}
+
+func TestVerify_JWKSFile(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a, err := NewJWTAuthenticator(JWTConfig{
+		JWKS: writeJWKS(t, map[string]interface{}{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey}),
+	})
+	assert.NoError(t, err)
+
+	p, err := a.Verify(sign(t, jwt.SigningMethodRS256, validClaims(), rsaKey, "rsa"))
+	assert.NoError(t, err)
+	assert.EqualValues(t, "user-1", p.Subject)
+
+	_, err = a.Verify(sign(t, jwt.SigningMethodES256, validClaims(), ecKey, "ec"))
+	assert.NoError(t, err)
+
+	_, err = a.Verify(sign(t, jwt.SigningMethodES256, validClaims(), ecKey, "unknown"))
+	assert.ErrorIs(t, err, UnknownKeyErr)
+
+	// Without kid, when more than one key could have signed it
+	_, err = a.Verify(sign(t, jwt.SigningMethodES256, validClaims(), ecKey, ""))
+	assert.Error(t, err)
+}
+
+func TestVerify_JWKSURL(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	raw, _ := os.ReadFile(writeJWKS(t, map[string]interface{}{"ec": &ecKey.PublicKey}))
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write(raw)
+	}))
+	defer srv.Close()
+
+	a, err := NewJWTAuthenticator(JWTConfig{JWKS: srv.URL})
+	assert.NoError(t, err)
+
+	// A single key can sign without kid
+	_, err = a.Verify(sign(t, jwt.SigningMethodES256, validClaims(), ecKey, ""))
+	assert.NoError(t, err)
+
+	// Unknown keys don't reload the JWKS on every request
+	_, err = a.Verify(sign(t, jwt.SigningMethodES256, validClaims(), ecKey, "rotated"))
+	assert.ErrorIs(t, err, UnknownKeyErr)
+	assert.EqualValues(t, 1, requests)
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	a, _ := NewJWTAuthenticator(JWTConfig{Secret: testSecret})
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+
+	p, err := a.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	p, err = a.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+
+	req.Header.Set("Authorization", "bearer "+sign(t, jwt.SigningMethodHS256, validClaims(), []byte(testSecret), ""))
+	p, err = a.Authenticate(req)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "user-1", p.Subject)
+
+	req.Header.Set("Authorization", "Bearer invalid")
+	_, err = a.Authenticate(req)
+	assert.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+)
+
+// DefaultRoles - Roles used when none are configured
+var DefaultRoles = map[string][]string{
+	"reader": {models.PermOrdersRead, models.PermOrdersOrg, models.PermJobsRead},
+	"writer": {models.PermOrdersRead, models.PermOrdersWrite, models.PermOrdersOrg, models.PermJobsRead,
+		models.PermJobsCancel},
+	"admin": {models.PermOrdersRead, models.PermOrdersWrite, models.PermOrdersDelete, models.PermOrdersAll,
+		models.PermJobsRead, models.PermJobsCancel, models.PermDBSeed, models.PermDebugRead, models.PermAPIKeysManage},
+}
+
+// Policy - Permissions granted to each role
+type Policy struct {
+	roles map[string]map[string]bool
+}
+
+func NewPolicy(roles map[string][]string) *Policy {
+	p := &Policy{roles: make(map[string]map[string]bool, len(roles))}
+	for role, permissions := range roles {
+		p.roles[role] = make(map[string]bool, len(permissions))
+		for _, permission := range permissions {
+			p.roles[role][permission] = true
+		}
+	}
+	return p
+}
+
+// Allowed - Whether the principal holds the permission. Scopes, which API keys and tokens of machine clients carry
+// instead of roles, grant the permission of the same name and the permissions of the role of the same name.
+func (p *Policy) Allowed(principal *models.Principal, permission string) bool {
+	if principal == nil {
+		return false
+	}
+	for _, scope := range principal.Scopes {
+		if scope == permission || p.roles[scope][permission] {
+			return true
+		}
+	}
+	for _, role := range principal.Roles {
+		if p.roles[role][permission] {
+			return true
+		}
+	}
+	return false
+}
+
+// Visibility - Orders the principal can see, according to the broadest of its permissions
+func (p *Policy) Visibility(principal *models.Principal) models.Visibility {
+	switch {
+	case p.Allowed(principal, models.PermOrdersAll):
+		return models.VisibilityAll
+	case p.Allowed(principal, models.PermOrdersOrg):
+		return models.VisibilityOrg
+	default:
+		return models.VisibilityOwn
+	}
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyAllowed(t *testing.T) {
+	policy := NewPolicy(DefaultRoles)
+
+	type policyTestCase struct {
+		Description string
+		Principal   *models.Principal
+		Permission  string
+		Allowed     bool
+	}
+
+	var testCases = []policyTestCase{
+		{"anonymous", nil, models.PermOrdersRead, false},
+		{"no role", &models.Principal{Subject: "alice"}, models.PermOrdersRead, false},
+		{"reader reads", &models.Principal{Roles: []string{"reader"}}, models.PermOrdersRead, true},
+		{"reader can't write", &models.Principal{Roles: []string{"reader"}}, models.PermOrdersWrite, false},
+		{"roles add up", &models.Principal{Roles: []string{"reader", "writer"}}, models.PermJobsCancel, true},
+		{"writer can't delete", &models.Principal{Roles: []string{"writer"}}, models.PermOrdersDelete, false},
+		{"admin deletes", &models.Principal{Roles: []string{"admin"}}, models.PermOrdersDelete, true},
+		{"unknown role", &models.Principal{Roles: []string{"root"}}, models.PermOrdersRead, false},
+		{"scope as permission", &models.Principal{Scopes: []string{models.ScopeOrdersWrite}}, models.PermOrdersWrite, true},
+		{"scope as role", &models.Principal{Scopes: []string{models.ScopeAdmin}}, models.PermAPIKeysManage, true},
+		{"scope grants nothing else", &models.Principal{Scopes: []string{models.ScopeOrdersRead}}, models.PermJobsRead, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert.EqualValues(t, tc.Allowed, policy.Allowed(tc.Principal, tc.Permission))
+		})
+	}
+}
+
+func TestPolicy_Configured(t *testing.T) {
+	policy := NewPolicy(map[string][]string{"auditor": {models.PermOrdersRead, models.PermDebugRead}})
+
+	assert.True(t, policy.Allowed(&models.Principal{Roles: []string{"auditor"}}, models.PermDebugRead))
+	assert.False(t, policy.Allowed(&models.Principal{Roles: []string{"admin"}}, models.PermDebugRead))
+}
+
+func TestPolicyVisibility(t *testing.T) {
+	policy := NewPolicy(DefaultRoles)
+
+	assert.EqualValues(t, models.VisibilityOwn, policy.Visibility(&models.Principal{Scopes: []string{models.ScopeOrdersRead}}))
+	assert.EqualValues(t, models.VisibilityOrg, policy.Visibility(&models.Principal{Roles: []string{"writer"}}))
+	assert.EqualValues(t, models.VisibilityAll, policy.Visibility(&models.Principal{Roles: []string{"reader", "admin"}}))
+}
@@ -1,29 +1,501 @@
 package config
 
 import (
-	"github.com/rs/zerolog/log"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/rameshsunkara/go-rest-api-example/internal/ratelimit"
+	"github.com/rameshsunkara/go-rest-api-example/internal/tracing"
+	"github.com/rameshsunkara/go-rest-api-example/pkg/util"
+	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
-var config *viper.Viper
-
-// LoadConfig This is just to demonstrate usage of viper.
-// TODO: Add more profiles and obey all 12-Factor app rules
-func LoadConfig(env string) (*viper.Viper, error) {
-	log.Debug().Str("env", env).Msg("loading config")
-	config = viper.New()
-	config.SetConfigType("yaml")
-	config.SetConfigName(env)
-	config.AddConfigPath("../config/")
-	config.AddConfigPath("../../config/")
-	config.AddConfigPath("config/")
-	err := config.ReadInConfig()
+// EnvPrefix - Prefix of the environment variables overriding the configuration, e.g. ORDERS_SERVER_PORT sets
+// server.port. Lists are comma separated.
+const EnvPrefix = "ORDERS"
+
+var InvalidDSNErr = errors.New("db connection string can't be parsed")
+
+// Config - Every setting of the service. See Load for where they come from.
+type Config struct {
+	Server      Server      `yaml:"server"`
+	Health      Health      `yaml:"health"`
+	DB          DB          `yaml:"db"`
+	Logging     Logging     `yaml:"logging"`
+	Orders      Orders      `yaml:"orders"`
+	Idempotency Idempotency `yaml:"idempotency"`
+	Jobs        Jobs        `yaml:"jobs"`
+	Seed        Seed        `yaml:"seed"`
+	RateLimit   RateLimit   `yaml:"ratelimit"`
+	Admin       Admin       `yaml:"admin"`
+	Tracing     Tracing     `yaml:"tracing"`
+	Auth        Auth        `yaml:"auth"`
+
+	// Env - Environment the configuration is for
+	Env string `yaml:"-"`
+	// File - Where the configuration was loaded from, none when it all comes from the defaults and the environment
+	File string `yaml:"-"`
+}
+
+type Server struct {
+	Port int `yaml:"port"`
+	// TrustedProxies - Proxies whose X-Forwarded-For is believed, gin's default when empty
+	TrustedProxies []string  `yaml:"trustedProxies"`
+	Shutdown       Shutdown  `yaml:"shutdown"`
+	AccessLog      AccessLog `yaml:"accessLog"`
+}
+
+// Addr - Address the API is served on
+func (s Server) Addr() string {
+	return ":" + strconv.Itoa(s.Port)
+}
+
+type Shutdown struct {
+	// Delay - Time for load balancers to notice the service is not ready before it stops taking connections
+	Delay time.Duration `yaml:"delay"`
+	// Timeout - Deadline for requests in flight to finish
+	Timeout time.Duration `yaml:"timeout"`
+	// WorkersTimeout - Deadline for background jobs to stop once requests are drained, those still running are abandoned
+	WorkersTimeout time.Duration `yaml:"workersTimeout"`
+}
+
+type AccessLog struct {
+	// SuccessSampling - Log one in every SuccessSampling successful requests, errors are always logged
+	SuccessSampling uint32   `yaml:"successSampling"`
+	SkipPaths       []string `yaml:"skipPaths"`
+}
+
+type Health struct {
+	// Interval - How often dependencies are checked in the background
+	Interval time.Duration `yaml:"interval"`
+	// Timeout - Time checks get, unless set for the check under Checks
+	Timeout time.Duration          `yaml:"timeout"`
+	Checks  map[string]HealthCheck `yaml:"checks"`
+}
+
+type HealthCheck struct {
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// CheckTimeout - How long the named check may take
+func (h Health) CheckTimeout(name string) time.Duration {
+	if check, ok := h.Checks[name]; ok && check.Timeout > 0 {
+		return check.Timeout
+	}
+	return h.Timeout
+}
+
+// DB - Where MongoDB is and the credentials to connect with. Credentials are better kept out of the connection string,
+// in files such as Docker or Kubernetes secrets, or else in the environment.
+type DB struct {
+	// DSN - Connection string of MongoDB
+	DSN string `yaml:"dsn"`
+	// DSNFile - File holding the connection string, instead of DSN
+	DSNFile string `yaml:"dsnFile"`
+	// Username, Password - Credentials set in the connection string, instead of those it has
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// UsernameFile, PasswordFile - Files holding the credentials, instead of Username and Password
+	UsernameFile string `yaml:"usernameFile"`
+	PasswordFile string `yaml:"passwordFile"`
+	// RefreshInterval - How often the files are read again, the service reconnecting once the credentials they hold
+	// are rotated. Never when 0.
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+// FromFiles - Whether any part of the connection string is read from a file, which may change
+func (d DB) FromFiles() bool {
+	return d.DSNFile != "" || d.UsernameFile != "" || d.PasswordFile != ""
+}
+
+// ResolveDSN - The connection string, read from its file when there is one, with the credentials set in it. Errors
+// never show the connection string.
+func (d DB) ResolveDSN() (string, error) {
+	dsn, username, password := d.DSN, d.Username, d.Password
+	for _, secret := range []struct {
+		file  string
+		value *string
+	}{{d.DSNFile, &dsn}, {d.UsernameFile, &username}, {d.PasswordFile, &password}} {
+		if secret.file == "" {
+			continue
+		}
+		raw, err := os.ReadFile(secret.file)
+		if err != nil {
+			return "", err
+		}
+		*secret.value = strings.TrimSpace(string(raw))
+	}
+	if username == "" && password == "" {
+		return dsn, nil
+	}
+
+	u, err := url.Parse(dsn)
 	if err != nil {
-		log.Error().Err(err).Msg("error occurred while reading config")
+		return "", InvalidDSNErr
+	}
+	if username == "" {
+		username = u.User.Username()
+	}
+	u.User = url.UserPassword(username, password)
+	return u.String(), nil
+}
+
+type Logging struct {
+	// Level - trace, debug, info, warn or error
+	Level string `yaml:"level"`
+	// Format - json for a JSON line per log, console for humans
+	Format string `yaml:"format"`
+}
+
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+)
+
+type Orders struct {
+	// UpsertOnReplace - Whether replacing a non-existing order creates it
+	UpsertOnReplace bool         `yaml:"upsertOnReplace"`
+	Export          OrdersExport `yaml:"export"`
+}
+
+type OrdersExport struct {
+	// FlushInterval - Longest time exported orders are held back before being sent to the client
+	FlushInterval time.Duration `yaml:"flushInterval"`
+}
+
+type Idempotency struct {
+	// TTL - How long responses are kept for replay to requests with an Idempotency-Key
+	TTL time.Duration `yaml:"ttl"`
+}
+
+type Jobs struct {
+	Concurrency int `yaml:"concurrency"`
+	// Retention - How long finished jobs can be looked up
+	Retention time.Duration `yaml:"retention"`
+}
+
+type Seed struct {
+	FixturesDir string `yaml:"fixturesDir"`
+}
+
+type RateLimit struct {
+	Enabled bool `yaml:"enabled"`
+	// Store - Where buckets are kept: memory, for limits held by each replica, or mongo for limits shared by them all
+	Store string `yaml:"store"`
+	// Groups - Limit of each client for each group of routes, groups left out are not limited
+	Groups map[string]RateLimitGroup `yaml:"groups"`
+}
+
+const (
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreMongo  = "mongo"
+)
+
+// RateLimitGroup - Token bucket refilled with Rate requests per second, holding up to Burst
+type RateLimitGroup struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+func (g RateLimitGroup) Limit() ratelimit.Limit {
+	return ratelimit.Limit{Rate: g.Rate, Burst: g.Burst}
+}
+
+type Admin struct {
+	// Enabled - Whether to serve metrics, pprof and runtime stats on a listener of their own, by default only in dev
+	Enabled bool   `yaml:"enabled"`
+	Addr    string `yaml:"addr"`
+	// Auth - Require the debug:read permission, with the same credentials as the API
+	Auth bool `yaml:"auth"`
+}
+
+type Tracing struct {
+	Exporter      string  `yaml:"exporter"`
+	Endpoint      string  `yaml:"endpoint"`
+	Insecure      bool    `yaml:"insecure"`
+	SamplingRatio float64 `yaml:"samplingRatio"`
+}
+
+func (t Tracing) Config() tracing.Config {
+	return tracing.Config{
+		Exporter:      t.Exporter,
+		Endpoint:      t.Endpoint,
+		Insecure:      t.Insecure,
+		SamplingRatio: t.SamplingRatio,
 	}
-	return config, err
 }
 
-func GetConfig() *viper.Viper {
-	return config
+type Auth struct {
+	Enabled bool `yaml:"enabled"`
+	// AllowDisabled - Opts out of requiring authentication outside dev, e.g. behind a gateway authenticating callers
+	AllowDisabled bool     `yaml:"allowDisabled"`
+	PublicPaths   []string `yaml:"publicPaths"`
+	// Roles - Permissions granted to each role, the default roles when empty
+	Roles map[string][]string `yaml:"roles"`
+	JWT   JWT                 `yaml:"jwt"`
+}
+
+type JWT struct {
+	// Secret - HS256 secret
+	Secret string `yaml:"secret"`
+	// JWKS - File or URL of the keys verifying RS256/ES256 tokens
+	JWKS        string        `yaml:"jwks"`
+	JWKSRefresh time.Duration `yaml:"jwksRefresh"`
+	Issuer      string        `yaml:"issuer"`
+	Audience    string        `yaml:"audience"`
+	ClockSkew   time.Duration `yaml:"clockSkew"`
+}
+
+// Default - Configuration of the service in env when nothing is set. There is no DB to connect to, nor rate limiting or
+// tracing, and authentication is only off in dev.
+func Default(env string) *Config {
+	logging := Logging{Level: zerolog.LevelInfoValue, Format: LogFormatJSON}
+	if util.IsDevMode(env) {
+		logging = Logging{Level: zerolog.LevelTraceValue, Format: LogFormatConsole}
+	}
+	return &Config{
+		Server: Server{
+			Port:      8080,
+			Shutdown:  Shutdown{Timeout: 30 * time.Second, WorkersTimeout: 10 * time.Second},
+			AccessLog: AccessLog{SuccessSampling: 1},
+		},
+		Health:      Health{Interval: 10 * time.Second, Timeout: 2 * time.Second},
+		DB:          DB{RefreshInterval: time.Minute},
+		Logging:     logging,
+		Orders:      Orders{UpsertOnReplace: true, Export: OrdersExport{FlushInterval: time.Second}},
+		Idempotency: Idempotency{TTL: 24 * time.Hour},
+		Jobs:        Jobs{Concurrency: 2, Retention: 7 * 24 * time.Hour},
+		Seed:        Seed{FixturesDir: "mockdata"},
+		RateLimit:   RateLimit{Store: RateLimitStoreMemory},
+		Admin:       Admin{Enabled: util.IsDevMode(env), Addr: "localhost:6060"},
+		Tracing:     Tracing{Exporter: tracing.ExporterNone, Endpoint: "localhost:4318", SamplingRatio: 1},
+		Auth: Auth{
+			Enabled: !util.IsDevMode(env),
+			JWT:     JWT{JWKSRefresh: time.Hour, ClockSkew: 30 * time.Second},
+		},
+		Env: env,
+	}
+}
+
+// Load - Configuration of the service in env: the defaults, overridden by those in file, or config/<env>.yaml if there
+// is one when file is empty, overridden by the ORDERS_ environment variables. Returns every problem found with it at
+// once, as a ValidationErr.
+func Load(env string, file string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := setDefaults(v, Default(env)); err != nil {
+		return nil, err
+	}
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	if file != "" {
+		v.SetConfigFile(file)
+	} else {
+		v.SetConfigName(env)
+		v.AddConfigPath("../config/")
+		v.AddConfigPath("../../config/")
+		v.AddConfigPath("config/")
+	}
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if file != "" || !errors.As(err, &notFound) {
+			return nil, err
+		}
+	}
+
+	cfg := &Config{}
+	if err := v.Unmarshal(cfg, func(dc *mapstructure.DecoderConfig) {
+		dc.TagName = "yaml"
+	}); err != nil {
+		return nil, err
+	}
+	cfg.Env, cfg.File = env, v.ConfigFileUsed()
+	return cfg, cfg.Validate()
+}
+
+// setDefaults - Makes every setting of cfg a default of v, so that each of them can be overridden from the environment
+func setDefaults(v *viper.Viper, cfg *Config) error {
+	defaults, err := settings(cfg)
+	if err != nil {
+		return err
+	}
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	return nil
+}
+
+// settings - Every setting of cfg by key, as written in the configuration file
+func settings(cfg *Config) (map[string]interface{}, error) {
+	raw, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]interface{}
+	if err := yaml.Unmarshal(raw, &tree); err != nil {
+		return nil, err
+	}
+	return flatten("", tree), nil
+}
+
+func flatten(prefix string, settings map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	for key, value := range settings {
+		if sub, ok := value.(map[string]interface{}); ok {
+			for k, v := range flatten(prefix+key+".", sub) {
+				flat[k] = v
+			}
+			continue
+		}
+		flat[prefix+key] = value
+	}
+	return flat
+}
+
+// ValidationErr - Every problem found in the configuration
+type ValidationErr struct {
+	Problems []string
+}
+
+func (e *ValidationErr) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate - Checks the settings are usable together, returning a ValidationErr listing what isn't
+func (c *Config) Validate() error {
+	var problems []string
+	invalid := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		invalid("server.port must be between 1 and 65535")
+	}
+	if c.Server.Shutdown.Delay < 0 {
+		invalid("server.shutdown.delay can't be negative")
+	}
+	if c.Server.Shutdown.Timeout <= 0 {
+		invalid("server.shutdown.timeout must be positive")
+	}
+	if c.Server.Shutdown.WorkersTimeout <= 0 {
+		invalid("server.shutdown.workersTimeout must be positive")
+	}
+
+	if c.Health.Interval <= 0 {
+		invalid("health.interval must be positive")
+	}
+	if c.Health.Timeout <= 0 {
+		invalid("health.timeout must be positive")
+	}
+	for _, name := range sortedKeys(c.Health.Checks) {
+		if c.Health.Checks[name].Timeout < 0 {
+			invalid("health.checks.%s.timeout can't be negative", name)
+		}
+	}
+
+	switch {
+	case c.DB.DSN == "" && c.DB.DSNFile == "":
+		invalid("db.dsn or db.dsnFile is required")
+	case c.DB.DSN != "" && c.DB.DSNFile != "":
+		invalid("only one of db.dsn and db.dsnFile can be set")
+	case c.DB.DSN != "" && !strings.HasPrefix(c.DB.DSN, "mongodb://") && !strings.HasPrefix(c.DB.DSN, "mongodb+srv://"):
+		invalid("db.dsn must start with mongodb:// or mongodb+srv://")
+	}
+	if c.DB.Username != "" && c.DB.UsernameFile != "" {
+		invalid("only one of db.username and db.usernameFile can be set")
+	}
+	if c.DB.Password != "" && c.DB.PasswordFile != "" {
+		invalid("only one of db.password and db.passwordFile can be set")
+	}
+	if c.DB.RefreshInterval < 0 {
+		invalid("db.refreshInterval can't be negative")
+	}
+
+	if _, err := zerolog.ParseLevel(c.Logging.Level); err != nil || c.Logging.Level == "" {
+		invalid("logging.level must be one of trace, debug, info, warn or error")
+	}
+	if c.Logging.Format != LogFormatJSON && c.Logging.Format != LogFormatConsole {
+		invalid("logging.format must be json or console")
+	}
+
+	if c.Orders.Export.FlushInterval < 0 {
+		invalid("orders.export.flushInterval can't be negative")
+	}
+	if c.Idempotency.TTL <= 0 {
+		invalid("idempotency.ttl must be positive")
+	}
+	if c.Jobs.Concurrency < 1 {
+		invalid("jobs.concurrency must be at least 1")
+	}
+	if c.Jobs.Retention <= 0 {
+		invalid("jobs.retention must be positive")
+	}
+
+	if c.RateLimit.Store != RateLimitStoreMemory && c.RateLimit.Store != RateLimitStoreMongo {
+		invalid("ratelimit.store must be memory or mongo")
+	}
+	for _, name := range sortedKeys(c.RateLimit.Groups) {
+		if err := c.RateLimit.Groups[name].Limit().Validate(); err != nil {
+			invalid("ratelimit.groups.%s: %v", name, err)
+		}
+	}
+
+	if c.Admin.Enabled && c.Admin.Addr == "" {
+		invalid("admin.addr is required when admin.enabled is set")
+	}
+	if c.Admin.Auth && !c.Auth.Enabled {
+		invalid("admin.auth requires auth.enabled")
+	}
+	if !c.Auth.Enabled && !c.Auth.AllowDisabled && !util.IsDevMode(c.Env) {
+		invalid("auth.enabled is required outside dev, unless auth.allowDisabled is set")
+	}
+
+	if err := c.Tracing.Config().Validate(); err != nil {
+		invalid("tracing: %v", err)
+	}
+
+	if c.Auth.JWT.ClockSkew < 0 {
+		invalid("auth.jwt.clockSkew can't be negative")
+	}
+	if c.Auth.JWT.JWKSRefresh < 0 {
+		invalid("auth.jwt.jwksRefresh can't be negative")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationErr{Problems: problems}
+	}
+	return nil
+}
+
+// Redacted - Copy of the configuration safe to show, its secrets masked
+func (c *Config) Redacted() *Config {
+	r := *c
+	r.DB.DSN = util.RedactURL(c.DB.DSN)
+	if r.DB.Password != "" {
+		r.DB.Password = util.Redacted
+	}
+	if r.Auth.JWT.Secret != "" {
+		r.Auth.JWT.Secret = util.Redacted
+	}
+	return &r
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
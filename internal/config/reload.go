@@ -0,0 +1,237 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// hotReloadable - Settings, or prefixes of them, applied as soon as they are reloaded. Changes to the others are only
+// applied on restart.
+var hotReloadable = []string{"logging.level", "ratelimit.enabled", "ratelimit.groups.", "server.accessLog.",
+	"health.interval", "idempotency.ttl"}
+
+// applyHot - Copy of current with the hot reloadable settings of loaded
+func applyHot(current, loaded *Config) *Config {
+	next := *current
+	next.Logging.Level = loaded.Logging.Level
+	next.RateLimit.Enabled = loaded.RateLimit.Enabled
+	next.RateLimit.Groups = loaded.RateLimit.Groups
+	next.Server.AccessLog = loaded.Server.AccessLog
+	next.Health.Interval = loaded.Health.Interval
+	next.Idempotency.TTL = loaded.Idempotency.TTL
+	return &next
+}
+
+// Live - The configuration in use, swapped at once when reloaded. Whatever reads the hot reloadable settings must read
+// them from here, as they are used, rather than keep them.
+type Live struct {
+	current atomic.Pointer[Config]
+}
+
+func NewLive(cfg *Config) *Live {
+	l := &Live{}
+	l.current.Store(cfg)
+	return l
+}
+
+// Get - The configuration in use, which must not be modified
+func (l *Live) Get() *Config {
+	return l.current.Load()
+}
+
+// Set - Puts cfg in use
+func (l *Live) Set(cfg *Config) {
+	l.current.Store(cfg)
+}
+
+// Reloader - Loads the configuration again when its file changes or on SIGHUP, and puts the hot reloadable settings in
+// use once the whole of it is valid
+type Reloader struct {
+	env  string
+	live *Live
+
+	mu sync.Mutex
+	// loaded - Configuration as last loaded, settings only applied on restart included
+	loaded   *Config
+	onReload []func(*Config)
+}
+
+func NewReloader(env string, live *Live) *Reloader {
+	return &Reloader{env: env, live: live, loaded: live.Get()}
+}
+
+// OnReload - Calls fn with the configuration put in use by every reload
+func (r *Reloader) OnReload(fn func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onReload = append(r.onReload, fn)
+}
+
+// Reload - Loads the configuration from where it was first loaded from and logs what changed since it was last loaded.
+// The hot reloadable settings are put in use, the others only warned about, once. Nothing changes when the
+// configuration is invalid.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.live.Get()
+	loaded, err := Load(r.env, current.File)
+	if err != nil {
+		return err
+	}
+
+	changes, err := diff(r.loaded, loaded)
+	if err != nil {
+		return err
+	}
+	r.loaded = loaded
+	if len(changes) == 0 {
+		log.Info().Msg("configuration reloaded, nothing changed")
+		return nil
+	}
+	for _, c := range changes {
+		if c.Hot {
+			log.Info().Str("setting", c.Key).Interface("from", c.From).Interface("to", c.To).Msg("setting reloaded")
+		} else {
+			log.Warn().Str("setting", c.Key).Interface("from", c.From).Interface("to", c.To).
+				Msg("setting can't be reloaded, restart to apply it")
+		}
+	}
+
+	next := applyHot(current, loaded)
+	r.live.Set(next)
+	for _, fn := range r.onReload {
+		fn(next)
+	}
+	return nil
+}
+
+// Watch - Reloads on SIGHUP, and whenever the configuration file changes, until ctx is done. Returns why the file
+// can't be watched, if so, in which case SIGHUP still reloads it.
+func (r *Reloader) Watch(ctx context.Context) error {
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	file := r.live.Get().File
+	watcher, wErr := watch(ctx, file)
+	if watcher != nil {
+		events, errs = watcher.Events, watcher.Errors
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				log.Info().Msg("SIGHUP received, reloading configuration")
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				if !concerns(e, file) {
+					continue
+				}
+				log.Info().Str("file", file).Str("event", e.Op.String()).Msg("configuration file changed, reloading")
+			case err, ok := <-errs:
+				if ok {
+					log.Warn().Err(err).Str("file", file).Msg("unable to watch configuration file")
+				}
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Error().Err(err).Msg("unable to reload configuration, keeping the current one")
+			}
+		}
+	}()
+	return wErr
+}
+
+// watch - Watches the directory of file until ctx is done, nothing when there is no file
+func watch(ctx context.Context, file string) (*fsnotify.Watcher, error) {
+	if file == "" {
+		return nil, nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// Editors and Kubernetes replace the file rather than write to it, which only its directory sees
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = watcher.Close()
+	}()
+	return watcher, nil
+}
+
+// concerns - Whether e may have changed file: it was written or replaced, or the directory it's in was swapped for
+// another as Kubernetes does with mounted config maps
+func concerns(e fsnotify.Event, file string) bool {
+	if filepath.Clean(e.Name) == filepath.Clean(file) {
+		return e.Op&(fsnotify.Write|fsnotify.Create) != 0
+	}
+	return e.Op&fsnotify.Create != 0 && strings.HasPrefix(filepath.Base(e.Name), "..")
+}
+
+// change - Setting which differs between two configurations, secrets redacted
+type change struct {
+	Key  string
+	From interface{}
+	To   interface{}
+	// Hot - Whether the setting is applied when reloaded
+	Hot bool
+}
+
+// diff - Settings which differ from before to after, sorted
+func diff(before, after *Config) ([]change, error) {
+	b, err := settings(before.Redacted())
+	if err != nil {
+		return nil, err
+	}
+	a, err := settings(after.Redacted())
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []change
+	for key, from := range b {
+		if to, ok := a[key]; !ok || !reflect.DeepEqual(from, to) {
+			changes = append(changes, change{Key: key, From: from, To: a[key], Hot: hot(key)})
+		}
+	}
+	for key, to := range a {
+		if _, ok := b[key]; !ok {
+			changes = append(changes, change{Key: key, To: to, Hot: hot(key)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes, nil
+}
+
+func hot(key string) bool {
+	for _, prefix := range hotReloadable {
+		if key == prefix || (strings.HasSuffix(prefix, ".") && strings.HasPrefix(key, prefix)) {
+			return true
+		}
+	}
+	return false
+}
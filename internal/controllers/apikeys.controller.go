@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/auth"
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	APIKeyIdPath = "id"
+	OwnerQuery   = "owner"
+)
+
+type APIKeysController struct {
+	dataSvc db.APIKeysDataService
+}
+
+func NewAPIKeysController(svc db.APIKeysDataService) *APIKeysController {
+	return &APIKeysController{
+		dataSvc: svc,
+	}
+}
+
+// Create  godoc
+// @Summary      Create an API key
+// @Description  The key is part of the response and can't be retrieved afterwards, only a hash of it is stored.
+// @Description  Owner and org default to the caller.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        key  body      models.APIKeyRequest  true  "API key"
+// @Success      201  {object}  models.IssuedAPIKey
+// @Failure      400  {string}  string  "bad request"
+// @Router       /api/v1/admin/apikeys [post]
+func (kHandler *APIKeysController) Create(c *gin.Context) {
+	var req models.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": err.Error()})
+		c.Abort()
+		return
+	}
+	if req.Owner == "" {
+		if p := auth.PrincipalFrom(c); p != nil {
+			req.Owner, req.Org = p.Subject, p.Org
+		}
+	}
+	if err := validateAPIKeyRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": err.Error()})
+		c.Abort()
+		return
+	}
+
+	key := &models.APIKey{
+		ID:        primitive.NewObjectID(),
+		Name:      req.Name,
+		Owner:     req.Owner,
+		Org:       req.Org,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	secret, hash, err := auth.NewAPIKey(key.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to generate api key", "error": err.Error()})
+		c.Abort()
+		return
+	}
+	key.Hash = hash
+	if err := kHandler.dataSvc.Create(c, key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to store api key", "error": err.Error()})
+		c.Abort()
+		return
+	}
+
+	log.Ctx(c).Info().Str("key_id", key.ID.Hex()).Str("owner", key.Owner).Strs("scopes", key.Scopes).Msg("api key created")
+	c.Header("Location", c.Request.URL.Path+"/"+key.ID.Hex())
+	c.JSON(http.StatusCreated, models.IssuedAPIKey{APIKey: *key, Key: secret})
+}
+
+// GetAll  godoc
+// @Summary      List API keys
+// @Description  Lists the keys, revoked and expired ones included, without their secret
+// @Tags         Admin
+// @Produce      json
+// @Param        owner  query     string  false  "Only the keys of this owner"
+// @Success      200    {array}   models.APIKey
+// @Router       /api/v1/admin/apikeys [get]
+func (kHandler *APIKeysController) GetAll(c *gin.Context) {
+	keys, err := kHandler.dataSvc.GetAll(c, c.Query(OwnerQuery))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to retrieve api keys", "error": err.Error()})
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// GetById  godoc
+// @Summary      Fetch an API key
+// @Param        id   path      string  true  "API key ID"
+// @Tags         Admin
+// @Produce      json
+// @Success      200  {object}  models.APIKey
+// @Failure      404  {string}  string  "not found"
+// @Router       /api/v1/admin/apikeys/{id} [get]
+func (kHandler *APIKeysController) GetById(c *gin.Context) {
+	key, err := kHandler.dataSvc.GetById(c, c.Param(APIKeyIdPath))
+	if err != nil {
+		abortAPIKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+// Rotate  godoc
+// @Summary      Rotate an API key
+// @Description  Issues a new secret for the key, the previous one stops working right away. Revoked keys can't be
+// @Description  rotated.
+// @Param        id   path      string  true  "API key ID"
+// @Tags         Admin
+// @Produce      json
+// @Success      200  {object}  models.IssuedAPIKey
+// @Failure      404  {string}  string  "not found"
+// @Router       /api/v1/admin/apikeys/{id}/rotate [post]
+func (kHandler *APIKeysController) Rotate(c *gin.Context) {
+	id := c.Param(APIKeyIdPath)
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		abortAPIKeyError(c, db.InvalidAPIKeyIdErr)
+		return
+	}
+	secret, hash, err := auth.NewAPIKey(docID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to generate api key", "error": err.Error()})
+		c.Abort()
+		return
+	}
+	key, err := kHandler.dataSvc.Rotate(c, id, hash)
+	if err != nil {
+		abortAPIKeyError(c, err)
+		return
+	}
+
+	log.Ctx(c).Info().Str("key_id", id).Str("owner", key.Owner).Msg("api key rotated")
+	c.JSON(http.StatusOK, models.IssuedAPIKey{APIKey: *key, Key: secret})
+}
+
+// Revoke  godoc
+// @Summary      Revoke an API key
+// @Description  The key stops working for good, it stays listed
+// @Param        id   path      string  true  "API key ID"
+// @Tags         Admin
+// @Produce      json
+// @Success      200  {object}  models.APIKey
+// @Failure      404  {string}  string  "not found"
+// @Router       /api/v1/admin/apikeys/{id} [delete]
+func (kHandler *APIKeysController) Revoke(c *gin.Context) {
+	id := c.Param(APIKeyIdPath)
+	key, err := kHandler.dataSvc.Revoke(c, id)
+	if err != nil {
+		abortAPIKeyError(c, err)
+		return
+	}
+
+	log.Ctx(c).Info().Str("key_id", id).Str("owner", key.Owner).Msg("api key revoked")
+	c.JSON(http.StatusOK, key)
+}
+
+func validateAPIKeyRequest(req *models.APIKeyRequest) error {
+	if req.Owner == "" {
+		return errors.New("owner is required")
+	}
+	if len(req.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, s := range req.Scopes {
+		if !contains(models.APIKeyScopes, s) {
+			return errors.New("unknown scope " + s)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	return nil
+}
+
+func abortAPIKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, db.InvalidAPIKeyIdErr):
+		c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": err.Error()})
+	case errors.Is(err, db.APIKeyNotFoundErr):
+		c.JSON(http.StatusNotFound, gin.H{"message": "api key not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to process api key", "error": err.Error()})
+	}
+	c.Abort()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/auth"
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/mocks"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var kc = NewAPIKeysController(&mocks.MockAPIKeysDataService{})
+
+func apiKeyRequest(handler gin.HandlerFunc, method string, id string, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	path := "/api/v1/admin/apikeys"
+	if id != "" {
+		path += "/" + id
+		c.Params = []gin.Param{{Key: APIKeyIdPath, Value: id}}
+	}
+	c.Request, _ = http.NewRequest(method, path, bytes.NewBufferString(body))
+	auth.SetPrincipal(c, &models.Principal{Subject: "admin", Scopes: []string{models.ScopeAdmin}})
+	handler(c)
+	return w
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	type createAPIKeyTestCase struct {
+		Description string
+		Body        string
+		StoreErr    error
+		Status      int
+		Owner       string
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	var testCases = []createAPIKeyTestCase{
+		{"valid", `{"name":"billing","owner":"billing-svc","scopes":["orders:read"],"expires_at":"` + future + `"}`, nil, http.StatusCreated, "billing-svc"},
+		{"owner defaults to caller", `{"name":"mine","scopes":["orders:read","orders:write"]}`, nil, http.StatusCreated, "admin"},
+		{"no name", `{"scopes":["orders:read"]}`, nil, http.StatusBadRequest, ""},
+		{"no scope", `{"name":"billing","scopes":[]}`, nil, http.StatusBadRequest, ""},
+		{"unknown scope", `{"name":"billing","scopes":["orders:delete"]}`, nil, http.StatusBadRequest, ""},
+		{"expired", `{"name":"billing","scopes":["orders:read"],"expires_at":"` + past + `"}`, nil, http.StatusBadRequest, ""},
+		{"db error", `{"name":"billing","scopes":["orders:read"]}`, errors.New("db error"), http.StatusInternalServerError, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			var stored *models.APIKey
+			mocks.CreateAPIKeyFunc = func(ctx context.Context, key *models.APIKey) error {
+				stored = key
+				return tc.StoreErr
+			}
+
+			w := apiKeyRequest(kc.Create, http.MethodPost, "", tc.Body)
+
+			assert.EqualValues(t, tc.Status, w.Code)
+			if tc.Status != http.StatusCreated {
+				return
+			}
+			var issued struct {
+				ID    string `json:"id"`
+				Owner string `json:"owner"`
+				Key   string `json:"key"`
+				Hash  string `json:"hash"`
+			}
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &issued))
+			assert.EqualValues(t, tc.Owner, issued.Owner)
+			assert.EqualValues(t, "/api/v1/admin/apikeys/"+issued.ID, w.Header().Get("Location"))
+			assert.Empty(t, issued.Hash)
+
+			// Only the hash of the secret is stored
+			id, secret, err := auth.ParseAPIKey(issued.Key)
+			assert.Nil(t, err)
+			assert.EqualValues(t, stored.ID.Hex(), id)
+			assert.NotContains(t, stored.Hash, secret)
+		})
+	}
+}
+
+func TestGetAllAPIKeys(t *testing.T) {
+	mocks.GetAllAPIKeysFunc = func(ctx context.Context, owner string) ([]models.APIKey, error) {
+		return []models.APIKey{{Name: "billing", Owner: owner, Hash: "secret-hash"}}, nil
+	}
+
+	w := apiKeyRequest(kc.GetAll, http.MethodGet, "", "")
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret-hash")
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	type rotateAPIKeyTestCase struct {
+		Description string
+		Id          string
+		Err         error
+		Status      int
+	}
+
+	var testCases = []rotateAPIKeyTestCase{
+		{"valid", "629536b3fac02728de50c042", nil, http.StatusOK},
+		{"invalid id", "123", nil, http.StatusBadRequest},
+		{"not found or revoked", "629536b3fac02728de50c042", db.APIKeyNotFoundErr, http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			mocks.RotateAPIKeyFunc = func(ctx context.Context, id string, hash string) (*models.APIKey, error) {
+				if tc.Err != nil {
+					return nil, tc.Err
+				}
+				return &models.APIKey{Owner: "billing-svc", Hash: hash}, nil
+			}
+
+			w := apiKeyRequest(kc.Rotate, http.MethodPost, tc.Id, "")
+
+			assert.EqualValues(t, tc.Status, w.Code)
+			if tc.Status == http.StatusOK {
+				var issued models.IssuedAPIKey
+				assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &issued))
+				id, _, err := auth.ParseAPIKey(issued.Key)
+				assert.Nil(t, err)
+				assert.EqualValues(t, tc.Id, id)
+			}
+		})
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	type revokeAPIKeyTestCase struct {
+		Description string
+		Err         error
+		Status      int
+	}
+
+	var testCases = []revokeAPIKeyTestCase{
+		{"valid", nil, http.StatusOK},
+		{"invalid id", db.InvalidAPIKeyIdErr, http.StatusBadRequest},
+		{"not found", db.APIKeyNotFoundErr, http.StatusNotFound},
+		{"db error", errors.New("db error"), http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			mocks.RevokeAPIKeyFunc = func(ctx context.Context, id string) (*models.APIKey, error) {
+				if tc.Err != nil {
+					return nil, tc.Err
+				}
+				now := time.Now()
+				return &models.APIKey{Owner: "billing-svc", RevokedAt: &now}, nil
+			}
+
+			w := apiKeyRequest(kc.Revoke, http.MethodDelete, "629536b3fac02728de50c042", "")
+
+			assert.EqualValues(t, tc.Status, w.Code)
+		})
+	}
+}
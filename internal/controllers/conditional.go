@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+)
+
+const (
+	ETagHeader            = "ETag"
+	LastModifiedHeader    = "Last-Modified"
+	IfNoneMatchHeader     = "If-None-Match"
+	IfModifiedSinceHeader = "If-Modified-Since"
+)
+
+// bufferedWriter - Holds back the response so that it can be replaced by 304 Not Modified
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return false
+}
+
+// ConditionalGet - Adds a strong ETag to successful GET responses and answers with 304 Not Modified when the client's
+// copy is still current according to If-None-Match, or If-Modified-Since and the Last-Modified set by the handler.
+// Collections set no Last-Modified, their ETag covering X-Total-Count too.
+func ConditionalGet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		buffered := &bufferedWriter{ResponseWriter: original, status: http.StatusOK}
+		c.Writer = buffered
+		// Also when a handler panics, for the error response to reach the client
+		defer func() {
+			c.Writer = original
+		}()
+		c.Next()
+		c.Writer = original
+
+		if buffered.status != http.StatusOK {
+			original.WriteHeader(buffered.status)
+			original.Write(buffered.body.Bytes())
+			return
+		}
+
+		etag := original.Header().Get(ETagHeader)
+		if etag == "" {
+			etag = strongETag(buffered.body.Bytes(), original.Header().Get(TotalCountHeader))
+			original.Header().Set(ETagHeader, etag)
+		}
+
+		if notModified(c.Request, etag, original.Header().Get(LastModifiedHeader)) {
+			original.Header().Del("Content-Type")
+			original.Header().Del("Content-Length")
+			original.WriteHeader(http.StatusNotModified)
+			original.WriteHeaderNow()
+			return
+		}
+		original.WriteHeader(http.StatusOK)
+		original.Write(buffered.body.Bytes())
+	}
+}
+
+// SetLastModified - Sets Last-Modified to the given time, as long as it is known
+func SetLastModified(c *gin.Context, t time.Time) {
+	if !t.IsZero() {
+		c.Header(LastModifiedHeader, t.UTC().Format(http.TimeFormat))
+	}
+}
+
+// strongETag - Validator that changes whenever a single byte of the representation, or of the headers describing it
+// such as the total of a collection, changes
+func strongETag(body []byte, headers ...string) string {
+	h := sha256.New()
+	h.Write(body)
+	for _, header := range headers {
+		h.Write([]byte{0})
+		h.Write([]byte(header))
+	}
+	return "\"" + hex.EncodeToString(h.Sum(nil)[:16]) + "\""
+}
+
+// notModified - Evaluates the preconditions of a GET request as described in RFC 9110 13.2.2
+func notModified(r *http.Request, etag string, lastModified string) bool {
+	if inm := r.Header.Get(IfNoneMatchHeader); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		// If-Modified-Since must be ignored when If-None-Match is present
+		return false
+	}
+
+	ims := r.Header.Get(IfModifiedSinceHeader)
+	if ims == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+// lastUpdated - Most recent update time among the given orders
+func lastUpdated(orders ...models.Order) time.Time {
+	var latest time.Time
+	for _, o := range orders {
+		if t, err := time.Parse(time.RFC3339, o.LastUpdatedAt); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/middleware"
+	"github.com/rameshsunkara/go-rest-api-example/internal/mocks"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func conditionalRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	o := NewOrdersController(&mocks.MockOrdersDataService{})
+	r.GET("/api/v1/orders/:id", ConditionalGet(), o.GetById)
+	mocks.GetByIdFunc = func(ctx context.Context, id string, fields ...string) (interface{}, error) {
+		oid, _ := primitive.ObjectIDFromHex(id)
+		return &models.Order{ID: oid, LastUpdatedAt: "2022-05-30T21:27:15Z"}, nil
+	}
+	return r
+}
+
+func TestConditionalGet_SetsValidators(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/orders/629536b3fac02728de50c042", nil)
+	conditionalRouter().ServeHTTP(w, req)
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, w.Header().Get(ETagHeader))
+	assert.EqualValues(t, "Mon, 30 May 2022 21:27:15 GMT", w.Header().Get(LastModifiedHeader))
+	assert.Contains(t, w.Body.String(), "629536b3fac02728de50c042")
+}
+
+func TestConditionalGet_Preconditions(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/orders/629536b3fac02728de50c042", nil)
+	conditionalRouter().ServeHTTP(w, req)
+	etag := w.Header().Get(ETagHeader)
+
+	type preconditionTestCase struct {
+		Description  string
+		Headers      map[string]string
+		ExpectedCode int
+	}
+
+	var testCases = []preconditionTestCase{
+		{"matching etag", map[string]string{IfNoneMatchHeader: etag}, http.StatusNotModified},
+		{"matching weak etag in a list", map[string]string{IfNoneMatchHeader: `"abc", W/` + etag}, http.StatusNotModified},
+		{"any etag", map[string]string{IfNoneMatchHeader: "*"}, http.StatusNotModified},
+		{"stale etag", map[string]string{IfNoneMatchHeader: `"abc"`}, http.StatusOK},
+		{"not modified since", map[string]string{IfModifiedSinceHeader: "Tue, 31 May 2022 00:00:00 GMT"}, http.StatusNotModified},
+		{"modified since", map[string]string{IfModifiedSinceHeader: "Sun, 29 May 2022 00:00:00 GMT"}, http.StatusOK},
+		{"invalid date", map[string]string{IfModifiedSinceHeader: "yesterday"}, http.StatusOK},
+		{"etag takes precedence over date", map[string]string{
+			IfNoneMatchHeader:     `"abc"`,
+			IfModifiedSinceHeader: "Tue, 31 May 2022 00:00:00 GMT",
+		}, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/orders/629536b3fac02728de50c042", nil)
+			for k, v := range tc.Headers {
+				req.Header.Set(k, v)
+			}
+			conditionalRouter().ServeHTTP(w, req)
+
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+			assert.EqualValues(t, etag, w.Header().Get(ETagHeader))
+			if tc.ExpectedCode == http.StatusNotModified {
+				assert.Empty(t, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestConditionalGet_Collection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/v1/orders", ConditionalGet(), NewOrdersController(&mocks.MockOrdersDataService{}).GetAll)
+	mocks.GetAllFunc = func(ctx context.Context, fields ...string) (interface{}, error) {
+		return &[]models.Order{{LastUpdatedAt: "2022-05-30T21:27:15Z"}}, nil
+	}
+	total := int64(2)
+	mocks.CountFunc = func(ctx context.Context, exact bool) (int64, error) {
+		return total, nil
+	}
+	get := func(headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/orders", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(nil)
+	etag := w.Header().Get(ETagHeader)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(LastModifiedHeader))
+	// An order with an older update time may have been added, or one deleted
+	w = get(map[string]string{IfModifiedSinceHeader: "Tue, 31 May 2022 00:00:00 GMT"})
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, http.StatusNotModified, get(map[string]string{IfNoneMatchHeader: etag}).Code)
+
+	// Same page, but fewer orders in total
+	total = 1
+	w = get(map[string]string{IfNoneMatchHeader: etag})
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.NotEqualValues(t, etag, w.Header().Get(ETagHeader))
+}
+
+func TestConditionalGet_SkipsErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", ConditionalGet(), func(c *gin.Context) {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "db error"})
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(IfNoneMatchHeader, "*")
+	r.ServeHTTP(w, req)
+
+	assert.EqualValues(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get(ETagHeader))
+	assert.Contains(t, w.Body.String(), "db error")
+}
+
+func TestConditionalGet_Panic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Recovery())
+	r.GET("/", ConditionalGet(), func(c *gin.Context) {
+		panic("handler failed")
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.ServeHTTP(w, req)
+
+	assert.EqualValues(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get(ETagHeader))
+}
+
+func TestLastUpdated(t *testing.T) {
+	latest := lastUpdated(
+		models.Order{LastUpdatedAt: "2022-05-30T21:27:15Z"},
+		models.Order{LastUpdatedAt: "2022-06-01T10:00:00Z"},
+		models.Order{LastUpdatedAt: "not-a-date"},
+	)
+	assert.EqualValues(t, time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC), latest.UTC())
+	assert.True(t, lastUpdated().IsZero())
+}
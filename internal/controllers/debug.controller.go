@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+)
+
+type DebugController struct {
+	svcInfo *models.ServiceInfo
+}
+
+func NewDebugController(s *models.ServiceInfo) *DebugController {
+	return &DebugController{
+		svcInfo: s,
+	}
+}
+
+// RuntimeStats - Goroutines, memory and GC statistics of the service. Reading them stops the world for a moment, so
+// this is served on the admin listener only.
+func (d *DebugController) RuntimeStats(c *gin.Context) {
+	c.JSON(http.StatusOK, d.collect(time.Now()))
+}
+
+func (d *DebugController) collect(now time.Time) models.RuntimeStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	stats := models.RuntimeStats{
+		GoVersion:  runtime.Version(),
+		Uptime:     now.Sub(d.svcInfo.UpTime).Round(time.Second).String(),
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+		CgoCalls:   runtime.NumCgoCall(),
+		Memory: models.MemoryStats{
+			Alloc:        m.Alloc,
+			TotalAlloc:   m.TotalAlloc,
+			Sys:          m.Sys,
+			HeapAlloc:    m.HeapAlloc,
+			HeapInuse:    m.HeapInuse,
+			HeapIdle:     m.HeapIdle,
+			HeapReleased: m.HeapReleased,
+			HeapObjects:  m.HeapObjects,
+			StackInuse:   m.StackInuse,
+			Mallocs:      m.Mallocs,
+			Frees:        m.Frees,
+		},
+		GC: models.GCStats{
+			NumGC:         m.NumGC,
+			NumForcedGC:   m.NumForcedGC,
+			PauseTotal:    time.Duration(m.PauseTotalNs).String(),
+			LastPause:     time.Duration(m.PauseNs[(m.NumGC+255)%256]).String(),
+			NextGC:        m.NextGC,
+			GCCPUFraction: m.GCCPUFraction,
+		},
+		Collected: now.UTC(),
+	}
+	if m.LastGC != 0 {
+		last := time.Unix(0, int64(m.LastGC)).UTC()
+		stats.GC.LastGC = &last
+	}
+	return stats
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/debug/runtime", nil)
+	runtime.GC()
+
+	NewDebugController(svcInfo).RuntimeStats(c)
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	var stats models.RuntimeStats
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.EqualValues(t, runtime.Version(), stats.GoVersion)
+	assert.Greater(t, stats.Goroutines, 0)
+	assert.Greater(t, stats.Memory.HeapAlloc, uint64(0))
+	assert.Greater(t, stats.GC.NumGC, uint32(0))
+	assert.NotNil(t, stats.GC.LastGC)
+}
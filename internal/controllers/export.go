@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	FormatQuery = "format" // Query parameter to choose the export format
+
+	ExportNDJSON = "ndjson"
+	ExportCSV    = "csv"
+	MIMENDJSON   = "application/x-ndjson"
+
+	// DefaultExportFlushInterval - Longest time exported orders are held back before being sent to the client
+	DefaultExportFlushInterval = time.Second
+)
+
+// WithExportFlushInterval - Sets how often exported orders are flushed to the client
+func WithExportFlushInterval(interval time.Duration) OrdersOption {
+	return func(o *OrdersController) {
+		o.exportFlushInterval = interval
+	}
+}
+
+// Export  godoc
+// @Summary      Export all orders
+// @Description  Streams every order as NDJSON (one order per line) or CSV (one line per product)
+// @Tags         Fetch
+// @Produce      application/x-ndjson,text/csv
+// @Param        format  query   string  false  "ndjson (default) or csv"
+// @Param        fields  query   string  false  "Comma separated fields to export e.g. order_id,products.name"
+// @Success      200
+// @Failure      400     {string}  string  "bad request"
+// @Router       /api/v1/orders/export [get]
+func (oHandler *OrdersController) Export(c *gin.Context) {
+	format := c.DefaultQuery(FormatQuery, ExportNDJSON)
+	var write func(order *models.Order) error
+	flush := func() error { return nil }
+
+	switch format {
+	case ExportNDJSON:
+		enc := json.NewEncoder(c.Writer)
+		write = func(order *models.Order) error {
+			return enc.Encode(order)
+		}
+	case ExportCSV:
+		w := csv.NewWriter(c.Writer)
+		headerWritten := false
+		write = func(order *models.Order) error {
+			if !headerWritten {
+				headerWritten = true
+				if err := w.Write(csvHeader); err != nil {
+					return err
+				}
+			}
+			for _, row := range csvRows(*order) {
+				if err := w.Write(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		flush = func() error {
+			if !headerWritten {
+				headerWritten = true
+				if err := w.Write(csvHeader); err != nil {
+					return err
+				}
+			}
+			w.Flush()
+			return w.Error()
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": "format must be 'ndjson' or 'csv'"})
+		c.Abort()
+		return
+	}
+
+	interval := oHandler.exportFlushInterval
+	if interval <= 0 {
+		interval = DefaultExportFlushInterval
+	}
+
+	started := false
+	lastFlush := time.Now()
+	err := oHandler.dataSvc.Stream(c.Request.Context(), func(order *models.Order) error {
+		// Headers are sent with the first order, so that failures before it can still be reported properly
+		if !started {
+			started = true
+			oHandler.startExport(c, format)
+		}
+		if err := write(order); err != nil {
+			return err
+		}
+		if time.Since(lastFlush) >= interval {
+			if err := flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+			lastFlush = time.Now()
+		}
+		return nil
+	}, requestedFields(c)...)
+
+	switch {
+	case err == nil:
+		if !started {
+			oHandler.startExport(c, format)
+		}
+		if fErr := flush(); fErr != nil {
+			log.Ctx(c).Error().Err(fErr).Msg("unable to complete export")
+		}
+		c.Writer.Flush()
+	case errors.Is(err, context.Canceled):
+		log.Ctx(c).Info().Msg("export cancelled, client went away")
+	case !started && errors.Is(err, db.InvalidFieldErr):
+		c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": err.Error()})
+		c.Abort()
+	case !started:
+		log.Ctx(c).Error().Err(err).Msg("unable to export orders")
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error occurred while exporting purchase orders"})
+		c.Abort()
+	default:
+		// Too late to change the status, the truncated body is all the client gets
+		log.Ctx(c).Error().Err(err).Msg("export failed while streaming")
+		c.Abort()
+	}
+}
+
+// startExport - Sends the headers of an export in the given format
+func (oHandler *OrdersController) startExport(c *gin.Context, format string) {
+	contentType := MIMENDJSON
+	if format == ExportCSV {
+		contentType = MIMECSV + "; charset=utf-8"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"orders-%s.%s\"", time.Now().UTC().Format("20060102"), format))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+}
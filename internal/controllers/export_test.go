@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/mocks"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func streamOrders(count int) func(ctx context.Context, each func(order *models.Order) error, fields ...string) error {
+	return func(ctx context.Context, each func(order *models.Order) error, fields ...string) error {
+		for i := 0; i < count; i++ {
+			o := &models.Order{
+				ID:       primitive.NewObjectID(),
+				Products: []models.Product{{Name: "first", Price: 10}, {Name: "second", Price: 20}},
+			}
+			if err := each(o); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func export(query string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/v1/orders/export"+query, nil)
+
+	o := NewOrdersController(&mocks.MockOrdersDataService{})
+	o.Export(c)
+	return w
+}
+
+func TestExportSuccess_NDJSON(t *testing.T) {
+	mocks.StreamFunc = streamOrders(3)
+
+	w := export("")
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, MIMENDJSON, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".ndjson")
+	assert.True(t, w.Flushed)
+	lines := 0
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		order, err := UnMarshalOrderResponse(scanner.Bytes())
+		assert.NoError(t, err)
+		assert.EqualValues(t, 2, len(order.Products))
+		lines++
+	}
+	assert.EqualValues(t, 3, lines)
+}
+
+func TestExportSuccess_CSV(t *testing.T) {
+	mocks.StreamFunc = streamOrders(3)
+
+	w := export("?format=csv")
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), MIMECSV)
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.EqualValues(t, csvHeader, rows[0])
+	assert.EqualValues(t, 1+3*2, len(rows))
+}
+
+func TestExportSuccess_Empty(t *testing.T) {
+	mocks.StreamFunc = streamOrders(0)
+
+	w := export("?format=csv")
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	rows, _ := csv.NewReader(w.Body).ReadAll()
+	assert.EqualValues(t, [][]string{csvHeader}, rows)
+}
+
+func TestExportSuccess_Fields(t *testing.T) {
+	var gotFields []string
+	mocks.StreamFunc = func(ctx context.Context, each func(order *models.Order) error, fields ...string) error {
+		gotFields = fields
+		return nil
+	}
+
+	w := export("?fields=order_id,products.name")
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, []string{"order_id", "products.name"}, gotFields)
+}
+
+func TestExportFailure(t *testing.T) {
+	type exportFailureTestCase struct {
+		Description  string
+		Query        string
+		StreamErr    error
+		ExpectedCode int
+	}
+
+	var testCases = []exportFailureTestCase{
+		{"unknown format", "?format=xlsx", nil, http.StatusBadRequest},
+		{"unknown field", "?fields=customer", db.InvalidFieldErr, http.StatusBadRequest},
+		{"db error", "", errors.New("db error"), http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			mocks.StreamFunc = func(ctx context.Context, each func(order *models.Order) error, fields ...string) error {
+				return tc.StreamErr
+			}
+
+			w := export(tc.Query)
+
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+		})
+	}
+}
+
+func TestExportFailure_WhileStreaming(t *testing.T) {
+	mocks.StreamFunc = func(ctx context.Context, each func(order *models.Order) error, fields ...string) error {
+		_ = each(&models.Order{ID: primitive.NewObjectID()})
+		return errors.New("cursor error")
+	}
+
+	w := export("")
+
+	// Status was sent with the first order, so the response can only be cut short
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	lines := 0
+	for scanner := bufio.NewScanner(w.Body); scanner.Scan(); {
+		lines++
+	}
+	assert.EqualValues(t, 1, lines)
+}
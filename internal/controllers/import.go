@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DryRunQuery = "dry_run" // Query parameter to validate an import without storing anything
+	ImportFile  = "file"    // Form field carrying the file of a multipart import
+
+	ImportChunkSize   = 500
+	MaxImportLineSize = 1 << 20
+)
+
+// ImportStoreErr - Orders of an import couldn't be stored, for another reason than the orders themselves
+var ImportStoreErr = errors.New("unable to store imported orders")
+
+// orderImport - Orders read from an import, waiting to be inserted
+type orderImport struct {
+	c      *gin.Context
+	svc    db.OrdersDataService
+	dryRun bool
+	report *models.ImportReport
+	orders []*models.Order
+	lines  []int
+}
+
+// Import  godoc
+// @Summary      Import orders
+// @Description  Creates orders from an NDJSON (one order per line) or CSV (one product per line, lines of an order
+// @Description  sharing its order_id) file, uploaded as multipart 'file' field or as the request body.
+// @Description  Every record is validated and the report lists rejected lines with the reason.
+// @Tags         Fetch
+// @Accept       mpfd,application/x-ndjson,text/csv
+// @Produce      json
+// @Param        format   query     string  false  "ndjson or csv, detected from the content type or file name by default"
+// @Param        dry_run  query     bool    false  "Only validate, nothing is stored"
+// @Success      200      {object}  models.ImportReport
+// @Failure      400      {string}  string  "bad request"
+// @Failure      500      {string}  string  "orders couldn't be stored, those of the report's accepted count were"
+// @Router       /api/v1/orders/import [post]
+func (oHandler *OrdersController) Import(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery(DryRunQuery, "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": "dry_run must be a boolean"})
+		c.Abort()
+		return
+	}
+
+	source, format, err := importSource(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": err.Error()})
+		c.Abort()
+		return
+	}
+
+	imp := &orderImport{
+		c:      c,
+		svc:    oHandler.dataSvc,
+		dryRun: dryRun,
+		report: &models.ImportReport{DryRun: dryRun, Errors: []models.ImportRowError{}},
+	}
+	switch format {
+	case ExportNDJSON:
+		err = imp.readNDJSON(source)
+	case ExportCSV:
+		err = imp.readCSV(source)
+	}
+	if err == nil {
+		err = imp.flush()
+	}
+	if errors.Is(err, ImportStoreErr) {
+		// Not a final answer, the client can retry once the DB is back
+		log.Ctx(c).Error().Err(err).Msg("unable to store import")
+		c.JSON(http.StatusInternalServerError, gin.H{"message": ImportStoreErr.Error(), "report": imp.report})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		// Chunks inserted before the failure stay, the report tells what they were
+		log.Ctx(c).Error().Err(err).Msg("unable to read import")
+		c.JSON(http.StatusBadRequest, gin.H{"message": "unable to read import", "error": err.Error(), "report": imp.report})
+		c.Abort()
+		return
+	}
+
+	sort.SliceStable(imp.report.Errors, func(i, j int) bool {
+		return imp.report.Errors[i].Line < imp.report.Errors[j].Line
+	})
+	c.JSON(http.StatusOK, imp.report)
+}
+
+// importSource - Finds the file to import, either the 'file' part of a multipart request or the whole body, and its
+// format. Multipart requests are streamed as well, the file is never held in memory as a whole.
+func importSource(c *gin.Context) (io.Reader, string, error) {
+	format := c.Query(FormatQuery)
+	source := io.Reader(c.Request.Body)
+	contentType, filename := c.ContentType(), ""
+
+	if contentType == binding.MIMEMultipartPOSTForm {
+		mr, err := c.Request.MultipartReader()
+		if err != nil {
+			return nil, "", err
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil, "", fmt.Errorf("multipart request has no '%s' field", ImportFile)
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			if part.FormName() == ImportFile {
+				source, filename = part, part.FileName()
+				contentType, _, _ = mime.ParseMediaType(part.Header.Get("Content-Type"))
+				break
+			}
+		}
+	}
+
+	if format == "" {
+		switch {
+		case contentType == MIMENDJSON, strings.EqualFold(filepath.Ext(filename), ".ndjson"),
+			strings.EqualFold(filepath.Ext(filename), ".jsonl"):
+			format = ExportNDJSON
+		case contentType == MIMECSV, strings.EqualFold(filepath.Ext(filename), ".csv"):
+			format = ExportCSV
+		}
+	}
+	if format != ExportNDJSON && format != ExportCSV {
+		return nil, "", errors.New("format must be 'ndjson' or 'csv'")
+	}
+	return source, format, nil
+}
+
+// readNDJSON - Every non blank line is an order
+func (imp *orderImport) readNDJSON(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxImportLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		order := &models.Order{}
+		if err := json.Unmarshal([]byte(text), order); err != nil {
+			imp.report.Reject(line, "invalid JSON: "+err.Error())
+			continue
+		}
+		if err := imp.add(line, order); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readCSV - Every line is a product, consecutive lines with the same order_id make up one order and lines without
+// order_id are orders of a single product
+func (imp *orderImport) readCSV(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	columns := newCSVColumns(header)
+
+	var current *models.Order
+	currentLine := 0
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// FieldPos is only valid for rows read without error
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return err
+			}
+			imp.report.Reject(parseErr.StartLine, "invalid CSV: "+parseErr.Err.Error())
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		id, product, err := columns.parse(row)
+		if err != nil {
+			imp.report.Reject(line, err.Error())
+			continue
+		}
+		if current != nil && !id.IsZero() && current.ID == id {
+			current.Products = append(current.Products, product)
+			continue
+		}
+		if current != nil {
+			if err := imp.add(currentLine, current); err != nil {
+				return err
+			}
+		}
+		current, currentLine = &models.Order{ID: id, Products: []models.Product{product}}, line
+	}
+	if current != nil {
+		return imp.add(currentLine, current)
+	}
+	return nil
+}
+
+// add - Validates the order read at line, and queues it for insertion
+func (imp *orderImport) add(line int, order *models.Order) error {
+	if err := order.Validate(); err != nil {
+		imp.report.Reject(line, err.Error())
+		return nil
+	}
+	imp.orders = append(imp.orders, order)
+	imp.lines = append(imp.lines, line)
+	if len(imp.orders) >= ImportChunkSize {
+		return imp.flush()
+	}
+	return nil
+}
+
+// flush - Inserts the queued orders. Orders rejected by the DB, such as duplicates, are reported, any other failure is
+// returned as an ImportStoreErr.
+func (imp *orderImport) flush() error {
+	if len(imp.orders) == 0 {
+		return nil
+	}
+	orders, lines := imp.orders, imp.lines
+	imp.orders, imp.lines = nil, nil
+
+	if imp.dryRun {
+		imp.report.Accepted += len(orders)
+		return nil
+	}
+
+	_, err := imp.svc.CreateMany(imp.c, orders)
+	if err == nil {
+		imp.report.Accepted += len(orders)
+		return nil
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 || bulkErr.WriteConcernError != nil {
+		return fmt.Errorf("%w: %v", ImportStoreErr, err)
+	}
+	imp.report.Accepted += len(orders) - len(bulkErr.WriteErrors)
+	for _, we := range bulkErr.WriteErrors {
+		reason := "unable to store order"
+		if mongo.IsDuplicateKeyError(we) {
+			reason = "order_id already exists"
+		}
+		imp.report.Reject(lines[we.Index], reason)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/mocks"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func importOrders(query string, contentType string, body io.Reader) (*httptest.ResponseRecorder, *models.ImportReport) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/api/v1/orders/import"+query, body)
+	c.Request.Header.Set("Content-Type", contentType)
+
+	o := NewOrdersController(&mocks.MockOrdersDataService{})
+	o.Import(c)
+
+	var report models.ImportReport
+	_ = json.Unmarshal(w.Body.Bytes(), &report)
+	return w, &report
+}
+
+func TestImportSuccess_NDJSON(t *testing.T) {
+	var inserted []*models.Order
+	mocks.CreateManyFunc = func(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error) {
+		inserted = append(inserted, purchaseOrders...)
+		return &mongo.InsertManyResult{}, nil
+	}
+	body := strings.Join([]string{
+		`{"Products":[{"Name":"first","Price":10}]}`,
+		``,
+		`{"Products":[{"Name":"second","Price":20},{"Name":"third","Price":30}]}`,
+		`{"Products":[]}`,
+		`{"Products":[{"Name":"","Price":10}]}`,
+		`not json`,
+	}, "\n")
+
+	w, report := importOrders("", MIMENDJSON, strings.NewReader(body))
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 2, report.Accepted)
+	assert.EqualValues(t, 3, report.Rejected)
+	assert.EqualValues(t, 2, len(inserted))
+	assert.EqualValues(t, 2, len(inserted[1].Products))
+	assert.EqualValues(t, 4, report.Errors[0].Line)
+	assert.EqualValues(t, "order has no products", report.Errors[0].Reason)
+	assert.EqualValues(t, 5, report.Errors[1].Line)
+	assert.EqualValues(t, 6, report.Errors[2].Line)
+	assert.Contains(t, report.Errors[2].Reason, "invalid JSON")
+}
+
+func TestImportSuccess_CSV(t *testing.T) {
+	var inserted []*models.Order
+	mocks.CreateManyFunc = func(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error) {
+		inserted = append(inserted, purchaseOrders...)
+		return &mongo.InsertManyResult{}, nil
+	}
+	body := "order_id,product_name,product_price\n" +
+		"629536b3fac02728de50c042,first,10\n" +
+		"629536b3fac02728de50c042,second,20\n" +
+		",third,30\n" +
+		",fourth,abc\n" +
+		"bad-id,fifth,50\n" +
+		",,60\n"
+
+	w, report := importOrders("", MIMECSV, strings.NewReader(body))
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 2, report.Accepted)
+	assert.EqualValues(t, 3, report.Rejected)
+	assert.EqualValues(t, 2, len(inserted))
+	assert.EqualValues(t, "629536b3fac02728de50c042", inserted[0].ID.Hex())
+	assert.EqualValues(t, 2, len(inserted[0].Products))
+	assert.EqualValues(t, "third", inserted[1].Products[0].Name)
+	assert.EqualValues(t, []models.ImportRowError{
+		{Line: 5, Reason: `invalid product_price "abc"`},
+		{Line: 6, Reason: `invalid order_id "bad-id"`},
+		{Line: 7, Reason: "product 1 has no name"},
+	}, report.Errors)
+}
+
+func TestImportSuccess_CSVMalformedQuote(t *testing.T) {
+	var inserted []*models.Order
+	mocks.CreateManyFunc = func(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error) {
+		inserted = append(inserted, purchaseOrders...)
+		return &mongo.InsertManyResult{}, nil
+	}
+	body := "order_id,product_name,product_price\n" +
+		",first,10\n" +
+		"\"629536b3fac02728de50c042\"x,second,20\n" +
+		",third,30\n"
+
+	w, report := importOrders("", MIMECSV, strings.NewReader(body))
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 2, report.Accepted)
+	assert.EqualValues(t, 1, report.Rejected)
+	assert.EqualValues(t, 2, len(inserted))
+	assert.EqualValues(t, "third", inserted[1].Products[0].Name)
+	assert.EqualValues(t, 3, report.Errors[0].Line)
+	assert.Contains(t, report.Errors[0].Reason, "invalid CSV")
+}
+
+func TestImportSuccess_DryRun(t *testing.T) {
+	mocks.CreateManyFunc = func(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error) {
+		t.Error("nothing must be stored in a dry run")
+		return nil, nil
+	}
+
+	w, report := importOrders("?dry_run=true", MIMENDJSON,
+		strings.NewReader(`{"Products":[{"Name":"first","Price":10}]}`+"\n{}"))
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.True(t, report.DryRun)
+	assert.EqualValues(t, 1, report.Accepted)
+	assert.EqualValues(t, 1, report.Rejected)
+}
+
+func TestImportSuccess_Multipart(t *testing.T) {
+	var inserted []*models.Order
+	mocks.CreateManyFunc = func(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error) {
+		inserted = append(inserted, purchaseOrders...)
+		return &mongo.InsertManyResult{}, nil
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("comment", "monthly upload")
+	part, _ := mw.CreateFormFile("file", "orders.csv")
+	_, _ = part.Write([]byte("product_name,product_price\nfirst,10\nsecond,20\n"))
+	_ = mw.Close()
+
+	w, report := importOrders("", mw.FormDataContentType(), &body)
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 2, report.Accepted)
+	assert.EqualValues(t, 2, len(inserted))
+}
+
+func TestImportSuccess_PartialInsert(t *testing.T) {
+	mocks.CreateManyFunc = func(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error) {
+		return nil, mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{
+			WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "E11000 duplicate key error"},
+		}}}
+	}
+	body := "order_id,product_name,product_price\n" +
+		"629536b3fac02728de50c042,first,10\n" +
+		"629fd50cb1e95cbe7ac12aae,second,20\n"
+
+	w, report := importOrders("", MIMECSV, strings.NewReader(body))
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 1, report.Accepted)
+	assert.EqualValues(t, []models.ImportRowError{{Line: 3, Reason: "order_id already exists"}}, report.Errors)
+}
+
+func TestImportFailure_DBError(t *testing.T) {
+	mocks.CreateManyFunc = func(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error) {
+		return nil, errors.New("db error")
+	}
+
+	w, _ := importOrders("", MIMECSV, strings.NewReader("product_name,product_price\nfirst,10\n"))
+
+	// Not a final answer, nothing was rejected
+	var resp struct {
+		Report models.ImportReport `json:"report"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.EqualValues(t, http.StatusInternalServerError, w.Code)
+	assert.EqualValues(t, 0, resp.Report.Accepted)
+	assert.Empty(t, resp.Report.Errors)
+}
+
+func TestImportFailure_BadRequest(t *testing.T) {
+	type importFailureTestCase struct {
+		Description string
+		Query       string
+		ContentType string
+	}
+
+	var testCases = []importFailureTestCase{
+		{"unknown format", "", "application/pdf"},
+		{"invalid dry_run", "?dry_run=maybe", MIMECSV},
+		{"multipart without file", "", "multipart/form-data; boundary=xyz"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			w, _ := importOrders(tc.Query, tc.ContentType, strings.NewReader("--xyz--\r\n"))
+
+			assert.EqualValues(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/jobs"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+)
+
+const (
+	JobIdPath = "id"
+	JobsPath  = "/api/v1/jobs"
+)
+
+type JobsController struct {
+	runner *jobs.Runner
+}
+
+func NewJobsController(runner *jobs.Runner) *JobsController {
+	return &JobsController{
+		runner: runner,
+	}
+}
+
+// GetById  godoc
+// @Summary      Fetch a background job
+// @Description  Returns the status, progress and, once finished, the result or error of the job
+// @Param        id   path      string  true  "Job ID"
+// @Tags         Jobs
+// @Produce      json
+// @Success      200  {object}  models.Job
+// @Failure      400  {string}  string  "bad request"
+// @Failure      404  {string}  string  "not found"
+// @Router       /api/v1/jobs/{id} [get]
+func (jHandler *JobsController) GetById(c *gin.Context) {
+	job, err := jHandler.runner.Get(c, c.Param(JobIdPath))
+	if err != nil {
+		abortJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// Cancel  godoc
+// @Summary      Cancel a background job
+// @Description  A queued job never starts, a running one stops as soon as possible. Finished jobs can't be cancelled.
+// @Param        id   path      string  true  "Job ID"
+// @Tags         Jobs
+// @Produce      json
+// @Success      202  {object}  models.Job
+// @Failure      404  {string}  string  "not found"
+// @Failure      409  {string}  string  "job already finished"
+// @Router       /api/v1/jobs/{id}/cancel [post]
+func (jHandler *JobsController) Cancel(c *gin.Context) {
+	job, err := jHandler.runner.Cancel(c, c.Param(JobIdPath))
+	if err != nil {
+		abortJobError(c, err)
+		return
+	}
+	if job.Finished() && job.Status != models.JobCancelled {
+		c.JSON(http.StatusConflict, gin.H{"message": "job already finished", "job": job})
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// Accepted - Responds to a request whose work was handed over to the job, pointing the client to its status
+func Accepted(c *gin.Context, job *models.Job) {
+	c.Header("Location", JobsPath+"/"+job.ID.Hex())
+	c.JSON(http.StatusAccepted, job)
+}
+
+func abortJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, db.InvalidJobIdErr):
+		c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": err.Error()})
+	case errors.Is(err, db.JobNotFoundErr):
+		c.JSON(http.StatusNotFound, gin.H{"message": "job not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "unable to retrieve job", "error": err.Error()})
+	}
+	c.Abort()
+}
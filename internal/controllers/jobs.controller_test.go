@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/jobs"
+	"github.com/rameshsunkara/go-rest-api-example/internal/mocks"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var jc = NewJobsController(jobs.NewRunner(&mocks.MockJobsDataService{}))
+
+func jobRequest(handler gin.HandlerFunc, id string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/v1/jobs/"+id, nil)
+	c.Params = []gin.Param{{Key: JobIdPath, Value: id}}
+	handler(c)
+	return w
+}
+
+func TestGetJobById(t *testing.T) {
+	type getJobTestCase struct {
+		Description string
+		Job         *models.Job
+		Err         error
+		Status      int
+	}
+
+	var testCases = []getJobTestCase{
+		{"running", &models.Job{Status: models.JobRunning, Progress: models.JobProgress{Done: 1, Total: 2}}, nil, http.StatusOK},
+		{"invalid id", nil, db.InvalidJobIdErr, http.StatusBadRequest},
+		{"not found", nil, db.JobNotFoundErr, http.StatusNotFound},
+		{"db error", nil, errors.New("db error"), http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			mocks.GetJobByIdFunc = func(ctx context.Context, id string) (*models.Job, error) {
+				return tc.Job, tc.Err
+			}
+
+			w := jobRequest(jc.GetById, "629536b3fac02728de50c042")
+
+			assert.EqualValues(t, tc.Status, w.Code)
+		})
+	}
+}
+
+func TestGetJobById_Caller(t *testing.T) {
+	var caller *models.Principal
+	mocks.GetJobByIdFunc = func(ctx context.Context, id string) (*models.Job, error) {
+		caller = models.PrincipalFromContext(ctx)
+		return nil, db.JobNotFoundErr
+	}
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/v1/jobs/629536b3fac02728de50c042", nil)
+	c.Params = []gin.Param{{Key: JobIdPath, Value: "629536b3fac02728de50c042"}}
+	c.Set(models.PrincipalKey, &models.Principal{Subject: "alice"})
+
+	jc.GetById(c)
+
+	// Jobs of others are looked up as the caller, and not found
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+	assert.EqualValues(t, "alice", caller.Subject)
+}
+
+func TestCancelJob(t *testing.T) {
+	type cancelJobTestCase struct {
+		Description string
+		Job         *models.Job
+		Err         error
+		Status      int
+	}
+
+	var testCases = []cancelJobTestCase{
+		{"running", &models.Job{Status: models.JobRunning, CancelRequested: true}, nil, http.StatusAccepted},
+		{"queued", &models.Job{Status: models.JobCancelled, CancelRequested: true}, nil, http.StatusAccepted},
+		{"finished", &models.Job{Status: models.JobSucceeded}, nil, http.StatusConflict},
+		{"not found", nil, db.JobNotFoundErr, http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			mocks.CancelJobFunc = func(ctx context.Context, id string) (*models.Job, error) {
+				return tc.Job, tc.Err
+			}
+
+			w := jobRequest(jc.Cancel, "629536b3fac02728de50c042")
+
+			assert.EqualValues(t, tc.Status, w.Code)
+		})
+	}
+}
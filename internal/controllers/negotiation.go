@@ -0,0 +1,356 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/ugorji/go/codec"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	MIMECSV   = "text/csv"
+	MIMEYAML2 = "application/yaml"
+
+	negotiatedFormatKey = "negotiatedFormat"
+)
+
+// OrderFormats - Media types the orders endpoints can produce and consume, the first one being the default
+var OrderFormats = []string{
+	binding.MIMEJSON,
+	binding.MIMEXML,
+	binding.MIMEXML2,
+	binding.MIMEYAML,
+	MIMEYAML2,
+	binding.MIMEMSGPACK,
+	binding.MIMEMSGPACK2,
+	MIMECSV,
+}
+
+var UnsupportedMediaTypeErr = errors.New("unsupported media type")
+
+// csvHeader - Orders are flattened to one CSV row per product
+var csvHeader = []string{
+	"order_id", "last_updated_at",
+	"product_name", "product_updated_at", "product_price", "product_status", "product_remarks",
+}
+
+// Negotiate - Picks the response format from the Accept header, rejecting requests for unsupported formats with 406
+func Negotiate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept")
+		format := c.NegotiateFormat(OrderFormats...)
+		if format == "" {
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{
+				"message":   "none of the accepted media types can be produced",
+				"supported": OrderFormats,
+			})
+			return
+		}
+		c.Set(negotiatedFormatKey, format)
+		c.Next()
+	}
+}
+
+// respond - Renders orders in the format negotiated for the request, JSON if there was no negotiation
+func respond(c *gin.Context, code int, obj interface{}) {
+	var err error
+	switch c.GetString(negotiatedFormatKey) {
+	case binding.MIMEXML, binding.MIMEXML2:
+		c.XML(code, xmlDocument(obj))
+		return
+	case binding.MIMEYAML, MIMEYAML2:
+		err = renderYAML(c, code, obj)
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		err = renderMsgPack(c, code, obj)
+	case MIMECSV:
+		err = renderCSV(c, code, obj)
+	default:
+		c.JSON(code, obj)
+		return
+	}
+	if err != nil {
+		_ = c.Error(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "unable to render response"})
+	}
+}
+
+// bindOrder - Decodes the request body into order according to its Content-Type, JSON when none is given
+func bindOrder(c *gin.Context, order *models.Order) error {
+	switch c.ContentType() {
+	case "", binding.MIMEJSON:
+		return c.ShouldBindWith(order, binding.JSON)
+	case binding.MIMEXML, binding.MIMEXML2:
+		return c.ShouldBindWith(order, binding.XML)
+	case binding.MIMEYAML, MIMEYAML2:
+		var generic interface{}
+		if err := yaml.NewDecoder(c.Request.Body).Decode(&generic); err != nil {
+			return err
+		}
+		return fromGeneric(generic, order)
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		var generic interface{}
+		if err := codec.NewDecoder(c.Request.Body, msgpackHandle()).Decode(&generic); err != nil {
+			return err
+		}
+		return fromGeneric(generic, order)
+	case MIMECSV:
+		return decodeCSV(c.Request.Body, order)
+	default:
+		return UnsupportedMediaTypeErr
+	}
+}
+
+// abortBindError - Responds to a request whose body couldn't be decoded
+func abortBindError(c *gin.Context, err error) {
+	if errors.Is(err, UnsupportedMediaTypeErr) {
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+			"message":   "unsupported Content-Type",
+			"supported": OrderFormats,
+		})
+		return
+	}
+	c.AbortWithError(http.StatusBadRequest, err)
+}
+
+// xmlDocument - XML needs a single root element, so lists of orders are wrapped in one
+func xmlDocument(obj interface{}) interface{} {
+	type ordersDocument struct {
+		XMLName struct{}       `xml:"Orders"`
+		Orders  []models.Order `xml:"Order"`
+	}
+
+	switch v := obj.(type) {
+	case []models.Order:
+		return ordersDocument{Orders: v}
+	case *[]models.Order:
+		if v != nil {
+			return ordersDocument{Orders: *v}
+		}
+		return ordersDocument{}
+	}
+	return obj
+}
+
+func renderYAML(c *gin.Context, code int, obj interface{}) error {
+	generic, err := toGeneric(obj)
+	if err != nil {
+		return err
+	}
+	out, err := yaml.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	c.Data(code, binding.MIMEYAML+"; charset=utf-8", out)
+	return nil
+}
+
+func renderMsgPack(c *gin.Context, code int, obj interface{}) error {
+	generic, err := toGeneric(obj)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := codec.NewEncoder(&out, msgpackHandle()).Encode(generic); err != nil {
+		return err
+	}
+	c.Render(code, render.Data{ContentType: binding.MIMEMSGPACK2, Data: out.Bytes()})
+	return nil
+}
+
+func renderCSV(c *gin.Context, code int, obj interface{}) error {
+	var orders []models.Order
+	switch v := obj.(type) {
+	case nil:
+		// No orders, just the header as for nil pointers
+	case models.Order:
+		orders = []models.Order{v}
+	case *models.Order:
+		if v != nil {
+			orders = []models.Order{*v}
+		}
+	case []models.Order:
+		orders = v
+	case *[]models.Order:
+		if v != nil {
+			orders = *v
+		}
+	default:
+		return fmt.Errorf("no CSV representation for %T", obj)
+	}
+
+	var out bytes.Buffer
+	w := csv.NewWriter(&out)
+	_ = w.Write(csvHeader)
+	for _, o := range orders {
+		for _, row := range csvRows(o) {
+			_ = w.Write(row)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	c.Data(code, MIMECSV+"; charset=utf-8", out.Bytes())
+	return nil
+}
+
+// csvRows - One row per product of the order, or a single row without product details when there are none
+func csvRows(o models.Order) [][]string {
+	id := ""
+	if !o.ID.IsZero() {
+		id = o.ID.Hex()
+	}
+	if len(o.Products) == 0 {
+		return [][]string{{id, o.LastUpdatedAt, "", "", "", "", ""}}
+	}
+
+	rows := make([][]string, 0, len(o.Products))
+	for _, p := range o.Products {
+		price := ""
+		if p.Price != 0 {
+			price = strconv.FormatUint(uint64(p.Price), 10)
+		}
+		rows = append(rows, []string{id, o.LastUpdatedAt, p.Name, p.UpdatedAt, price, p.Status, p.Remarks})
+	}
+	return rows
+}
+
+// decodeCSV - Reads an order written as by renderCSV, each row contributing one product
+func decodeCSV(r io.Reader, order *models.Order) error {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return errors.New("CSV body is empty")
+	}
+
+	columns := newCSVColumns(records[0])
+	for _, row := range records[1:] {
+		id, product, err := columns.parse(row)
+		if err != nil {
+			return err
+		}
+		if !id.IsZero() {
+			if !order.ID.IsZero() && order.ID != id {
+				return errors.New("CSV rows belong to different orders")
+			}
+			order.ID = id
+		}
+		if product != (models.Product{}) {
+			order.Products = append(order.Products, product)
+		}
+	}
+	return nil
+}
+
+// csvColumns - Position of each column of the CSV header, by name
+type csvColumns map[string]int
+
+func newCSVColumns(header []string) csvColumns {
+	columns := make(csvColumns, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	return columns
+}
+
+func (columns csvColumns) value(row []string, name string) string {
+	if i, ok := columns[name]; ok && i < len(row) {
+		return strings.TrimSpace(row[i])
+	}
+	return ""
+}
+
+// parse - Reads the order id and the product of a CSV row
+func (columns csvColumns) parse(row []string) (primitive.ObjectID, models.Product, error) {
+	var id primitive.ObjectID
+	if hex := columns.value(row, "order_id"); hex != "" {
+		var err error
+		if id, err = primitive.ObjectIDFromHex(hex); err != nil {
+			return id, models.Product{}, fmt.Errorf("invalid order_id %q", hex)
+		}
+	}
+
+	p := models.Product{
+		Name:      columns.value(row, "product_name"),
+		UpdatedAt: columns.value(row, "product_updated_at"),
+		Status:    columns.value(row, "product_status"),
+		Remarks:   columns.value(row, "product_remarks"),
+	}
+	if price := columns.value(row, "product_price"); price != "" {
+		v, err := strconv.ParseUint(price, 10, 0)
+		if err != nil {
+			return id, p, fmt.Errorf("invalid product_price %q", price)
+		}
+		p.Price = uint(v)
+	}
+	return id, p, nil
+}
+
+// toGeneric - Turns obj into maps, slices and scalars shaped exactly like its JSON representation, so that every
+// format shares the same field names and value encodings
+func toGeneric(obj interface{}) (interface{}, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var generic interface{}
+	if err := d.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return normalizeNumbers(generic), nil
+}
+
+// fromGeneric - Reverse of toGeneric
+func fromGeneric(generic interface{}, obj interface{}) error {
+	raw, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, obj)
+}
+
+func normalizeNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range t {
+			t[k] = normalizeNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range t {
+			t[i] = normalizeNumbers(item)
+		}
+	}
+	return v
+}
+
+func msgpackHandle() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.RawToString = true
+	h.WriteExt = true
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return h
+}
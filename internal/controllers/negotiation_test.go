@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/mocks"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gopkg.in/yaml.v3"
+)
+
+const negotiationOrderId = "629536b3fac02728de50c042"
+
+func negotiationRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	o := NewOrdersController(&mocks.MockOrdersDataService{})
+	r.GET("/api/v1/orders", Negotiate(), o.GetAll)
+	r.GET("/api/v1/orders/:id", Negotiate(), o.GetById)
+	r.POST("/api/v1/orders", Negotiate(), o.Create)
+
+	id, _ := primitive.ObjectIDFromHex(negotiationOrderId)
+	order := models.Order{
+		ID:            id,
+		LastUpdatedAt: "2022-05-30T21:27:15Z",
+		Products: []models.Product{
+			{Name: "first", Price: 10, Remarks: "with, comma"},
+			{Name: "second", Price: 20},
+		},
+	}
+	mocks.GetByIdFunc = func(ctx context.Context, id string, fields ...string) (interface{}, error) {
+		return &order, nil
+	}
+	mocks.GetAllFunc = func(ctx context.Context, fields ...string) (interface{}, error) {
+		return &[]models.Order{order, {ID: primitive.NewObjectID()}}, nil
+	}
+	mocks.CountFunc = func(ctx context.Context, exact bool) (int64, error) {
+		return 2, nil
+	}
+	mocks.CreateFunc = func(ctx context.Context, purchaseOrder interface{}) (*mongo.InsertOneResult, error) {
+		return &mongo.InsertOneResult{InsertedID: id}, nil
+	}
+	return r
+}
+
+func negotiate(accept string, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	negotiationRouter().ServeHTTP(w, req)
+	return w
+}
+
+func TestNegotiate_Formats(t *testing.T) {
+	type formatTestCase struct {
+		Accept              string
+		ExpectedContentType string
+		Decode              func(body []byte) (*models.Order, error)
+	}
+
+	var testCases = []formatTestCase{
+		{"", "application/json", func(body []byte) (*models.Order, error) {
+			return UnMarshalOrderResponse(body)
+		}},
+		{"application/xml", "application/xml", func(body []byte) (*models.Order, error) {
+			var o models.Order
+			err := xml.Unmarshal(body, &o)
+			return &o, err
+		}},
+		{"application/x-yaml", "application/x-yaml", func(body []byte) (*models.Order, error) {
+			var generic interface{}
+			if err := yaml.Unmarshal(body, &generic); err != nil {
+				return nil, err
+			}
+			var o models.Order
+			err := fromGeneric(generic, &o)
+			return &o, err
+		}},
+		{"application/msgpack", "application/msgpack", func(body []byte) (*models.Order, error) {
+			var generic interface{}
+			if err := codec.NewDecoderBytes(body, msgpackHandle()).Decode(&generic); err != nil {
+				return nil, err
+			}
+			var o models.Order
+			err := fromGeneric(generic, &o)
+			return &o, err
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ExpectedContentType, func(t *testing.T) {
+			w := negotiate(tc.Accept, "/api/v1/orders/"+negotiationOrderId)
+
+			assert.EqualValues(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Header().Get("Content-Type"), tc.ExpectedContentType)
+			assert.EqualValues(t, "Accept", w.Header().Get("Vary"))
+			order, err := tc.Decode(w.Body.Bytes())
+			assert.NoError(t, err)
+			assert.EqualValues(t, negotiationOrderId, order.ID.Hex())
+			assert.EqualValues(t, 2, len(order.Products))
+			assert.EqualValues(t, 20, order.Products[1].Price)
+		})
+	}
+}
+
+func TestNegotiate_XMLList(t *testing.T) {
+	w := negotiate("application/xml", "/api/v1/orders")
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "<Orders><Order><order_id>"+negotiationOrderId), w.Body.String())
+	assert.EqualValues(t, 2, strings.Count(w.Body.String(), "<Order>"))
+}
+
+func TestNegotiate_CSVList(t *testing.T) {
+	w := negotiate("text/csv", "/api/v1/orders")
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/csv")
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	// header, one row per product of the first order and one row for the order without products
+	assert.EqualValues(t, 4, len(rows))
+	assert.EqualValues(t, csvHeader, rows[0])
+	assert.EqualValues(t, []string{negotiationOrderId, "2022-05-30T21:27:15Z", "first", "", "10", "", "with, comma"}, rows[1])
+	assert.EqualValues(t, "second", rows[2][2])
+	assert.EqualValues(t, "", rows[3][2])
+}
+
+func TestRenderCSV(t *testing.T) {
+	type renderCSVTestCase struct {
+		Description  string
+		Obj          interface{}
+		ExpectedRows int
+		ExpectedErr  string
+	}
+	var nilOrders *[]models.Order
+	var testCases = []renderCSVTestCase{
+		{"Nil", nil, 1, ""},
+		{"Nil pointer", nilOrders, 1, ""},
+		{"Order", models.Order{}, 2, ""},
+		{"Not an order", gin.H{"message": "hi"}, 0, "no CSV representation for gin.H"},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		err := renderCSV(c, http.StatusOK, tc.Obj)
+		if tc.ExpectedErr != "" {
+			assert.EqualError(t, err, tc.ExpectedErr, tc.Description)
+			continue
+		}
+		assert.NoError(t, err, tc.Description)
+		rows, _ := csv.NewReader(w.Body).ReadAll()
+		assert.EqualValues(t, tc.ExpectedRows, len(rows), tc.Description)
+		assert.EqualValues(t, csvHeader, rows[0], tc.Description)
+	}
+}
+
+func TestNegotiate_NotAcceptable(t *testing.T) {
+	w := negotiate("image/png", "/api/v1/orders/"+negotiationOrderId)
+
+	assert.EqualValues(t, http.StatusNotAcceptable, w.Code)
+}
+
+func TestBindOrder_ContentTypes(t *testing.T) {
+	type bindTestCase struct {
+		ContentType string
+		Body        string
+	}
+
+	var testCases = []bindTestCase{
+		{"application/json", `{"Products":[{"Name":"test-prod","Price":100}]}`},
+		{"application/xml", `<Order><Products><Product><Name>test-prod</Name><Price>100</Price></Product></Products></Order>`},
+		{"application/x-yaml", "Products:\n  - Name: test-prod\n    Price: 100\n"},
+		{"text/csv", "product_name,product_price\ntest-prod,100\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ContentType, func(t *testing.T) {
+			var got *models.Order
+			r := negotiationRouter()
+			mocks.CreateFunc = func(ctx context.Context, purchaseOrder interface{}) (*mongo.InsertOneResult, error) {
+				got = purchaseOrder.(*models.Order)
+				return &mongo.InsertOneResult{InsertedID: primitive.NewObjectID()}, nil
+			}
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/orders", strings.NewReader(tc.Body))
+			req.Header.Set("Content-Type", tc.ContentType)
+			r.ServeHTTP(w, req)
+
+			assert.EqualValues(t, http.StatusCreated, w.Code)
+			assert.NotNil(t, got)
+			assert.EqualValues(t, []models.Product{{Name: "test-prod", Price: 100}}, got.Products)
+		})
+	}
+}
+
+func TestBindOrder_MsgPack(t *testing.T) {
+	var body bytes.Buffer
+	_ = codec.NewEncoder(&body, msgpackHandle()).Encode(map[string]interface{}{
+		"Products": []interface{}{map[string]interface{}{"Name": "test-prod", "Price": 100}},
+	})
+	var got *models.Order
+	r := negotiationRouter()
+	mocks.CreateFunc = func(ctx context.Context, purchaseOrder interface{}) (*mongo.InsertOneResult, error) {
+		got = purchaseOrder.(*models.Order)
+		return &mongo.InsertOneResult{InsertedID: primitive.NewObjectID()}, nil
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/orders", &body)
+	req.Header.Set("Content-Type", "application/msgpack")
+	req.Header.Set("Accept", "application/msgpack")
+	r.ServeHTTP(w, req)
+
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.EqualValues(t, "application/msgpack", w.Header().Get("Content-Type"))
+	assert.EqualValues(t, []models.Product{{Name: "test-prod", Price: 100}}, got.Products)
+}
+
+func TestBindOrder_UnsupportedMediaType(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/orders", strings.NewReader("name=test"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	negotiationRouter().ServeHTTP(w, req)
+
+	assert.EqualValues(t, http.StatusUnsupportedMediaType, w.Code)
+}
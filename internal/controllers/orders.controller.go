@@ -1,51 +1,203 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/middleware"
 	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 const (
-	OrderIdPath = "id" // Request path variable
+	OrderIdPath = "id"     // Request path variable
+	FieldsQuery = "fields" // Query parameter to select the fields of an order to return
+	CountQuery  = "count"  // Query parameter to choose how X-Total-Count is computed
+
+	CountExact       = "exact"
+	CountEstimated   = "estimated"
+	TotalCountHeader = "X-Total-Count"
 )
 
 type OrdersController struct {
-	dataSvc db.OrdersDataService
+	dataSvc             db.OrdersDataService
+	upsertOnReplace     bool
+	exportFlushInterval time.Duration
+}
+
+// OrdersOption - Customizes the behaviour of OrdersController
+type OrdersOption func(*OrdersController)
+
+// WithUpsertOnReplace - Lets PUT /orders/:id create the order when it doesn't exist yet
+func WithUpsertOnReplace(upsert bool) OrdersOption {
+	return func(o *OrdersController) {
+		o.upsertOnReplace = upsert
+	}
 }
 
-func NewOrdersController(svc db.OrdersDataService) *OrdersController {
+func NewOrdersController(svc db.OrdersDataService, opts ...OrdersOption) *OrdersController {
 	ic := &OrdersController{
 		dataSvc: svc,
 	}
+	for _, opt := range opts {
+		opt(ic)
+	}
 	return ic
 }
 
+// Create  godoc
+// @Summary      Creates an order
+// @Description  Creates a new order and returns it along with its location. Orders sent with an id are still
+// @Description  replaced as before, which is deprecated in favor of PUT /orders/{id}.
+// @Tags         Fetch
+// @Accept       json,xml,application/x-yaml,application/msgpack,text/csv
+// @Produce      json,xml,application/x-yaml,application/msgpack,text/csv
+// @Param        Prefer  header    string  false  "return=minimal or return=representation"
+// @Success      201     {object}  models.Order
+// @Success      200     "order sent with an id, replaced"
+// @Header       201     {string}  Location     "Location of the order"
+// @Header       200     {string}  Deprecation  "true"
+// @Header       200     {string}  Link         "Route replacing the deprecated use"
+// @Failure      400     {string}  string  "bad request"
+// @Failure      406     {string}  string  "not acceptable"
+// @Failure      415     {string}  string  "unsupported media type"
+// @Router       /api/v1/orders [post]
+func (oHandler *OrdersController) Create(c *gin.Context) {
+	purchaseRequest := models.Order{}
+
+	if err := bindOrder(c, &purchaseRequest); err != nil {
+		abortBindError(c, err)
+		return
+	}
+
+	// Orders with an ID used to be updated through POST, keep serving them until clients move to PUT /orders/:id
+	if !purchaseRequest.ID.IsZero() {
+		middleware.MarkDeprecated(c, oHandler.location(c, purchaseRequest.ID.Hex()))
+		oHandler.upsert(c, &purchaseRequest)
+		return
+	}
+
+	result, err := oHandler.dataSvc.Create(c, &purchaseRequest)
+	if err != nil || result == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error occurred while creating order"})
+		c.Abort()
+		return
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		purchaseRequest.ID = id
+	}
+
+	c.Header("Location", oHandler.location(c, purchaseRequest.ID.Hex()))
+	if preferredReturn(c) == ReturnMinimal {
+		c.Status(http.StatusCreated)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	respond(c, http.StatusCreated, purchaseRequest)
+}
+
+// Replace  godoc
+// @Summary      Replaces an order
+// @Description  Replaces the whole order identified by the given id, creating it when allowed by configuration
+// @Tags         Fetch
+// @Accept       json,xml,application/x-yaml,application/msgpack,text/csv
+// @Produce      json,xml,application/x-yaml,application/msgpack,text/csv
+// @Param        id      path      string  true   "Order ID"
+// @Param        Prefer  header    string  false  "return=minimal or return=representation"
+// @Success      200     {object}  models.Order
+// @Success      201     {object}  models.Order
+// @Success      204
+// @Failure      400     {string}  string  "bad request"
+// @Failure      406     {string}  string  "not acceptable"
+// @Failure      415     {string}  string  "unsupported media type"
+// @Failure      404     {string}  string  "not found"
+// @Router       /api/v1/orders/{id} [put]
+func (oHandler *OrdersController) Replace(c *gin.Context) {
+	id := c.Param(OrderIdPath)
+	purchaseRequest := models.Order{}
+
+	if err := bindOrder(c, &purchaseRequest); err != nil {
+		abortBindError(c, err)
+		return
+	}
+	if !purchaseRequest.ID.IsZero() && purchaseRequest.ID.Hex() != id {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "order_id in body doesn't match the one in path"})
+		c.Abort()
+		return
+	}
+
+	created, err := oHandler.dataSvc.Replace(c, id, &purchaseRequest, oHandler.upsertOnReplace)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.InvalidOrderIdErr):
+			c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": err.Error()})
+		case errors.Is(err, db.OrderNotFoundErr):
+			c.JSON(http.StatusNotFound, gin.H{"message": "order not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error occurred while replacing order"})
+		}
+		c.Abort()
+		return
+	}
+
+	code := http.StatusOK
+	if created {
+		code = http.StatusCreated
+		c.Header("Location", oHandler.location(c, id))
+	}
+	if preferredReturn(c) == ReturnMinimal {
+		if !created {
+			code = http.StatusNoContent
+		}
+		c.Status(code)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	respond(c, code, purchaseRequest)
+}
+
 // Post  godoc
 // @Summary      Creates or Updates an order
-// @Description  Used to either create or update an order
+// @Description  Deprecated: use POST /orders to create and PUT /orders/{id} to replace an order
 // @Tags         Fetch
 // @Accept       json
 // @Produce      json
 // @Success      200
-// @Router       /orders/ [post]
+// @Header       200  {string}  Deprecation  "true"
+// @Header       200  {string}  Link         "Route replacing this one"
+// @Router       /api/v1/orders [put]
+// @Deprecated
 func (oHandler *OrdersController) Post(c *gin.Context) {
 	purchaseRequest := models.Order{}
 
-	if err := c.BindJSON(&purchaseRequest); err != nil {
-		c.AbortWithError(http.StatusBadRequest, err)
+	if err := bindOrder(c, &purchaseRequest); err != nil {
+		abortBindError(c, err)
 		return
 	}
 
+	oHandler.upsert(c, &purchaseRequest)
+}
+
+// upsert - Legacy create or update behaviour, decided by presence of an order id
+func (oHandler *OrdersController) upsert(c *gin.Context, purchaseRequest *models.Order) {
 	if purchaseRequest.ID.IsZero() {
-		if uid, _ := oHandler.dataSvc.Create(c, &purchaseRequest); uid != nil {
+		if uid, _ := oHandler.dataSvc.Create(c, purchaseRequest); uid != nil {
 			c.JSON(http.StatusOK, uid)
 			return
 		}
 	} else {
-		if updatedCount, _ := oHandler.dataSvc.Update(c, &purchaseRequest); updatedCount != 0 {
+		updatedCount, err := oHandler.dataSvc.Update(c, purchaseRequest)
+		if errors.Is(err, db.OrderNotFoundErr) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "order not found"})
+			return
+		}
+		if updatedCount != 0 {
 			c.JSON(http.StatusOK, updatedCount)
 			return
 		}
@@ -54,22 +206,70 @@ func (oHandler *OrdersController) Post(c *gin.Context) {
 	c.JSON(http.StatusInternalServerError, "Unexpected Error occurred")
 }
 
+// requestedFields - Fields listed in the 'fields' query parameter, none means all
+func requestedFields(c *gin.Context) []string {
+	var fields []string
+	for _, f := range strings.Split(c.Query(FieldsQuery), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// location - URL of the order with the given id, relative to the orders collection being requested
+func (oHandler *OrdersController) location(c *gin.Context, id string) string {
+	collection := strings.TrimSuffix(c.Request.URL.Path, "/")
+	if c.Param(OrderIdPath) != "" {
+		collection = path.Dir(collection)
+	}
+	return collection + "/" + id
+}
+
 // GetAll  godoc
 // @Summary      Fetch all orders
 // @Description  Fetches all orders
 // @Tags         Fetch
 // @Accept       json
-// @Produce      json
+// @Produce      json,xml,application/x-yaml,application/msgpack,text/csv
+// @Param        fields             query   string  false  "Comma separated fields to return e.g. order_id,products.name"
+// @Param        count              query   string  false  "How X-Total-Count is computed: exact or estimated (default)"
+// @Param        If-None-Match      header  string  false  "ETag of the cached copy"
 // @Success      200
-// @Router       /orders/ [get]
+// @Success      304
+// @Failure      406            {string}  string  "not acceptable"
+// @Header       200  {integer}  X-Total-Count  "Total number of orders"
+// @Router       /api/v1/orders [get]
+// @Router       /api/v1/orders [head]
 func (oHandler *OrdersController) GetAll(c *gin.Context) {
-	orders, err := oHandler.dataSvc.GetAll(c)
+	countMode := c.DefaultQuery(CountQuery, CountEstimated)
+	if countMode != CountExact && countMode != CountEstimated {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": "count must be 'exact' or 'estimated'"})
+		c.Abort()
+		return
+	}
+
+	orders, err := oHandler.dataSvc.GetAll(c, requestedFields(c)...)
+	if errors.Is(err, db.InvalidFieldErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": err.Error()})
+		c.Abort()
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error occurred while retrieved purchase orders", "error": err})
 		c.Abort()
 		return
 	}
-	c.JSON(http.StatusOK, orders)
+	total, err := oHandler.dataSvc.Count(c, countMode == CountExact)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error occurred while counting purchase orders"})
+		c.Abort()
+		return
+	}
+	// No Last-Modified, as deleted orders or those stored with an older update time don't move it forward. The ETag
+	// covers the total as well.
+	c.Header(TotalCountHeader, strconv.FormatInt(total, 10))
+	respond(c, http.StatusOK, orders)
 }
 
 // GetById  godoc
@@ -78,20 +278,43 @@ func (oHandler *OrdersController) GetAll(c *gin.Context) {
 // @Param        id   path      string  true  "Order ID"
 // @Tags         Fetch
 // @Accept       json
-// @Produce      json
+// @Produce      json,xml,application/x-yaml,application/msgpack,text/csv
+// @Param        fields             query   string  false  "Comma separated fields to return e.g. order_id,products.name"
+// @Param        If-None-Match      header  string  false  "ETag of the cached copy"
+// @Param        If-Modified-Since  header  string  false  "Last-Modified of the cached copy"
 // @Success      200
+// @Success      304
+// @Failure      400            {string}  string  "bad request"
+// @Failure      404            {string}  string  "not found"
+// @Failure      406            {string}  string  "not acceptable"
 // @Failure      500            {string}  string  "bad request"
-// @Router       /orders/{id} [get]
+// @Router       /api/v1/orders/{id} [get]
+// @Router       /api/v1/orders/{id} [head]
 func (oHandler *OrdersController) GetById(c *gin.Context) {
 	id := c.Param(OrderIdPath)
 	if id != "" {
-		order, err := oHandler.dataSvc.GetById(c, id)
+		order, err := oHandler.dataSvc.GetById(c, id, requestedFields(c)...)
+		if errors.Is(err, db.InvalidFieldErr) || errors.Is(err, db.InvalidOrderIdErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": err.Error()})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error to retrieve order details", "error": err.Error()})
 			c.Abort()
 			return
 		}
-		c.JSON(http.StatusOK, order)
+		// Orders the caller can't see don't exist as far as they are concerned
+		o, ok := order.(*models.Order)
+		if order == nil || (ok && o == nil) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "order not found"})
+			c.Abort()
+			return
+		}
+		if ok {
+			SetLastModified(c, lastUpdated(*o))
+		}
+		respond(c, http.StatusOK, order)
 		return
 	}
 	c.JSON(http.StatusBadRequest, gin.H{"message": "bad request"})
@@ -106,17 +329,30 @@ func (oHandler *OrdersController) GetById(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Success      200
+// @Failure      400            {string}  string  "bad request"
+// @Failure      404            {string}  string  "not found"
 // @Failure      500            {string}  string  "bad request"
-// @Router       /orders/{id} [delete]
+// @Router       /api/v1/orders/{id} [delete]
 func (oHandler *OrdersController) DeleteById(c *gin.Context) {
 	id := c.Param(OrderIdPath)
 	if id != "" {
 		count, err := oHandler.dataSvc.DeleteById(c, id)
+		if errors.Is(err, db.InvalidOrderIdErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": err.Error()})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error to retrieve order details", "error": err.Error()})
 			c.Abort()
 			return
 		}
+		// Orders the caller can't see don't exist as far as they are concerned
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"message": "order not found"})
+			c.Abort()
+			return
+		}
 		c.JSON(http.StatusOK, count)
 		return
 	}
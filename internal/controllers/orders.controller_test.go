@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
 	"github.com/rameshsunkara/go-rest-api-example/internal/mocks"
 	"github.com/rameshsunkara/go-rest-api-example/internal/models"
 	"github.com/stretchr/testify/assert"
@@ -71,25 +73,60 @@ func TestCreateOrderSuccess(t *testing.T) {
 	})
 	body := bytes.NewReader(order)
 	c.Request, _ = http.NewRequest("POST", "/api/v1/orders", body)
+	mocks.CreateFunc = func(ctx context.Context, order interface{}) (*mongo.InsertOneResult, error) {
+		id, _ := primitive.ObjectIDFromHex("629fd50cb1e95cbe7ac12aae")
+		return &mongo.InsertOneResult{InsertedID: id}, nil
+	}
+
+	// Call actual function
+	o := NewOrdersController(&mocks.MockOrdersDataService{})
+	o.Create(c)
+
+	// Check results
+	resp := w.Result()
+	respBody, _ := io.ReadAll(resp.Body)
+	respOrder, _ := UnMarshalOrderResponse(respBody)
+	assert.EqualValues(t, http.StatusCreated, resp.StatusCode)
+	assert.EqualValues(t, "/api/v1/orders/629fd50cb1e95cbe7ac12aae", resp.Header.Get("Location"))
+	assert.EqualValues(t, "629fd50cb1e95cbe7ac12aae", respOrder.ID.Hex())
+	assert.EqualValues(t, "test-prod", respOrder.Products[0].Name)
+}
+
+func TestCreateOrderSuccess_PreferMinimal(t *testing.T) {
+	// Test Setup
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	order, _ := json.Marshal(models.Order{
+		Products: []models.Product{{
+			Name:  "test-prod",
+			Price: 100,
+		}},
+	})
+	body := bytes.NewReader(order)
+	c.Request, _ = http.NewRequest("POST", "/api/v1/orders", body)
+	c.Request.Header.Set("Prefer", "return=minimal")
 	mocks.CreateFunc = func(ctx context.Context, order interface{}) (*mongo.InsertOneResult, error) {
 		data, err := ioutil.ReadFile("../../mockdata/createOrder.json")
 		if err != nil {
 			return nil, err
 		}
 		d, _ := UnMarshalCreateOrderResponse(data)
+		d.InsertedID, _ = primitive.ObjectIDFromHex(d.InsertedID.(string))
 		return d, nil
 	}
 
 	// Call actual function
 	o := NewOrdersController(&mocks.MockOrdersDataService{})
-	o.Post(c)
+	o.Create(c)
 
 	// Check results
 	resp := w.Result()
 	respBody, _ := io.ReadAll(resp.Body)
-	respOrder, _ := UnMarshalCreateOrderResponse(respBody)
-	assert.EqualValues(t, http.StatusOK, resp.StatusCode)
-	assert.EqualValues(t, respOrder.InsertedID, "629fd50cb1e95cbe7ac12aae")
+	assert.EqualValues(t, http.StatusCreated, resp.StatusCode)
+	assert.EqualValues(t, "/api/v1/orders/629fd50cb1e95cbe7ac12aae", resp.Header.Get("Location"))
+	assert.EqualValues(t, "return=minimal", resp.Header.Get("Preference-Applied"))
+	assert.Empty(t, respBody)
 }
 
 func TestCreateOrderFailure_DBError(t *testing.T) {
@@ -111,7 +148,7 @@ func TestCreateOrderFailure_DBError(t *testing.T) {
 
 	// Call actual function
 	o := NewOrdersController(&mocks.MockOrdersDataService{})
-	o.Post(c)
+	o.Create(c)
 
 	// Check results
 	resp := w.Result()
@@ -132,14 +169,14 @@ func TestCreateOrderFailure_BadRequest(t *testing.T) {
 
 	// Call actual function
 	o := NewOrdersController(&mocks.MockOrdersDataService{})
-	o.Post(c)
+	o.Create(c)
 
 	// Check results
 	resp := w.Result()
 	assert.EqualValues(t, http.StatusBadRequest, resp.StatusCode)
 }
 
-func TestUpdateOrderSuccess(t *testing.T) {
+func TestUpdateOrderSuccess_Deprecated(t *testing.T) {
 	// Test Setup
 	gin.SetMode(gin.TestMode)
 	w := httptest.NewRecorder()
@@ -158,6 +195,39 @@ func TestUpdateOrderSuccess(t *testing.T) {
 		return 1, nil
 	}
 
+	// Call actual function
+	o := NewOrdersController(&mocks.MockOrdersDataService{})
+	o.Create(c)
+
+	// Check results
+	resp := w.Result()
+	respBody, _ := io.ReadAll(resp.Body)
+	result, _ := strconv.Atoi(string(respBody))
+	assert.EqualValues(t, http.StatusOK, resp.StatusCode)
+	assert.EqualValues(t, 1, result)
+	assert.EqualValues(t, "true", resp.Header.Get("Deprecation"))
+	assert.Contains(t, resp.Header.Get("Link"), "/api/v1/orders/629fd50cb1e95cbe7ac12aae")
+}
+
+func TestLegacyPostSuccess(t *testing.T) {
+	// Test Setup
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	id, _ := primitive.ObjectIDFromHex("629fd50cb1e95cbe7ac12aae")
+	order, _ := json.Marshal(models.Order{
+		ID: id,
+		Products: []models.Product{{
+			Name:  "test-prod",
+			Price: 100,
+		}},
+	})
+	body := bytes.NewReader(order)
+	c.Request, _ = http.NewRequest("PUT", "/api/v1/orders", body)
+	mocks.UpdateFunc = func(ctx context.Context, order interface{}) (int64, error) {
+		return 1, nil
+	}
+
 	// Call actual function
 	o := NewOrdersController(&mocks.MockOrdersDataService{})
 	o.Post(c)
@@ -170,12 +240,115 @@ func TestUpdateOrderSuccess(t *testing.T) {
 	assert.EqualValues(t, 1, result)
 }
 
+func TestReplaceOrderSuccess(t *testing.T) {
+	type replaceTestCase struct {
+		Description  string
+		Prefer       string
+		Created      bool
+		ExpectedCode int
+		ExpectBody   bool
+	}
+
+	var testCases = []replaceTestCase{
+		{"replace existing order", "", false, http.StatusOK, true},
+		{"create missing order", "", true, http.StatusCreated, true},
+		{"replace existing order, minimal response", "return=minimal", false, http.StatusNoContent, false},
+		{"create missing order, minimal response", "return=minimal", true, http.StatusCreated, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			// Test Setup
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			const id = "629fd50cb1e95cbe7ac12aae"
+			c.Params = []gin.Param{{Key: "id", Value: id}}
+			order, _ := json.Marshal(models.Order{
+				Products: []models.Product{{
+					Name:  "test-prod",
+					Price: 100,
+				}},
+			})
+			c.Request, _ = http.NewRequest("PUT", "/api/v1/orders/"+id, bytes.NewReader(order))
+			if tc.Prefer != "" {
+				c.Request.Header.Set("Prefer", tc.Prefer)
+			}
+			var gotUpsert bool
+			mocks.ReplaceFunc = func(ctx context.Context, id string, order interface{}, upsert bool) (bool, error) {
+				gotUpsert = upsert
+				order.(*models.Order).ID, _ = primitive.ObjectIDFromHex(id)
+				return tc.Created, nil
+			}
+
+			// Call actual function
+			o := NewOrdersController(&mocks.MockOrdersDataService{}, WithUpsertOnReplace(true))
+			o.Replace(c)
+
+			// Check results
+			resp := w.Result()
+			respBody, _ := io.ReadAll(resp.Body)
+			assert.True(t, gotUpsert)
+			assert.EqualValues(t, tc.ExpectedCode, resp.StatusCode)
+			if tc.Created {
+				assert.EqualValues(t, "/api/v1/orders/"+id, resp.Header.Get("Location"))
+			}
+			if tc.ExpectBody {
+				respOrder, _ := UnMarshalOrderResponse(respBody)
+				assert.EqualValues(t, id, respOrder.ID.Hex())
+			} else {
+				assert.Empty(t, respBody)
+			}
+		})
+	}
+}
+
+func TestReplaceOrderFailure(t *testing.T) {
+	type replaceFailureTestCase struct {
+		Description  string
+		BodyID       string
+		RepoErr      error
+		ExpectedCode int
+	}
+
+	var testCases = []replaceFailureTestCase{
+		{"order doesn't exist", "", db.OrderNotFoundErr, http.StatusNotFound},
+		{"invalid order id", "", db.InvalidOrderIdErr, http.StatusBadRequest},
+		{"db error", "", errors.New("db error"), http.StatusInternalServerError},
+		{"order id in body differs from path", "629536b3fac02728de50c042", nil, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			// Test Setup
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			const id = "629fd50cb1e95cbe7ac12aae"
+			c.Params = []gin.Param{{Key: "id", Value: id}}
+			bodyID, _ := primitive.ObjectIDFromHex(tc.BodyID)
+			order, _ := json.Marshal(models.Order{ID: bodyID})
+			c.Request, _ = http.NewRequest("PUT", "/api/v1/orders/"+id, bytes.NewReader(order))
+			mocks.ReplaceFunc = func(ctx context.Context, id string, order interface{}, upsert bool) (bool, error) {
+				return false, tc.RepoErr
+			}
+
+			// Call actual function
+			o := NewOrdersController(&mocks.MockOrdersDataService{})
+			o.Replace(c)
+
+			// Check results
+			assert.EqualValues(t, tc.ExpectedCode, w.Result().StatusCode)
+		})
+	}
+}
+
 func TestGetAllOrdersSuccess(t *testing.T) {
 	// Test Setup
 	gin.SetMode(gin.TestMode)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	mocks.GetAllFunc = func(ctx context.Context) (interface{}, error) {
+	mocks.GetAllFunc = func(ctx context.Context, fields ...string) (interface{}, error) {
 		data, err := os.ReadFile("../../mockdata/allOrders.json")
 		if err != nil {
 			return nil, err
@@ -183,6 +356,11 @@ func TestGetAllOrdersSuccess(t *testing.T) {
 		d, _ := UnMarshalOrdersResponse(data)
 		return d, nil
 	}
+	var gotExact bool
+	mocks.CountFunc = func(ctx context.Context, exact bool) (int64, error) {
+		gotExact = exact
+		return 500, nil
+	}
 
 	// Call actual function
 	o := NewOrdersController(&mocks.MockOrdersDataService{})
@@ -194,6 +372,97 @@ func TestGetAllOrdersSuccess(t *testing.T) {
 	orders, _ := UnMarshalOrdersResponse(body)
 	assert.EqualValues(t, http.StatusOK, resp.StatusCode)
 	assert.EqualValues(t, len(*orders), 100)
+	assert.EqualValues(t, "500", resp.Header.Get("X-Total-Count"))
+	assert.False(t, gotExact)
+}
+
+func TestGetAllOrdersSuccess_ExactCount(t *testing.T) {
+	// Test Setup
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/v1/orders?count=exact", nil)
+	mocks.GetAllFunc = func(ctx context.Context, fields ...string) (interface{}, error) {
+		return &[]models.Order{}, nil
+	}
+	var gotExact bool
+	mocks.CountFunc = func(ctx context.Context, exact bool) (int64, error) {
+		gotExact = exact
+		return 42, nil
+	}
+
+	// Call actual function
+	o := NewOrdersController(&mocks.MockOrdersDataService{})
+	o.GetAll(c)
+
+	// Check results
+	resp := w.Result()
+	assert.EqualValues(t, http.StatusOK, resp.StatusCode)
+	assert.EqualValues(t, "42", resp.Header.Get("X-Total-Count"))
+	assert.True(t, gotExact)
+}
+
+func TestGetAllOrdersFailure_InvalidCount(t *testing.T) {
+	// Test Setup
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/v1/orders?count=approximate", nil)
+
+	// Call actual function
+	o := NewOrdersController(&mocks.MockOrdersDataService{})
+	o.GetAll(c)
+
+	// Check results
+	resp := w.Result()
+	assert.EqualValues(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestGetAllOrdersSuccess_Fields(t *testing.T) {
+	// Test Setup
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/v1/orders?fields=order_id,+products.name,", nil)
+	var gotFields []string
+	mocks.GetAllFunc = func(ctx context.Context, fields ...string) (interface{}, error) {
+		gotFields = fields
+		id, _ := primitive.ObjectIDFromHex("629536b3fac02728de50c042")
+		return &[]models.Order{{ID: id, Products: []models.Product{{Name: "test-prod"}}}}, nil
+	}
+	mocks.CountFunc = func(ctx context.Context, exact bool) (int64, error) {
+		return 1, nil
+	}
+
+	// Call actual function
+	o := NewOrdersController(&mocks.MockOrdersDataService{})
+	o.GetAll(c)
+
+	// Check results
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+	assert.EqualValues(t, http.StatusOK, resp.StatusCode)
+	assert.EqualValues(t, []string{"order_id", "products.name"}, gotFields)
+	assert.JSONEq(t, `[{"order_id":"629536b3fac02728de50c042","Products":[{"Name":"test-prod"}]}]`, string(body))
+}
+
+func TestGetAllOrdersFailure_InvalidField(t *testing.T) {
+	// Test Setup
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/v1/orders?fields=customer", nil)
+	mocks.GetAllFunc = func(ctx context.Context, fields ...string) (interface{}, error) {
+		return nil, fmt.Errorf("%w: %s", db.InvalidFieldErr, fields[0])
+	}
+
+	// Call actual function
+	o := NewOrdersController(&mocks.MockOrdersDataService{})
+	o.GetAll(c)
+
+	// Check results
+	resp := w.Result()
+	assert.EqualValues(t, http.StatusBadRequest, resp.StatusCode)
 }
 
 func TestGetAllOrdersFailure_DBRead(t *testing.T) {
@@ -201,7 +470,7 @@ func TestGetAllOrdersFailure_DBRead(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	mocks.GetAllFunc = func(ctx context.Context) (interface{}, error) {
+	mocks.GetAllFunc = func(ctx context.Context, fields ...string) (interface{}, error) {
 		_, err := os.ReadFile("../../mockdata/non-existing.json")
 		return nil, err
 	}
@@ -222,7 +491,7 @@ func TestGetOrderSuccess(t *testing.T) {
 	c, _ := gin.CreateTestContext(w)
 	const id = "629536b3fac02728de50c042"
 	c.Params = []gin.Param{{Key: "id", Value: id}}
-	mocks.GetByIdFunc = func(ctx context.Context, id string) (interface{}, error) {
+	mocks.GetByIdFunc = func(ctx context.Context, id string, fields ...string) (interface{}, error) {
 		data, err := os.ReadFile("../../mockdata/order.json")
 		if err != nil {
 			return nil, err
@@ -250,7 +519,7 @@ func TestGetOrderFailure_InvalidId(t *testing.T) {
 	c, _ := gin.CreateTestContext(w)
 	const id = ""
 	c.Params = []gin.Param{{Key: "id", Value: id}}
-	mocks.GetByIdFunc = func(ctx context.Context, id string) (interface{}, error) {
+	mocks.GetByIdFunc = func(ctx context.Context, id string, fields ...string) (interface{}, error) {
 		data, err := os.ReadFile("../../mockdata/order.json")
 		if err != nil {
 			return nil, err
@@ -268,6 +537,25 @@ func TestGetOrderFailure_InvalidId(t *testing.T) {
 	assert.EqualValues(t, http.StatusBadRequest, resp.StatusCode)
 }
 
+func TestGetOrderFailure_MalformedId(t *testing.T) {
+	// Test Setup
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = []gin.Param{{Key: "id", Value: "not-an-id"}}
+	mocks.GetByIdFunc = func(ctx context.Context, id string, fields ...string) (interface{}, error) {
+		return nil, db.InvalidOrderIdErr
+	}
+
+	// Call actual function
+	o := NewOrdersController(&mocks.MockOrdersDataService{})
+	o.GetById(c)
+
+	// Check results
+	resp := w.Result()
+	assert.EqualValues(t, http.StatusBadRequest, resp.StatusCode)
+}
+
 func TestGetOrderFailure_DBRead(t *testing.T) {
 	// Test Setup
 	gin.SetMode(gin.TestMode)
@@ -275,7 +563,7 @@ func TestGetOrderFailure_DBRead(t *testing.T) {
 	c, _ := gin.CreateTestContext(w)
 	const id = "629536b3fac02728de50c042"
 	c.Params = []gin.Param{{Key: "id", Value: id}}
-	mocks.GetByIdFunc = func(ctx context.Context, id string) (interface{}, error) {
+	mocks.GetByIdFunc = func(ctx context.Context, id string, fields ...string) (interface{}, error) {
 		_, err := os.ReadFile("../../mockdata/nan.json")
 		return nil, err
 	}
@@ -289,6 +577,50 @@ func TestGetOrderFailure_DBRead(t *testing.T) {
 	assert.EqualValues(t, http.StatusInternalServerError, resp.StatusCode)
 }
 
+func TestGetOrderFailure_NotFound(t *testing.T) {
+	const id = "629536b3fac02728de50c042"
+	mocks.GetByIdFunc = func(ctx context.Context, orderId string, fields ...string) (interface{}, error) {
+		// Only the owner sees the order, as the repository filters it
+		if p := models.PrincipalFromContext(ctx); orderId != id || p == nil || p.Subject != "owner" {
+			return nil, nil
+		}
+		return &models.Order{ID: primitive.NewObjectID()}, nil
+	}
+
+	type notFoundTestCase struct {
+		Description    string
+		Method         string
+		Id             string
+		Subject        string
+		ExpectedStatus int
+	}
+	var testCases = []notFoundTestCase{
+		{"Owned by the caller", http.MethodGet, id, "owner", http.StatusOK},
+		{"Missing", http.MethodGet, "629536b3fac02728de50c043", "owner", http.StatusNotFound},
+		{"Missing, HEAD", http.MethodHead, "629536b3fac02728de50c043", "owner", http.StatusNotFound},
+		{"Owned by another", http.MethodGet, id, "other", http.StatusNotFound},
+		{"Owned by another, HEAD", http.MethodHead, id, "other", http.StatusNotFound},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(tc.Method, "/api/v1/orders/"+tc.Id, nil)
+		c.Set(models.PrincipalKey, &models.Principal{Subject: tc.Subject})
+		c.Params = []gin.Param{{Key: "id", Value: tc.Id}}
+
+		o := NewOrdersController(&mocks.MockOrdersDataService{})
+		o.GetById(c)
+
+		resp := w.Result()
+		assert.EqualValues(t, tc.ExpectedStatus, resp.StatusCode, tc.Description)
+		if tc.ExpectedStatus == http.StatusNotFound {
+			assert.Empty(t, resp.Header.Get("ETag"), tc.Description)
+		}
+	}
+}
+
 func TestDeleteOrderSuccess(t *testing.T) {
 	// Test Setup
 	gin.SetMode(gin.TestMode)
@@ -312,6 +644,45 @@ func TestDeleteOrderSuccess(t *testing.T) {
 	assert.EqualValues(t, result, 1)
 }
 
+func TestDeleteOrderFailure_NotFound(t *testing.T) {
+	// Test Setup
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	const id = "629536b3fac02728de50c042"
+	c.Params = []gin.Param{{Key: "id", Value: id}}
+	mocks.DeleteByIdFunc = func(ctx context.Context, id string) (int64, error) {
+		return 0, nil
+	}
+
+	// Call actual function
+	o := NewOrdersController(&mocks.MockOrdersDataService{})
+	o.DeleteById(c)
+
+	// Check results
+	resp := w.Result()
+	assert.EqualValues(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestDeleteOrderFailure_MalformedId(t *testing.T) {
+	// Test Setup
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = []gin.Param{{Key: "id", Value: "not-an-id"}}
+	mocks.DeleteByIdFunc = func(ctx context.Context, id string) (int64, error) {
+		return 0, db.InvalidOrderIdErr
+	}
+
+	// Call actual function
+	o := NewOrdersController(&mocks.MockOrdersDataService{})
+	o.DeleteById(c)
+
+	// Check results
+	resp := w.Result()
+	assert.EqualValues(t, http.StatusBadRequest, resp.StatusCode)
+}
+
 func TestDeleteOrderFailure_DBError(t *testing.T) {
 	// Test Setup
 	gin.SetMode(gin.TestMode)
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PreferHeader            = "Prefer"
+	PreferenceAppliedHeader = "Preference-Applied"
+
+	ReturnMinimal        = "minimal"
+	ReturnRepresentation = "representation"
+)
+
+// preferredReturn - Reads the 'return' preference (RFC 7240) of the request, defaulting to a full representation
+func preferredReturn(c *gin.Context) string {
+	for _, header := range c.Request.Header.Values(PreferHeader) {
+		for _, pref := range strings.Split(header, ",") {
+			// Parameters of a preference (';' separated) do not matter for 'return'
+			token := strings.TrimSpace(strings.SplitN(pref, ";", 2)[0])
+			name, value, found := strings.Cut(token, "=")
+			if !found || !strings.EqualFold(strings.TrimSpace(name), "return") {
+				continue
+			}
+			value = strings.ToLower(strings.Trim(strings.TrimSpace(value), "\""))
+			if value == ReturnMinimal || value == ReturnRepresentation {
+				c.Header(PreferenceAppliedHeader, "return="+value)
+				return value
+			}
+		}
+	}
+	return ReturnRepresentation
+}
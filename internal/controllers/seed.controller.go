@@ -1,62 +1,314 @@
 package controllers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/jobs"
 	"github.com/rameshsunkara/go-rest-api-example/internal/models"
 
 	"github.com/bxcodec/faker/v3"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const (
-	SeedRecordCount = 500
+	SeedJobType        = "seed"
+	SeedBatchSize      = 500
+	DefaultFixturesDir = "mockdata"
 )
 
+// fakerMu - faker only has a package level random source, seeding it is what makes the generated data reproducible
+var fakerMu sync.Mutex
+
 type SeedController struct {
-	dataSvc db.OrdersDataService
+	dataSvc     db.OrdersDataService
+	runner      *jobs.Runner
+	fixturesDir string
 }
 
-func NewSeedController(svc db.OrdersDataService) *SeedController {
+type SeedOption func(*SeedController)
+
+// WithFixturesDir - Directory of the fixture files that can be loaded, 'mockdata' by default
+func WithFixturesDir(dir string) SeedOption {
+	return func(s *SeedController) {
+		if dir != "" {
+			s.fixturesDir = dir
+		}
+	}
+}
+
+func NewSeedController(svc db.OrdersDataService, runner *jobs.Runner, opts ...SeedOption) *SeedController {
 	ic := &SeedController{
-		dataSvc: svc,
+		dataSvc:     svc,
+		runner:      runner,
+		fixturesDir: DefaultFixturesDir,
+	}
+	for _, opt := range opts {
+		opt(ic)
 	}
+	runner.Register(SeedJobType, ic.Seed)
 	return ic
 }
 
+// SeedDB  godoc
+// @Summary      Seed the DB with fake orders
+// @Description  Starts a job generating orders, or loading them from a fixture file, its progress is available at the
+// @Description  returned location. Every param is optional, the seed used is part of the job so the same orders can be
+// @Description  generated again.
+// @Tags         Seed
+// @Accept       json
+// @Produce      json
+// @Param        params  body      models.SeedParams  false  "What to generate"
+// @Success      202     {object}  models.Job
+// @Failure      400     {string}  string  "bad request"
+// @Router       /seedDB [post]
 func (s *SeedController) SeedDB(c *gin.Context) {
-	for i := 0; i < SeedRecordCount; i++ {
-		product := []models.Product{
-			{
-				Name:      faker.Name(),
-				Price:     (uint)(rand.Intn(90) + 10),
-				Remarks:   faker.Sentence(),
-				UpdatedAt: faker.TimeString(),
-			},
-			{
-				Name:      faker.Name(),
-				Price:     (uint)(rand.Intn(1000) + 10),
-				Remarks:   faker.Sentence(),
-				UpdatedAt: faker.TimeString(),
-			},
+	var params models.SeedParams
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		if err := c.ShouldBindJSON(&params); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": err.Error()})
+			c.Abort()
+			return
 		}
+	}
+	params.ApplyDefaults(time.Now())
+	if err := params.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "bad request", "error": err.Error()})
+		c.Abort()
+		return
+	}
 
-		po := &models.Order{
-			Products: product,
+	job, err := s.runner.Submit(c, SeedJobType, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Unable to start seeding",
+			"error":   err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	Accepted(c, job)
+}
+
+// WipeSeedDB  godoc
+// @Summary      Delete the seeded orders
+// @Description  Deletes every order inserted by seeding, orders created through the API are kept
+// @Tags         Seed
+// @Produce      json
+// @Success      200
+// @Failure      500  {string}  string  "error"
+// @Router       /seedDB [delete]
+func (s *SeedController) WipeSeedDB(c *gin.Context) {
+	count, err := s.dataSvc.DeleteSeeded(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to delete seeded data", "error": err.Error()})
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Successfully deleted seeded data",
+		"Count":   count,
+	})
+}
+
+// Seed - Job inserting fake orders, in batches
+func (s *SeedController) Seed(ctx context.Context, job *models.Job, progress jobs.Progress) (map[string]interface{}, error) {
+	var params models.SeedParams
+	if err := job.DecodeParams(&params); err != nil {
+		return nil, err
+	}
+	// Jobs queued without params get the defaults when they run
+	params.ApplyDefaults(job.CreatedAt)
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if params.Fixture != "" {
+		return s.seedFixture(ctx, params.Fixture, progress)
+	}
+
+	// Each batch is generated from its own seed, drawn in sequence, so a job that was interrupted skips the batches
+	// it reported as done. Batches inserted after the last reported progress are generated again with the same ids,
+	// and skipped as duplicates, as are orders of another job seeded the same way.
+	seed := int64(*params.Seed)
+	rng := rand.New(rand.NewSource(seed))
+	inserted := job.Progress.Done - job.Progress.Done%SeedBatchSize
+	for i := 0; i < inserted; i += SeedBatchSize {
+		rng.Int63()
+	}
+	for inserted < params.Count {
+		n := params.Count - inserted
+		if n > SeedBatchSize {
+			n = SeedBatchSize
+		}
+		orders := generateOrders(rng.Int63(), n, &params)
+		for i, o := range orders {
+			o.ID = seedOrderID(seed, inserted+i, lastUpdated(*o))
+		}
+		res, err := s.dataSvc.CreateMany(ctx, orders)
+		var bulkErr mongo.BulkWriteException
+		if errors.As(err, &bulkErr) && onlyDuplicates(bulkErr) {
+			err = nil
 		}
-		_, err := s.dataSvc.Create(c, po)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"message": "Unable inserted data",
-			})
-			panic("Unable to insert data")
+			if res != nil {
+				inserted += len(res.InsertedIDs)
+			}
+			return map[string]interface{}{"count": inserted, "seed": *params.Seed}, err
+		}
+		inserted += n
+		if err := progress(inserted, params.Count); err != nil {
+			return map[string]interface{}{"count": inserted, "seed": *params.Seed}, err
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Successfully inserted fake data",
-		"Count":   SeedRecordCount,
-	})
+	return map[string]interface{}{"count": inserted, "seed": *params.Seed}, nil
+}
+
+// seedFixture - Inserts the orders of a fixture file, holding either an order or a list of orders. Orders that are
+// invalid or already exist are skipped.
+func (s *SeedController) seedFixture(ctx context.Context, name string, progress jobs.Progress) (map[string]interface{}, error) {
+	raw, err := os.ReadFile(filepath.Join(s.fixturesDir, name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read fixture %q: %w", name, err)
+	}
+	var orders []*models.Order
+	if err := json.Unmarshal(raw, &orders); err != nil {
+		var order models.Order
+		if err := json.Unmarshal(raw, &order); err != nil {
+			return nil, fmt.Errorf("fixture %q holds no orders: %w", name, err)
+		}
+		orders = []*models.Order{&order}
+	}
+
+	valid := orders[:0]
+	for _, o := range orders {
+		if o.Validate() == nil {
+			o.Seeded = true
+			valid = append(valid, o)
+		}
+	}
+	skipped := len(orders) - len(valid)
+
+	inserted := 0
+	for start := 0; start < len(valid); start += SeedBatchSize {
+		end := start + SeedBatchSize
+		if end > len(valid) {
+			end = len(valid)
+		}
+		res, err := s.dataSvc.CreateMany(ctx, valid[start:end])
+		var bulkErr mongo.BulkWriteException
+		if errors.As(err, &bulkErr) && onlyDuplicates(bulkErr) {
+			skipped += len(bulkErr.WriteErrors)
+			err = nil
+		}
+		if res != nil {
+			inserted += len(res.InsertedIDs)
+		}
+		result := map[string]interface{}{"count": inserted, "skipped": skipped, "fixture": name}
+		if err != nil {
+			return result, err
+		}
+		if err := progress(end, len(valid)); err != nil {
+			return result, err
+		}
+	}
+	return map[string]interface{}{"count": inserted, "skipped": skipped, "fixture": name}, nil
+}
+
+func onlyDuplicates(bulkErr mongo.BulkWriteException) bool {
+	if bulkErr.WriteConcernError != nil {
+		return false
+	}
+	for _, we := range bulkErr.WriteErrors {
+		if !mongo.IsDuplicateKeyError(we) {
+			return false
+		}
+	}
+	return true
+}
+
+// seedOrderID - Id of the i-th order generated from seed, the same every time it's generated. Starts with the time
+// the order was last updated, as ids of orders created then do.
+func seedOrderID(seed int64, i int, updated time.Time) primitive.ObjectID {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(seed))
+	binary.BigEndian.PutUint64(key[8:], uint64(i))
+	sum := sha256.Sum256(key)
+
+	var id primitive.ObjectID
+	binary.BigEndian.PutUint32(id[:4], uint32(updated.Unix()))
+	copy(id[4:], sum[:8])
+	return id
+}
+
+// generateOrders - n fake orders, always the same ones for a given seed and params
+func generateOrders(seed int64, n int, p *models.SeedParams) []*models.Order {
+	fakerMu.Lock()
+	defer fakerMu.Unlock()
+	faker.SetRandomSource(faker.NewSafeSource(rand.NewSource(seed)))
+	rng := rand.New(rand.NewSource(seed))
+
+	pick := statusPicker(p.Statuses)
+	span := int64(p.To.Sub(p.From))
+	orders := make([]*models.Order, n)
+	for i := range orders {
+		updated := p.From.Add(time.Duration(rng.Int63n(span)))
+		products := make([]models.Product, p.ProductsPerOrder.Min+rng.Intn(p.ProductsPerOrder.Max-p.ProductsPerOrder.Min+1))
+		for j := range products {
+			products[j] = models.Product{
+				Name:      faker.Name(),
+				Price:     (uint)(rng.Intn(1000) + 10),
+				Remarks:   faker.Sentence(),
+				Status:    pick(rng),
+				UpdatedAt: p.From.Add(time.Duration(rng.Int63n(int64(updated.Sub(p.From)) + 1))).Format(time.RFC3339),
+			}
+		}
+		orders[i] = &models.Order{
+			LastUpdatedAt: updated.Format(time.RFC3339),
+			Products:      products,
+			Seeded:        true,
+		}
+	}
+	return orders
+}
+
+// statusPicker - Draws statuses following their weights, or no status when there are none
+func statusPicker(weights map[string]float64) func(rng *rand.Rand) string {
+	statuses := make([]string, 0, len(weights))
+	total := 0.0
+	for status, weight := range weights {
+		statuses = append(statuses, status)
+		total += weight
+	}
+	// Map order is random, the draws must not be
+	sort.Strings(statuses)
+
+	return func(rng *rand.Rand) string {
+		if len(statuses) == 0 {
+			return ""
+		}
+		x := rng.Float64() * total
+		for _, status := range statuses {
+			if x < weights[status] {
+				return status
+			}
+			x -= weights[status]
+		}
+		return statuses[len(statuses)-1]
+	}
 }
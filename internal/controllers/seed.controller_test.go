@@ -2,39 +2,366 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/jobs"
 	"github.com/rameshsunkara/go-rest-api-example/internal/mocks"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var (
-	createFunc func(order interface{}) (*mongo.InsertOneResult, error)
-	sd         = NewSeedController(&mocks.MockOrdersDataService{})
+	sd = NewSeedController(&mocks.MockOrdersDataService{}, jobs.NewRunner(&mocks.MockJobsDataService{}),
+		WithFixturesDir("../../mockdata"))
 )
 
+func seedRequest(method string, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(method, "/seedDB", strings.NewReader(body))
+	if body == "" {
+		c.Request, _ = http.NewRequest(method, "/seedDB", nil)
+	}
+	if method == http.MethodPost {
+		sd.SeedDB(c)
+	} else {
+		sd.WipeSeedDB(c)
+	}
+	return w
+}
+
+// seedJob - Job as submitted by SeedDB
+func seedJob(t *testing.T, params models.SeedParams) *models.Job {
+	params.ApplyDefaults(time.Now())
+	raw, _ := json.Marshal(params)
+	job := &models.Job{Type: SeedJobType, CreatedAt: time.Now()}
+	assert.NoError(t, json.Unmarshal(raw, &job.Params))
+	return job
+}
+
+// collectOrders - Makes CreateMany keep what it's given
+func collectOrders() *[]*models.Order {
+	var inserted []*models.Order
+	mocks.CreateManyFunc = func(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error) {
+		inserted = append(inserted, purchaseOrders...)
+		return &mongo.InsertManyResult{InsertedIDs: make([]interface{}, len(purchaseOrders))}, nil
+	}
+	return &inserted
+}
+
+func noProgress(done, total int) error {
+	return nil
+}
+
 func TestNewSeedHandler(t *testing.T) {
 	assert.IsType(t, &SeedController{}, sd)
 	assert.IsType(t, &mocks.MockOrdersDataService{}, sd.dataSvc)
+	assert.EqualValues(t, "../../mockdata", sd.fixturesDir)
 }
 
 func TestSeedDB(t *testing.T) {
-	// Test Setup
-	gin.SetMode(gin.TestMode)
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-	mocks.CreateFunc = func(ctx context.Context, purchaseOrder interface{}) (*mongo.InsertOneResult, error) {
-		return nil, nil
+	jobId := primitive.NewObjectID()
+	var submitted *models.Job
+	mocks.CreateJobFunc = func(ctx context.Context, job *models.Job) error {
+		job.ID = jobId
+		job.Status = models.JobQueued
+		submitted = job
+		return nil
+	}
+
+	w := seedRequest(http.MethodPost, "")
+
+	assert.EqualValues(t, http.StatusAccepted, w.Code)
+	assert.EqualValues(t, "/api/v1/jobs/"+jobId.Hex(), w.Header().Get("Location"))
+	assert.EqualValues(t, SeedJobType, submitted.Type)
+	// Defaults are part of the job, it can be run again to get the same data
+	assert.EqualValues(t, models.DefaultSeedCount, submitted.Params["count"])
+	assert.NotNil(t, submitted.Params["seed"])
+	assert.NotEmpty(t, submitted.Params["from"])
+}
+
+func TestSeedDB_Params(t *testing.T) {
+	var submitted *models.Job
+	mocks.CreateJobFunc = func(ctx context.Context, job *models.Job) error {
+		submitted = job
+		return nil
+	}
+
+	w := seedRequest(http.MethodPost, `{"count":10,"products_per_order":{"min":1,"max":3},"seed":42,
+		"status_distribution":{"shipped":1},"from":"2022-01-01T00:00:00Z","to":"2022-02-01T00:00:00Z"}`)
+
+	assert.EqualValues(t, http.StatusAccepted, w.Code)
+	var params models.SeedParams
+	assert.NoError(t, submitted.DecodeParams(&params))
+	assert.EqualValues(t, 10, params.Count)
+	assert.EqualValues(t, models.SeedRange{Min: 1, Max: 3}, params.ProductsPerOrder)
+	assert.EqualValues(t, 42, *params.Seed)
+	assert.EqualValues(t, "2022-02-01T00:00:00Z", params.To.Format(time.RFC3339))
+}
+
+func TestSeedDB_LargeSeed(t *testing.T) {
+	var submitted *models.Job
+	mocks.CreateJobFunc = func(ctx context.Context, job *models.Job) error {
+		submitted = job
+		return nil
+	}
+
+	// Beyond what a float64 holds exactly, as default seeds are
+	w := seedRequest(http.MethodPost, `{"seed":9007199254740993}`)
+
+	assert.EqualValues(t, http.StatusAccepted, w.Code)
+	var params models.SeedParams
+	assert.NoError(t, submitted.DecodeParams(&params))
+	assert.EqualValues(t, 9007199254740993, *params.Seed)
+}
+
+func TestSeedDB_BadRequest(t *testing.T) {
+	type seedBadRequestTestCase struct {
+		Description string
+		Body        string
+	}
+
+	var testCases = []seedBadRequestTestCase{
+		{"invalid JSON", `{"count":`},
+		{"too many orders", `{"count":1000000}`},
+		{"negative count", `{"count":-1}`},
+		{"empty product range", `{"products_per_order":{"min":3,"max":2}}`},
+		{"too many products", `{"products_per_order":{"min":1,"max":100}}`},
+		{"reversed dates", `{"from":"2022-02-01T00:00:00Z","to":"2022-01-01T00:00:00Z"}`},
+		{"negative weight", `{"status_distribution":{"shipped":-1}}`},
+		{"no weight", `{"status_distribution":{"shipped":0}}`},
+		{"fixture outside of the fixtures", `{"fixture":"../config/dev"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			mocks.CreateJobFunc = func(ctx context.Context, job *models.Job) error {
+				t.Error("no job must be submitted")
+				return nil
+			}
+
+			w := seedRequest(http.MethodPost, tc.Body)
+
+			assert.EqualValues(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestSeedDB_Error(t *testing.T) {
+	mocks.CreateJobFunc = func(ctx context.Context, job *models.Job) error {
+		return errors.New("db error")
+	}
+
+	w := seedRequest(http.MethodPost, "")
+
+	assert.EqualValues(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestWipeSeedDB(t *testing.T) {
+	mocks.DeleteSeededFunc = func(ctx context.Context) (int64, error) {
+		return 42, nil
+	}
+
+	w := seedRequest(http.MethodDelete, "")
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"Count":42`)
+}
+
+func TestWipeSeedDB_Error(t *testing.T) {
+	mocks.DeleteSeededFunc = func(ctx context.Context) (int64, error) {
+		return 0, errors.New("db error")
+	}
+
+	w := seedRequest(http.MethodDelete, "")
+
+	assert.EqualValues(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestSeed(t *testing.T) {
+	inserted := collectOrders()
+	seed := models.RandomSeed(42)
+	from := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
+	params := models.SeedParams{
+		Count:            1200,
+		ProductsPerOrder: models.SeedRange{Min: 1, Max: 3},
+		Statuses:         map[string]float64{"pending": 1, "shipped": 3},
+		From:             from,
+		To:               to,
+		Seed:             &seed,
+	}
+	var last [2]int
+	progress := func(done, total int) error {
+		last = [2]int{done, total}
+		return nil
+	}
+
+	result, err := sd.Seed(context.TODO(), seedJob(t, params), progress)
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1200, result["count"])
+	assert.EqualValues(t, 42, result["seed"])
+	assert.EqualValues(t, [2]int{1200, 1200}, last)
+	assert.EqualValues(t, 1200, len(*inserted))
+	statuses := map[string]int{}
+	for _, o := range *inserted {
+		assert.True(t, o.Seeded)
+		assert.NoError(t, o.Validate())
+		assert.True(t, len(o.Products) >= 1 && len(o.Products) <= 3)
+		updated, _ := time.Parse(time.RFC3339, o.LastUpdatedAt)
+		assert.False(t, updated.Before(from) || updated.After(to))
+		for _, p := range o.Products {
+			statuses[p.Status]++
+		}
+	}
+	assert.EqualValues(t, 2, len(statuses))
+	assert.Greater(t, statuses["shipped"], statuses["pending"])
+}
+
+func TestSeed_Deterministic(t *testing.T) {
+	seed := models.RandomSeed(7)
+	params := models.SeedParams{
+		Count: 600,
+		From:  time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:    time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+		Seed:  &seed,
+	}
+
+	first := collectOrders()
+	_, _ = sd.Seed(context.TODO(), seedJob(t, params), noProgress)
+	second := collectOrders()
+	_, _ = sd.Seed(context.TODO(), seedJob(t, params), noProgress)
+	other := models.RandomSeed(8)
+	params.Seed = &other
+	third := collectOrders()
+	_, _ = sd.Seed(context.TODO(), seedJob(t, params), noProgress)
+
+	assert.EqualValues(t, *first, *second)
+	assert.NotEqualValues(t, *first, *third)
+
+	// An interrupted job picks up after the batches it reported
+	params.Seed = &seed
+	job := seedJob(t, params)
+	job.Progress = models.JobProgress{Done: SeedBatchSize, Total: 600}
+	resumed := collectOrders()
+	_, _ = sd.Seed(context.TODO(), job, noProgress)
+	assert.EqualValues(t, (*first)[SeedBatchSize:], *resumed)
+}
+
+func TestSeed_Resumed(t *testing.T) {
+	seed := models.RandomSeed(7)
+	params := models.SeedParams{Count: 2 * SeedBatchSize, Seed: &seed}
+	job := seedJob(t, params)
+	job.ID = primitive.NewObjectID()
+
+	first := collectOrders()
+	_, _ = sd.Seed(context.TODO(), job, noProgress)
+	ids := map[primitive.ObjectID]bool{}
+	for _, o := range *first {
+		ids[o.ID] = true
+	}
+	assert.EqualValues(t, 2*SeedBatchSize, len(ids))
+	assert.EqualValues(t, lastUpdated(*(*first)[0]).Unix(), (*first)[0].ID.Timestamp().Unix())
+
+	// Another job with the same seed generates the same orders
+	other := seedJob(t, params)
+	other.ID = primitive.NewObjectID()
+	second := collectOrders()
+	_, _ = sd.Seed(context.TODO(), other, noProgress)
+	assert.EqualValues(t, *first, *second)
+
+	// Interrupted once the second batch was inserted but before it was reported, it's inserted again and skipped
+	job.Progress = models.JobProgress{Done: SeedBatchSize, Total: 2 * SeedBatchSize}
+	var again []*models.Order
+	mocks.CreateManyFunc = func(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error) {
+		again = append(again, purchaseOrders...)
+		writeErrors := make([]mongo.BulkWriteError, len(purchaseOrders))
+		for i := range writeErrors {
+			writeErrors[i] = mongo.BulkWriteError{WriteError: mongo.WriteError{Index: i, Code: 11000}}
+		}
+		return &mongo.InsertManyResult{InsertedIDs: make([]interface{}, len(purchaseOrders))},
+			mongo.BulkWriteException{WriteErrors: writeErrors}
+	}
+	result, err := sd.Seed(context.TODO(), job, noProgress)
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2*SeedBatchSize, result["count"])
+	assert.EqualValues(t, (*first)[SeedBatchSize:], again)
+}
+
+func TestSeed_Stopped(t *testing.T) {
+	collectOrders()
+	progress := func(done, total int) error {
+		return context.Canceled
+	}
+
+	result, err := sd.Seed(context.TODO(), seedJob(t, models.SeedParams{Count: 1000}), progress)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.EqualValues(t, SeedBatchSize, result["count"])
+}
+
+func TestSeed_Error(t *testing.T) {
+	mocks.CreateManyFunc = func(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error) {
+		return nil, errors.New("db error")
+	}
+
+	_, err := sd.Seed(context.TODO(), seedJob(t, models.SeedParams{}), noProgress)
+
+	assert.Error(t, err)
+}
+
+func TestSeedFixture(t *testing.T) {
+	inserted := collectOrders()
+
+	result, err := sd.Seed(context.TODO(), seedJob(t, models.SeedParams{Fixture: "allOrders"}), noProgress)
+
+	assert.NoError(t, err)
+	assert.Greater(t, len(*inserted), 1)
+	assert.EqualValues(t, len(*inserted), result["count"])
+	assert.EqualValues(t, 0, result["skipped"])
+	assert.False(t, (*inserted)[0].ID.IsZero())
+	assert.EqualValues(t, "2022-05-30T21:27:15Z", (*inserted)[0].LastUpdatedAt)
+	assert.True(t, (*inserted)[0].Seeded)
+}
+
+func TestSeedFixture_Skipped(t *testing.T) {
+	dir := t.TempDir()
+	fixture := `[{"Products":[{"Name":"first","Price":10}]},{"Products":[]},{"Products":[{"Name":"third","Price":30}]}]`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "orders.json"), []byte(fixture), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "order.json"), []byte(`{"Products":[{"Name":"a","Price":1}]}`), 0o600))
+	s := NewSeedController(&mocks.MockOrdersDataService{}, jobs.NewRunner(&mocks.MockJobsDataService{}), WithFixturesDir(dir))
+	mocks.CreateManyFunc = func(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error) {
+		if len(purchaseOrders) == 1 {
+			return &mongo.InsertManyResult{InsertedIDs: []interface{}{1}}, nil
+		}
+		return &mongo.InsertManyResult{InsertedIDs: []interface{}{1}}, mongo.BulkWriteException{
+			WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Index: 0, Code: 11000}}},
+		}
 	}
 
-	// Call actual function
-	sd.SeedDB(c)
+	result, err := s.Seed(context.TODO(), seedJob(t, models.SeedParams{Fixture: "orders"}), noProgress)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, result["count"])
+	assert.EqualValues(t, 2, result["skipped"])
 
-	resp := w.Result()
+	result, err = s.Seed(context.TODO(), seedJob(t, models.SeedParams{Fixture: "order"}), noProgress)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, result["count"])
 
-	assert.EqualValues(t, http.StatusOK, resp.StatusCode)
+	_, err = s.Seed(context.TODO(), seedJob(t, models.SeedParams{Fixture: "missing"}), noProgress)
+	assert.Error(t, err)
 }
@@ -1,7 +1,7 @@
 package controllers
 
 import (
-	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/health"
 	"github.com/rameshsunkara/go-rest-api-example/internal/models"
 	"net/http"
 	"time"
@@ -24,31 +24,49 @@ type StatusResponse struct {
 	UpTime      time.Time
 	Environment string
 	Version     string
+	Checks      []health.Result
+}
+
+type ReadinessResponse struct {
+	Status ServiceStatus
+	// Waiting - Startup tasks not done yet and failing checks
+	Waiting []string `json:",omitempty"`
 }
 
 type StatusController struct {
 	svcInfo *models.ServiceInfo
-	dbMgr   db.MongoManager
+	monitor *health.Monitor
 }
 
-func NewStatusController(s *models.ServiceInfo, m db.MongoManager) *StatusController {
+func NewStatusController(s *models.ServiceInfo, m *health.Monitor) *StatusController {
 	return &StatusController{
 		svcInfo: s,
-		dbMgr:   m,
+		monitor: m,
 	}
 }
 
-// CheckStatus - Checks the health of all the dependencies of the service to ensure complete serviceability
-func (s *StatusController) CheckStatus(c *gin.Context) {
-	log.Debug().Msg("in CheckStatus")
-	var stat ServiceStatus
-	var code int
+// Live - Tells the process is alive, without looking at the dependencies: restarting it wouldn't bring them back
+func (s *StatusController) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, ReadinessResponse{Status: UP})
+}
 
-	if err := s.dbMgr.Ping(); err == nil {
-		stat = UP
-		code = http.StatusOK
-	} else {
-		log.Error().Msg("unable to connect to DB")
+// Ready - Tells whether the service can take requests, i.e. its startup tasks are done and its dependencies were up
+// the last time they were checked
+func (s *StatusController) Ready(c *gin.Context) {
+	if ready, waiting := s.monitor.Ready(); !ready {
+		c.JSON(http.StatusServiceUnavailable, ReadinessResponse{Status: DOWN, Waiting: waiting})
+		return
+	}
+	c.JSON(http.StatusOK, ReadinessResponse{Status: UP})
+}
+
+// CheckStatus - Health of all the dependencies of the service, as they were the last time they were checked, to ensure
+// complete serviceability
+func (s *StatusController) CheckStatus(c *gin.Context) {
+	log.Ctx(c).Debug().Msg("in CheckStatus")
+	stat := UP
+	code := http.StatusOK
+	if !s.monitor.Healthy() {
 		stat = DOWN
 		code = http.StatusFailedDependency
 	}
@@ -59,6 +77,7 @@ func (s *StatusController) CheckStatus(c *gin.Context) {
 		UpTime:      s.svcInfo.UpTime,
 		Environment: s.svcInfo.Environment,
 		Version:     s.svcInfo.Version,
+		Checks:      s.monitor.Results(),
 	}
 
 	// send response
@@ -1,9 +1,11 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/health"
 	"github.com/rameshsunkara/go-rest-api-example/internal/mocks"
 	"github.com/rameshsunkara/go-rest-api-example/internal/models"
 	"github.com/stretchr/testify/assert"
@@ -28,17 +30,24 @@ var (
 		UpTime:      time.Now(),
 		Environment: "test",
 	}
-	s = NewStatusController(svcInfo, &mocks.MockMongoMgr{})
 )
 
+func newStatusController() (*StatusController, *health.Monitor) {
+	monitor := health.NewMonitor()
+	monitor.Register(health.NewChecker("mongodb", (&mocks.MockMongoMgr{}).Ping), time.Second)
+	return NewStatusController(svcInfo, monitor), monitor
+}
+
 func TestStatusSuccess(t *testing.T) {
 	// Test Setup
 	gin.SetMode(gin.TestMode)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	mocks.PingFunc = func() error {
+	mocks.PingFunc = func(ctx context.Context) error {
 		return nil
 	}
+	s, monitor := newStatusController()
+	monitor.Refresh(context.Background())
 
 	// Call actual function
 	s.CheckStatus(c)
@@ -51,6 +60,11 @@ func TestStatusSuccess(t *testing.T) {
 	}
 	assert.EqualValues(t, http.StatusOK, resp.StatusCode)
 	assert.EqualValues(t, "test", statusResponse.Environment)
+	if assert.Len(t, statusResponse.Checks, 1) {
+		assert.EqualValues(t, "mongodb", statusResponse.Checks[0].Name)
+		assert.EqualValues(t, health.StatusUp, statusResponse.Checks[0].Status)
+		assert.NotEmpty(t, statusResponse.Checks[0].Latency)
+	}
 }
 
 func TestStatusDown(t *testing.T) {
@@ -58,9 +72,11 @@ func TestStatusDown(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 
-	mocks.PingFunc = func() error {
+	mocks.PingFunc = func(ctx context.Context) error {
 		return errors.New("DB Connection Failed")
 	}
+	s, monitor := newStatusController()
+	monitor.Refresh(context.Background())
 
 	s.CheckStatus(c)
 
@@ -72,4 +88,83 @@ func TestStatusDown(t *testing.T) {
 
 	assert.EqualValues(t, http.StatusFailedDependency, resp.StatusCode)
 	assert.EqualValues(t, "rams-fav", statusResponse.Version)
+	if assert.Len(t, statusResponse.Checks, 1) {
+		assert.EqualValues(t, health.StatusDown, statusResponse.Checks[0].Status)
+		assert.EqualValues(t, "DB Connection Failed", statusResponse.Checks[0].LastError)
+	}
+}
+
+func TestStatusCached(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	pings := 0
+	mocks.PingFunc = func(ctx context.Context) error {
+		pings++
+		return nil
+	}
+	s, monitor := newStatusController()
+	monitor.Refresh(context.Background())
+
+	for i := 0; i < 3; i++ {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		s.CheckStatus(c)
+	}
+	assert.EqualValues(t, 1, pings)
+}
+
+func TestLive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	mocks.PingFunc = func(ctx context.Context) error {
+		return errors.New("DB Connection Failed")
+	}
+	s, monitor := newStatusController()
+	monitor.Refresh(context.Background())
+
+	s.Live(c)
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+}
+
+func TestReady(t *testing.T) {
+	type readyTestCase struct {
+		Description     string
+		PingErr         error
+		Refresh         bool
+		StartupDone     bool
+		ExpectedCode    int
+		ExpectedWaiting []string
+	}
+
+	var testCases = []readyTestCase{
+		{"ready", nil, true, true, http.StatusOK, nil},
+		{"not checked yet", nil, false, true, http.StatusServiceUnavailable, []string{"mongodb"}},
+		{"startup task pending", nil, true, false, http.StatusServiceUnavailable, []string{"migrations"}},
+		{"dependency down", errors.New("DB Connection Failed"), true, true, http.StatusServiceUnavailable,
+			[]string{"mongodb"}},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tc := range testCases {
+		mocks.PingFunc = func(ctx context.Context) error {
+			return tc.PingErr
+		}
+		s, monitor := newStatusController()
+		done := monitor.StartupTask("migrations")
+		if tc.StartupDone {
+			done()
+		}
+		if tc.Refresh {
+			monitor.Refresh(context.Background())
+		}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		s.Ready(c)
+
+		var resp ReadinessResponse
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp), tc.Description)
+		assert.EqualValues(t, tc.ExpectedCode, w.Code, tc.Description)
+		assert.EqualValues(t, tc.ExpectedWaiting, resp.Waiting, tc.Description)
+	}
 }
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const APIKeysCollection = "apikeys"
+
+var (
+	InvalidAPIKeyIdErr = errors.New("invalid api key id")
+	APIKeyNotFoundErr  = errors.New("api key not found")
+)
+
+type APIKeysDataService interface {
+	// Create - Stores a new key, setting its ID unless already set
+	Create(ctx context.Context, key *models.APIKey) error
+	GetById(ctx context.Context, id string) (*models.APIKey, error)
+	// GetAll - Keys of the given owner, of every owner when empty
+	GetAll(ctx context.Context, owner string) ([]models.APIKey, error)
+	// Rotate - Replaces the hash of the secret of an active key, the previous secret stops working right away
+	Rotate(ctx context.Context, id string, hash string) (*models.APIKey, error)
+	// Revoke - Disables the key for good, it stays listed for auditing
+	Revoke(ctx context.Context, id string) (*models.APIKey, error)
+	// Touch - Records the key was used at the given time
+	Touch(ctx context.Context, id string, at time.Time) error
+}
+
+func NewAPIKeysDataService(db MongoDatabase) APIKeysDataService {
+	return &apiKeysRepo{
+		db: db,
+	}
+}
+
+// apiKeysRepo - Implements APIKeysDataService
+type apiKeysRepo struct {
+	db MongoDatabase
+}
+
+// collection - API keys collection of the client in use, see MongoManager.Database
+func (r *apiKeysRepo) collection() *mongo.Collection {
+	return r.db.Collection(APIKeysCollection)
+}
+
+func (r *apiKeysRepo) Create(ctx context.Context, key *models.APIKey) error {
+	if vErr := validate(r.collection()); vErr != nil {
+		return vErr
+	}
+	if key.ID.IsZero() {
+		key.ID = primitive.NewObjectID()
+	}
+	key.CreatedAt = time.Now().UTC()
+	_, err := r.collection().InsertOne(ctx, key)
+	return err
+}
+
+func (r *apiKeysRepo) GetById(ctx context.Context, id string) (*models.APIKey, error) {
+	if vErr := validate(r.collection()); vErr != nil {
+		return nil, vErr
+	}
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, InvalidAPIKeyIdErr
+	}
+
+	var key models.APIKey
+	err = r.collection().FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: docID}}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, APIKeyNotFoundErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *apiKeysRepo) GetAll(ctx context.Context, owner string) ([]models.APIKey, error) {
+	if vErr := validate(r.collection()); vErr != nil {
+		return nil, vErr
+	}
+
+	filter := bson.D{}
+	if owner != "" {
+		filter = append(filter, primitive.E{Key: "owner", Value: owner})
+	}
+	opts := options.Find().SetSort(bson.D{primitive.E{Key: "created_at", Value: 1}})
+	cursor, err := r.collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]models.APIKey, 0)
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *apiKeysRepo) Rotate(ctx context.Context, id string, hash string) (*models.APIKey, error) {
+	if vErr := validate(r.collection()); vErr != nil {
+		return nil, vErr
+	}
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, InvalidAPIKeyIdErr
+	}
+
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: docID},
+		primitive.E{Key: "revoked_at", Value: bson.D{primitive.E{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "hash", Value: hash},
+		primitive.E{Key: "rotated_at", Value: time.Now().UTC()},
+	}}}
+	return r.findOneAndUpdate(ctx, filter, update)
+}
+
+func (r *apiKeysRepo) Revoke(ctx context.Context, id string) (*models.APIKey, error) {
+	if vErr := validate(r.collection()); vErr != nil {
+		return nil, vErr
+	}
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, InvalidAPIKeyIdErr
+	}
+
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: docID},
+		primitive.E{Key: "revoked_at", Value: bson.D{primitive.E{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{primitive.E{Key: "revoked_at", Value: time.Now().UTC()}}}}
+	key, err := r.findOneAndUpdate(ctx, filter, update)
+	if err == APIKeyNotFoundErr {
+		// Already revoked, or not there at all
+		return r.GetById(ctx, id)
+	}
+	return key, err
+}
+
+func (r *apiKeysRepo) Touch(ctx context.Context, id string, at time.Time) error {
+	if vErr := validate(r.collection()); vErr != nil {
+		return vErr
+	}
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return InvalidAPIKeyIdErr
+	}
+
+	filter := bson.D{primitive.E{Key: "_id", Value: docID}}
+	update := bson.D{primitive.E{Key: "$max", Value: bson.D{primitive.E{Key: "last_used_at", Value: at.UTC()}}}}
+	_, err = r.collection().UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (r *apiKeysRepo) findOneAndUpdate(ctx context.Context, filter bson.D, update bson.D) (*models.APIKey, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var key models.APIKey
+	err := r.collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, APIKeyNotFoundErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
@@ -0,0 +1,57 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	dSvc := db.NewAPIKeysDataService(testDBMgr.Database())
+
+	key := &models.APIKey{ID: primitive.NewObjectID(), Name: "billing", Owner: "billing-svc",
+		Scopes: []string{models.ScopeOrdersRead}, Hash: "first"}
+	err := dSvc.Create(context.TODO(), key)
+	assert.Nil(t, err)
+	id := key.ID.Hex()
+
+	keys, err := dSvc.GetAll(context.TODO(), "billing-svc")
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+
+	rotated, err := dSvc.Rotate(context.TODO(), id, "second")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "second", rotated.Hash)
+	assert.NotNil(t, rotated.RotatedAt)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	assert.Nil(t, dSvc.Touch(context.TODO(), id, now))
+	// Last use never goes back in time
+	assert.Nil(t, dSvc.Touch(context.TODO(), id, now.Add(-time.Hour)))
+	stored, err := dSvc.GetById(context.TODO(), id)
+	assert.Nil(t, err)
+	assert.True(t, now.Equal(*stored.LastUsedAt))
+
+	revoked, err := dSvc.Revoke(context.TODO(), id)
+	assert.Nil(t, err)
+	assert.NotNil(t, revoked.RevokedAt)
+
+	// Revoked keys stay revoked
+	_, err = dSvc.Rotate(context.TODO(), id, "third")
+	assert.ErrorIs(t, err, db.APIKeyNotFoundErr)
+}
+
+func TestGetAPIKeyById_Invalid(t *testing.T) {
+	dSvc := db.NewAPIKeysDataService(testDBMgr.Database())
+
+	_, err := dSvc.GetById(context.TODO(), "123")
+	assert.ErrorIs(t, err, db.InvalidAPIKeyIdErr)
+
+	_, err = dSvc.GetById(context.TODO(), primitive.NewObjectID().Hex())
+	assert.ErrorIs(t, err, db.APIKeyNotFoundErr)
+}
@@ -3,11 +3,14 @@ package db
 import (
 	"context"
 	"errors"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 
+	"github.com/rameshsunkara/go-rest-api-example/pkg/util"
 	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -18,6 +21,7 @@ var (
 	ClientCreationErr = errors.New("failed to create new client to connect with db")
 	ClientInitErr     = errors.New("failed to initialize db client")
 	ConnectionLeak    = errors.New("unable to disconnect from db, potential connection leak")
+	DisconnectedErr   = errors.New("disconnected from db")
 	connectOnce       sync.Once
 )
 
@@ -29,22 +33,32 @@ type MongoDatabase interface {
 }
 
 type MongoManager interface {
+	// Database - The database of the client in use, for as long as it is
 	Database() MongoDatabase
-	Ping() error
+	Ping(ctx context.Context) error
+	// Reconnect - Connects with connUrl from now on, when it differs from the current one e.g. rotated credentials
+	Reconnect(connUrl string) error
 	Disconnect() error
 }
 
 // connectionManager - Implements MongoManager
 type connectionManager struct {
-	client   *mongo.Client
-	database *mongo.Database
+	dbName string
+	// reconnect - Keeps reconnections from overlapping
+	reconnect sync.Mutex
+
+	mu           sync.RWMutex
+	connUrl      string
+	client       *mongo.Client
+	database     *mongo.Database
+	disconnected bool
 }
 
 // NewMongoManager - Initializes DB connection and returns a Manager object which can be used to perform DB operations
 func NewMongoManager(dbName string, connUrl string) (MongoManager, error) {
-	log.Debug().Str("DB Connection Url", connUrl)
+	log.Debug().Str("url", util.RedactURL(connUrl)).Msg("connecting to DB")
 
-	dbMgr := &connectionManager{}
+	dbMgr := &connectionManager{dbName: dbName, connUrl: connUrl}
 	var connErr error
 	connectOnce.Do(func() {
 		if c, err := newClient(connUrl); err != nil {
@@ -55,7 +69,9 @@ func NewMongoManager(dbName string, connUrl string) (MongoManager, error) {
 			dbMgr.client = c
 
 			// Verify connection
-			if err := dbMgr.Ping(); err != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), ConnectionTimeOut)
+			defer cancel()
+			if err := dbMgr.Ping(ctx); err != nil {
 				connErr = err
 			}
 		}
@@ -64,15 +80,38 @@ func NewMongoManager(dbName string, connUrl string) (MongoManager, error) {
 	return dbMgr, connErr
 }
 
+// RefreshConnUrl - Resolves the connection string every interval until ctx is done, reconnecting once it changes
+func RefreshConnUrl(ctx context.Context, mgr MongoManager, interval time.Duration, resolve func() (string, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		connUrl, err := resolve()
+		if err != nil {
+			log.Error().Err(err).Msg("unable to read DB connection string, keeping the current one")
+			continue
+		}
+		if err := mgr.Reconnect(connUrl); err != nil {
+			log.Error().Err(err).Msg("unable to reconnect to DB, keeping the current connection")
+		}
+	}
+}
+
 // newClient - creates a new Mongo Client to connect to the specified url and initializes the Client
 func newClient(connectionUrl string) (*mongo.Client, error) {
 	if len(connectionUrl) == 0 {
 		return nil, InvalidConnUrlErr
 	}
-	clientOptions := options.Client().ApplyURI(connectionUrl)
+	clientOptions := options.Client().ApplyURI(connectionUrl).
+		SetMonitor(commandMonitor()).
+		SetPoolMonitor(poolMonitor())
 	client, err := mongo.NewClient(clientOptions)
 	if err != nil {
-		log.Error().Err(err).Msg("Connection Failed to Database")
+		log.Error().Err(redact(err, connectionUrl)).Msg("Connection Failed to Database")
 		return nil, ClientCreationErr
 	}
 
@@ -80,34 +119,144 @@ func newClient(connectionUrl string) (*mongo.Client, error) {
 	defer cancel()
 	connErr := client.Connect(ctx)
 	if connErr != nil {
-		log.Error().Err(connErr).Msg("Connection Failed to Database")
+		log.Error().Err(redact(connErr, connectionUrl)).Msg("Connection Failed to Database")
 		return nil, ClientInitErr
 	}
 
 	return client, nil
 }
 
-// Database - Returns configured database instance
+// Database - Returns configured database instance. Its collections belong to the client in use when they are got, so
+// get them again for every operation rather than keep them.
 func (c *connectionManager) Database() MongoDatabase {
-	return c.database
+	return &currentDatabase{mgr: c}
+}
+
+// currentDatabase - Database of the client in use, which changes when the manager reconnects
+type currentDatabase struct {
+	mgr *connectionManager
+}
+
+func (d *currentDatabase) Collection(name string, opts ...*options.CollectionOptions) *mongo.Collection {
+	d.mgr.mu.RLock()
+	defer d.mgr.mu.RUnlock()
+	if d.mgr.database == nil {
+		return nil
+	}
+	return d.mgr.database.Collection(name, opts...)
 }
 
-// Ping - Validates application's connectivity to the underlying database by pinging
-func (c *connectionManager) Ping() error {
-	if err := c.client.Ping(context.TODO(), readpref.Primary()); err != nil {
-		log.Error().Err(err).Msg("unable to connect to DB")
+// Ping - Validates application's connectivity to the underlying database by pinging, giving up once ctx is done
+func (c *connectionManager) Ping(ctx context.Context) error {
+	c.mu.RLock()
+	client, connUrl := c.client, c.connUrl
+	c.mu.RUnlock()
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		err = redact(err, connUrl)
+		log.Ctx(ctx).Error().Err(err).Msg("unable to connect to DB")
 		return err
 	}
 	return nil
 }
 
+// Reconnect - Connects with connUrl and, once connected, swaps the client in use for the new one. The previous client
+// is disconnected in the background, after the operations it is running are done.
+func (c *connectionManager) Reconnect(connUrl string) error {
+	c.reconnect.Lock()
+	defer c.reconnect.Unlock()
+	c.mu.RLock()
+	unchanged, disconnected := connUrl == c.connUrl, c.disconnected
+	c.mu.RUnlock()
+	if disconnected {
+		return DisconnectedErr
+	}
+	if unchanged {
+		return nil
+	}
+
+	log.Info().Str("url", util.RedactURL(connUrl)).Msg("DB connection string changed, reconnecting")
+	client, err := newClient(connUrl)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ConnectionTimeOut)
+	defer cancel()
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		_ = client.Disconnect(context.Background())
+		return redact(err, connUrl)
+	}
+
+	c.mu.Lock()
+	if c.disconnected {
+		c.mu.Unlock()
+		_ = client.Disconnect(context.Background())
+		return DisconnectedErr
+	}
+	previous := c.client
+	c.client, c.database, c.connUrl = client, client.Database(c.dbName), connUrl
+	c.mu.Unlock()
+	log.Info().Msg("reconnected to DB")
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), ConnectionTimeOut)
+		defer cancel()
+		if err := previous.Disconnect(ctx); err != nil {
+			log.Warn().Err(err).Msg("unable to disconnect the previous DB client")
+		}
+	}()
+	return nil
+}
+
 // Disconnect - Close connection to Database
 func (c *connectionManager) Disconnect() error {
 	log.Info().Msg("Disconnecting from Database")
-	if err := c.client.Disconnect(context.Background()); err != nil {
-		log.Error().Err(err).Msg("unable to disconnect from DB")
+	c.reconnect.Lock()
+	defer c.reconnect.Unlock()
+	c.mu.Lock()
+	c.disconnected = true
+	client, connUrl := c.client, c.connUrl
+	c.mu.Unlock()
+	if err := client.Disconnect(context.Background()); err != nil {
+		log.Error().Err(redact(err, connUrl)).Msg("unable to disconnect from DB")
 		return ConnectionLeak
 	}
 	log.Info().Msg("Successfully disconnected from DB")
 	return nil
 }
+
+// redactedErr - Error with the password of the connection string masked in its message
+type redactedErr struct {
+	msg string
+	err error
+}
+
+func (e *redactedErr) Error() string {
+	return e.msg
+}
+
+func (e *redactedErr) Unwrap() error {
+	return e.err
+}
+
+// redact - err with the password of connUrl masked, should the driver have put it in the message
+func redact(err error, connUrl string) error {
+	if err == nil {
+		return nil
+	}
+	u, pErr := url.Parse(connUrl)
+	if pErr != nil {
+		return err
+	}
+	password, ok := u.User.Password()
+	if !ok || password == "" {
+		return err
+	}
+	msg := err.Error()
+	for _, p := range []string{password, url.QueryEscape(password), url.PathEscape(password)} {
+		msg = strings.ReplaceAll(msg, p, util.Redacted)
+	}
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedErr{msg: msg, err: err}
+}
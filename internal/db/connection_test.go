@@ -74,6 +74,6 @@ func TestDatabase(t *testing.T) {
 }
 
 func TestPing(t *testing.T) {
-	err := testDBMgr.Ping()
+	err := testDBMgr.Ping(context.Background())
 	assert.Nil(t, err)
 }
@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	IdempotencyCollection = "idempotencykeys"
+
+	// IdempotencyLease - Time a reserved key stays locked unless renewed. The request holding it renews it until it
+	// completes, so only a key whose request never completed (e.g. crashed) can be taken over.
+	IdempotencyLease = time.Minute
+)
+
+type IdempotencyDataService interface {
+	// Begin - Reserves the key for IdempotencyLease. Returns the existing record if the key is taken.
+	Begin(ctx context.Context, key string) (*models.IdempotencyRecord, error)
+	// Renew - Keeps the key reserved for another IdempotencyLease
+	Renew(ctx context.Context, key string) error
+	// Complete - Stores the response of the request that reserved the key, identified by fingerprint
+	Complete(ctx context.Context, key string, fingerprint string, statusCode int, headers map[string]string,
+		body []byte) error
+	// Release - Frees the key without storing a response, so the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// NewIdempotencyDataService - Records kept for ttl, asked for every key reserved so that it can change while serving
+func NewIdempotencyDataService(db MongoDatabase, ttl func() time.Duration) IdempotencyDataService {
+	return &idempotencyRepo{
+		db:  db,
+		ttl: ttl,
+	}
+}
+
+// idempotencyRepo - Implements IdempotencyDataService
+type idempotencyRepo struct {
+	db      MongoDatabase
+	ttl     func() time.Duration
+	indexes indexes
+}
+
+// collection - Idempotency collection of the client in use, see MongoManager.Database
+func (r *idempotencyRepo) collection() *mongo.Collection {
+	return r.db.Collection(IdempotencyCollection)
+}
+
+func (r *idempotencyRepo) Begin(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+	if vErr := validate(r.collection()); vErr != nil {
+		return nil, vErr
+	}
+	r.indexes.ensure(ctx, IdempotencyCollection, r.ensureIndexes)
+
+	now := time.Now().UTC()
+	record := &models.IdempotencyRecord{
+		Key:         key,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(r.ttl()),
+		LockedUntil: now.Add(IdempotencyLease),
+	}
+	_, err := r.collection().InsertOne(ctx, record)
+	if err == nil {
+		return nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	// Take over the key when the request holding it stopped renewing it
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: key},
+		primitive.E{Key: "completed", Value: false},
+		primitive.E{Key: "locked_until", Value: bson.D{primitive.E{Key: "$lt", Value: now}}},
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "created_at", Value: now},
+		primitive.E{Key: "expires_at", Value: record.ExpiresAt},
+		primitive.E{Key: "locked_until", Value: record.LockedUntil},
+	}}}
+	err = r.collection().FindOneAndUpdate(ctx, filter, update).Err()
+	if err == nil {
+		log.Ctx(ctx).Warn().Str("key", key).Msg("taking over abandoned idempotency key")
+		return nil, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	var existing models.IdempotencyRecord
+	if err := r.collection().FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: key}}).Decode(&existing); err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (r *idempotencyRepo) Renew(ctx context.Context, key string) error {
+	if vErr := validate(r.collection()); vErr != nil {
+		return vErr
+	}
+
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: key},
+		primitive.E{Key: "completed", Value: false},
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "locked_until", Value: time.Now().UTC().Add(IdempotencyLease)},
+	}}}
+	_, err := r.collection().UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (r *idempotencyRepo) Complete(ctx context.Context, key string, fingerprint string, statusCode int,
+	headers map[string]string, body []byte) error {
+	if vErr := validate(r.collection()); vErr != nil {
+		return vErr
+	}
+
+	filter := bson.D{primitive.E{Key: "_id", Value: key}}
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "fingerprint", Value: fingerprint},
+		primitive.E{Key: "completed", Value: true},
+		primitive.E{Key: "status_code", Value: statusCode},
+		primitive.E{Key: "headers", Value: headers},
+		primitive.E{Key: "body", Value: body},
+	}}}
+	_, err := r.collection().UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (r *idempotencyRepo) Release(ctx context.Context, key string) error {
+	if vErr := validate(r.collection()); vErr != nil {
+		return vErr
+	}
+
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: key},
+		primitive.E{Key: "completed", Value: false},
+	}
+	_, err := r.collection().DeleteOne(ctx, filter)
+	return err
+}
+
+// ensureIndexes - Lets Mongo delete the records once they expire. Each record holds its own expiry, so that a change to
+// the TTL needs no change to the index.
+func (r *idempotencyRepo) ensureIndexes(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{primitive.E{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	_, err := r.collection().Indexes().CreateOne(ctx, index)
+	return err
+}
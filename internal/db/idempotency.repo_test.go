@@ -0,0 +1,56 @@
+package db_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func anHour() time.Duration {
+	return time.Hour
+}
+
+func TestIdempotencyBeginAndComplete(t *testing.T) {
+	dSvc := db.NewIdempotencyDataService(testDBMgr.Database(), anHour)
+	const key = "test-key-complete"
+
+	existing, err := dSvc.Begin(context.TODO(), key)
+	assert.Nil(t, err)
+	assert.Nil(t, existing)
+
+	existing, err = dSvc.Begin(context.TODO(), key)
+	assert.Nil(t, err)
+	assert.NotNil(t, existing)
+	assert.False(t, existing.Completed)
+
+	assert.Nil(t, dSvc.Renew(context.TODO(), key))
+	err = dSvc.Complete(context.TODO(), key, "fingerprint", http.StatusCreated, map[string]string{"Location": "/x"},
+		[]byte("{}"))
+	assert.Nil(t, err)
+
+	existing, err = dSvc.Begin(context.TODO(), key)
+	assert.Nil(t, err)
+	assert.True(t, existing.Completed)
+	assert.EqualValues(t, "fingerprint", existing.Fingerprint)
+	assert.EqualValues(t, http.StatusCreated, existing.StatusCode)
+	assert.EqualValues(t, "/x", existing.Headers["Location"])
+}
+
+func TestIdempotencyRelease(t *testing.T) {
+	dSvc := db.NewIdempotencyDataService(testDBMgr.Database(), anHour)
+	const key = "test-key-release"
+
+	existing, err := dSvc.Begin(context.TODO(), key)
+	assert.Nil(t, err)
+	assert.Nil(t, existing)
+
+	assert.Nil(t, dSvc.Release(context.TODO(), key))
+
+	existing, err = dSvc.Begin(context.TODO(), key)
+	assert.Nil(t, err)
+	assert.Nil(t, existing)
+}
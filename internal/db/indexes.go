@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// IndexTimeout - Time given to create the indexes of a collection, whatever the request that needed them
+const IndexTimeout = 30 * time.Second
+
+// indexes - Creates the indexes of a collection the first time it's used. Unlike a sync.Once, creation doesn't stop
+// with the request that triggered it, and is tried again on the next use when it failed.
+type indexes struct {
+	mu      sync.Mutex
+	created uint32
+}
+
+// ensure - Calls create unless it already succeeded, with a context of its own
+func (i *indexes) ensure(ctx context.Context, collection string, create func(ctx context.Context) error) {
+	if atomic.LoadUint32(&i.created) == 1 {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.created == 1 {
+		return
+	}
+	createCtx, cancel := context.WithTimeout(context.Background(), IndexTimeout)
+	defer cancel()
+	if err := create(createCtx); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("collection", collection).
+			Msg("unable to create indexes, trying again on next use")
+		return
+	}
+	atomic.StoreUint32(&i.created, 1)
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexesEnsure(t *testing.T) {
+	var i indexes
+	calls := 0
+	create := func(ctx context.Context) error {
+		calls++
+		if calls == 1 {
+			return errors.New("db error")
+		}
+		return ctx.Err()
+	}
+	// Not bound to the request which needs them first
+	request, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	i.ensure(request, OrdersCollection, create)
+	i.ensure(request, OrdersCollection, create)
+	i.ensure(request, OrdersCollection, create)
+
+	assert.EqualValues(t, 2, calls)
+}
@@ -0,0 +1,328 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	JobsCollection = "jobs"
+
+	// JobLockTimeOut - Time without heartbeat after which a running job is considered interrupted and queued again
+	JobLockTimeOut = time.Minute
+)
+
+var (
+	InvalidJobIdErr = errors.New("invalid job id")
+	JobNotFoundErr  = errors.New("job not found")
+)
+
+type JobsDataService interface {
+	// Create - Stores a new queued job, setting its ID and making the caller in ctx its owner
+	Create(ctx context.Context, job *models.Job) error
+	// GetById - Job with the given ID, JobNotFoundErr when it doesn't exist or the caller in ctx can't see it, see
+	// visibleTo
+	GetById(ctx context.Context, id string) (*models.Job, error)
+	// Claim - Moves a queued job to running, returns nil when the job isn't queued (e.g. claimed by another instance)
+	Claim(ctx context.Context, id string) (*models.Job, error)
+	// Heartbeat - Signals the running job is alive. Returns true when the job must stop (cancelled or not running anymore)
+	Heartbeat(ctx context.Context, id string) (bool, error)
+	// ReportProgress - Heartbeat that also records the progress of the job
+	ReportProgress(ctx context.Context, id string, progress models.JobProgress) (bool, error)
+	// Finish - Records the final state of a running job
+	Finish(ctx context.Context, id string, status models.JobStatus, result map[string]interface{}, errMsg string) error
+	// Cancel - Cancels a queued job or asks a running one to stop, and returns the job as it is after that. Like
+	// GetById, only the jobs the caller in ctx can see.
+	Cancel(ctx context.Context, id string) (*models.Job, error)
+	// Requeue - Puts a running job back in the queue, e.g. when the instance running it shuts down
+	Requeue(ctx context.Context, id string) error
+	// Recover - Queues again the running jobs that stopped sending heartbeats and returns the IDs of all queued jobs,
+	// oldest first
+	Recover(ctx context.Context) ([]string, error)
+}
+
+func NewJobsDataService(db MongoDatabase, retention time.Duration) JobsDataService {
+	return &jobsRepo{
+		db:        db,
+		retention: retention,
+	}
+}
+
+// jobsRepo - Implements JobsDataService
+type jobsRepo struct {
+	db        MongoDatabase
+	retention time.Duration
+	indexes   indexes
+}
+
+// collection - Jobs collection of the client in use, see MongoManager.Database
+func (r *jobsRepo) collection() *mongo.Collection {
+	return r.db.Collection(JobsCollection)
+}
+
+func (r *jobsRepo) Create(ctx context.Context, job *models.Job) error {
+	if vErr := validate(r.collection()); vErr != nil {
+		return vErr
+	}
+	r.indexes.ensure(ctx, JobsCollection, r.ensureIndexes)
+
+	job.ID = primitive.NewObjectID()
+	job.Status = models.JobQueued
+	job.Owner, job.Org = "", ""
+	if p := models.PrincipalFromContext(ctx); p != nil {
+		job.Owner, job.Org = p.Subject, p.Org
+	}
+	job.CreatedAt = time.Now().UTC()
+	_, err := r.collection().InsertOne(ctx, job)
+	return err
+}
+
+func (r *jobsRepo) GetById(ctx context.Context, id string) (*models.Job, error) {
+	if vErr := validate(r.collection()); vErr != nil {
+		return nil, vErr
+	}
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, InvalidJobIdErr
+	}
+
+	var job models.Job
+	err = r.collection().FindOne(ctx, visibleTo(ctx, bson.D{primitive.E{Key: "_id", Value: docID}})).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, JobNotFoundErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *jobsRepo) Claim(ctx context.Context, id string) (*models.Job, error) {
+	if vErr := validate(r.collection()); vErr != nil {
+		return nil, vErr
+	}
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, InvalidJobIdErr
+	}
+
+	now := time.Now().UTC()
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: docID},
+		primitive.E{Key: "status", Value: models.JobQueued},
+	}
+	update := bson.D{
+		primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "status", Value: models.JobRunning},
+			primitive.E{Key: "started_at", Value: now},
+			primitive.E{Key: "heartbeat_at", Value: now},
+		}},
+		primitive.E{Key: "$inc", Value: bson.D{primitive.E{Key: "attempts", Value: 1}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var job models.Job
+	err = r.collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *jobsRepo) Heartbeat(ctx context.Context, id string) (bool, error) {
+	return r.touch(ctx, id, nil)
+}
+
+func (r *jobsRepo) ReportProgress(ctx context.Context, id string, progress models.JobProgress) (bool, error) {
+	return r.touch(ctx, id, &progress)
+}
+
+// touch - Refreshes the heartbeat of a running job, and its progress when given
+func (r *jobsRepo) touch(ctx context.Context, id string, progress *models.JobProgress) (bool, error) {
+	if vErr := validate(r.collection()); vErr != nil {
+		return false, vErr
+	}
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, InvalidJobIdErr
+	}
+
+	set := bson.D{primitive.E{Key: "heartbeat_at", Value: time.Now().UTC()}}
+	if progress != nil {
+		set = append(set, primitive.E{Key: "progress", Value: progress})
+	}
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: docID},
+		primitive.E{Key: "status", Value: models.JobRunning},
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: set}}
+	opts := options.FindOneAndUpdate().SetProjection(bson.D{primitive.E{Key: "cancel_requested", Value: 1}})
+
+	var job models.Job
+	err = r.collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return job.CancelRequested, nil
+}
+
+func (r *jobsRepo) Finish(ctx context.Context, id string, status models.JobStatus, result map[string]interface{}, errMsg string) error {
+	if vErr := validate(r.collection()); vErr != nil {
+		return vErr
+	}
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return InvalidJobIdErr
+	}
+
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: docID},
+		primitive.E{Key: "status", Value: models.JobRunning},
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "status", Value: status},
+		primitive.E{Key: "result", Value: result},
+		primitive.E{Key: "error", Value: errMsg},
+		primitive.E{Key: "finished_at", Value: time.Now().UTC()},
+	}}}
+	_, err = r.collection().UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (r *jobsRepo) Cancel(ctx context.Context, id string) (*models.Job, error) {
+	if vErr := validate(r.collection()); vErr != nil {
+		return nil, vErr
+	}
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, InvalidJobIdErr
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	// A queued job never starts
+	var job models.Job
+	filter := visibleTo(ctx, bson.D{
+		primitive.E{Key: "_id", Value: docID},
+		primitive.E{Key: "status", Value: models.JobQueued},
+	})
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "status", Value: models.JobCancelled},
+		primitive.E{Key: "cancel_requested", Value: true},
+		primitive.E{Key: "finished_at", Value: time.Now().UTC()},
+	}}}
+	err = r.collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err != mongo.ErrNoDocuments {
+		if err != nil {
+			return nil, err
+		}
+		return &job, nil
+	}
+
+	// A running job stops at its next heartbeat
+	filter = visibleTo(ctx, bson.D{
+		primitive.E{Key: "_id", Value: docID},
+		primitive.E{Key: "status", Value: models.JobRunning},
+	})
+	update = bson.D{primitive.E{Key: "$set", Value: bson.D{primitive.E{Key: "cancel_requested", Value: true}}}}
+	err = r.collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err != mongo.ErrNoDocuments {
+		if err != nil {
+			return nil, err
+		}
+		return &job, nil
+	}
+
+	// Finished jobs are left as they are, and jobs out of the caller's sight are not found
+	return r.GetById(ctx, id)
+}
+
+func (r *jobsRepo) Requeue(ctx context.Context, id string) error {
+	if vErr := validate(r.collection()); vErr != nil {
+		return vErr
+	}
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return InvalidJobIdErr
+	}
+
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: docID},
+		primitive.E{Key: "status", Value: models.JobRunning},
+	}
+	update := bson.D{
+		primitive.E{Key: "$set", Value: bson.D{primitive.E{Key: "status", Value: models.JobQueued}}},
+		primitive.E{Key: "$unset", Value: bson.D{primitive.E{Key: "heartbeat_at", Value: ""}}},
+	}
+	_, err = r.collection().UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (r *jobsRepo) Recover(ctx context.Context) ([]string, error) {
+	if vErr := validate(r.collection()); vErr != nil {
+		return nil, vErr
+	}
+
+	filter := bson.D{
+		primitive.E{Key: "status", Value: models.JobRunning},
+		primitive.E{Key: "heartbeat_at", Value: bson.D{primitive.E{Key: "$lt", Value: time.Now().UTC().Add(-JobLockTimeOut)}}},
+	}
+	update := bson.D{
+		primitive.E{Key: "$set", Value: bson.D{primitive.E{Key: "status", Value: models.JobQueued}}},
+		primitive.E{Key: "$unset", Value: bson.D{primitive.E{Key: "heartbeat_at", Value: ""}}},
+	}
+	res, err := r.collection().UpdateMany(ctx, filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if res.ModifiedCount > 0 {
+		log.Warn().Int64("count", res.ModifiedCount).Msg("queued interrupted jobs again")
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{primitive.E{Key: "created_at", Value: 1}}).
+		SetProjection(bson.D{primitive.E{Key: "_id", Value: 1}})
+	cursor, err := r.collection().Find(ctx, bson.D{primitive.E{Key: "status", Value: models.JobQueued}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var queued []models.Job
+	if err := cursor.All(ctx, &queued); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(queued))
+	for _, job := range queued {
+		ids = append(ids, job.ID.Hex())
+	}
+	return ids, nil
+}
+
+// ensureIndexes - Speeds up finding queued and interrupted jobs, and lets Mongo expire finished jobs after the retention
+func (r *jobsRepo) ensureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{primitive.E{Key: "status", Value: 1}, primitive.E{Key: "created_at", Value: 1}},
+		},
+		{
+			Keys:    bson.D{primitive.E{Key: "finished_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(r.retention.Seconds())),
+		},
+	}
+	_, err := r.collection().Indexes().CreateMany(ctx, indexes)
+	return err
+}
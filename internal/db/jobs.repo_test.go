@@ -0,0 +1,140 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestJobLifecycle(t *testing.T) {
+	dSvc := db.NewJobsDataService(testDBMgr.Database(), time.Hour)
+
+	job := &models.Job{Type: "test", Params: map[string]interface{}{"count": 10}}
+	err := dSvc.Create(context.TODO(), job)
+	assert.Nil(t, err)
+	assert.False(t, job.ID.IsZero())
+	id := job.ID.Hex()
+
+	claimed, err := dSvc.Claim(context.TODO(), id)
+	assert.Nil(t, err)
+	assert.EqualValues(t, models.JobRunning, claimed.Status)
+	assert.EqualValues(t, 1, claimed.Attempts)
+
+	// A job is claimed only once
+	again, err := dSvc.Claim(context.TODO(), id)
+	assert.Nil(t, err)
+	assert.Nil(t, again)
+
+	stop, err := dSvc.ReportProgress(context.TODO(), id, models.JobProgress{Done: 5, Total: 10})
+	assert.Nil(t, err)
+	assert.False(t, stop)
+
+	err = dSvc.Finish(context.TODO(), id, models.JobSucceeded, map[string]interface{}{"count": 10}, "")
+	assert.Nil(t, err)
+
+	stored, err := dSvc.GetById(context.TODO(), id)
+	assert.Nil(t, err)
+	assert.EqualValues(t, models.JobSucceeded, stored.Status)
+	assert.EqualValues(t, 5, stored.Progress.Done)
+	assert.NotNil(t, stored.FinishedAt)
+
+	// Finished jobs are left as they are, and don't report as running anymore
+	cancelled, err := dSvc.Cancel(context.TODO(), id)
+	assert.Nil(t, err)
+	assert.EqualValues(t, models.JobSucceeded, cancelled.Status)
+	stop, err = dSvc.Heartbeat(context.TODO(), id)
+	assert.Nil(t, err)
+	assert.True(t, stop)
+}
+
+func TestJobCancel(t *testing.T) {
+	dSvc := db.NewJobsDataService(testDBMgr.Database(), time.Hour)
+
+	queued := &models.Job{Type: "test"}
+	_ = dSvc.Create(context.TODO(), queued)
+	job, err := dSvc.Cancel(context.TODO(), queued.ID.Hex())
+	assert.Nil(t, err)
+	assert.EqualValues(t, models.JobCancelled, job.Status)
+	claimed, _ := dSvc.Claim(context.TODO(), queued.ID.Hex())
+	assert.Nil(t, claimed)
+
+	running := &models.Job{Type: "test"}
+	_ = dSvc.Create(context.TODO(), running)
+	_, _ = dSvc.Claim(context.TODO(), running.ID.Hex())
+	job, err = dSvc.Cancel(context.TODO(), running.ID.Hex())
+	assert.Nil(t, err)
+	assert.EqualValues(t, models.JobRunning, job.Status)
+	assert.True(t, job.CancelRequested)
+	stop, err := dSvc.Heartbeat(context.TODO(), running.ID.Hex())
+	assert.Nil(t, err)
+	assert.True(t, stop)
+}
+
+func TestJobVisibility(t *testing.T) {
+	dSvc := db.NewJobsDataService(testDBMgr.Database(), time.Hour)
+	alice := models.ContextWithPrincipal(context.TODO(), &models.Principal{Subject: "alice", Org: "acme"})
+	bob := models.ContextWithPrincipal(context.TODO(),
+		&models.Principal{Subject: "bob", Org: "acme", Visibility: models.VisibilityOrg})
+	eve := models.ContextWithPrincipal(context.TODO(), &models.Principal{Subject: "eve", Org: "evil"})
+	admin := models.ContextWithPrincipal(context.TODO(),
+		&models.Principal{Subject: "root", Visibility: models.VisibilityAll})
+
+	job := &models.Job{Type: "test", Owner: "mallory"}
+	err := dSvc.Create(alice, job)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "alice", job.Owner)
+	assert.EqualValues(t, "acme", job.Org)
+	id := job.ID.Hex()
+
+	for _, ctx := range []context.Context{alice, bob, admin, context.TODO()} {
+		found, err := dSvc.GetById(ctx, id)
+		assert.Nil(t, err)
+		assert.NotNil(t, found)
+	}
+	_, err = dSvc.GetById(eve, id)
+	assert.ErrorIs(t, err, db.JobNotFoundErr)
+
+	// Out of sight is the same as not existing
+	_, err = dSvc.Cancel(eve, id)
+	assert.ErrorIs(t, err, db.JobNotFoundErr)
+	stored, _ := dSvc.GetById(alice, id)
+	assert.EqualValues(t, models.JobQueued, stored.Status)
+
+	// Running jobs are claimed without a caller
+	claimed, err := dSvc.Claim(context.TODO(), id)
+	assert.Nil(t, err)
+	assert.NotNil(t, claimed)
+	_, err = dSvc.Cancel(eve, id)
+	assert.ErrorIs(t, err, db.JobNotFoundErr)
+	cancelled, err := dSvc.Cancel(bob, id)
+	assert.Nil(t, err)
+	assert.True(t, cancelled.CancelRequested)
+}
+
+func TestJobRequeueAndRecover(t *testing.T) {
+	dSvc := db.NewJobsDataService(testDBMgr.Database(), time.Hour)
+
+	job := &models.Job{Type: "test"}
+	_ = dSvc.Create(context.TODO(), job)
+	_, _ = dSvc.Claim(context.TODO(), job.ID.Hex())
+	assert.Nil(t, dSvc.Requeue(context.TODO(), job.ID.Hex()))
+
+	ids, err := dSvc.Recover(context.TODO())
+	assert.Nil(t, err)
+	assert.Contains(t, ids, job.ID.Hex())
+}
+
+func TestJob_InvalidId(t *testing.T) {
+	dSvc := db.NewJobsDataService(testDBMgr.Database(), time.Hour)
+
+	_, err := dSvc.GetById(context.TODO(), "invalid")
+	assert.ErrorIs(t, err, db.InvalidJobIdErr)
+
+	_, err = dSvc.GetById(context.TODO(), primitive.NewObjectID().Hex())
+	assert.ErrorIs(t, err, db.JobNotFoundErr)
+}
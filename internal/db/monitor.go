@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/metrics"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// commandKey - Identifies a command until it finishes, request ids are only unique to a connection
+type commandKey struct {
+	connectionID string
+	requestID    int64
+}
+
+// commandMonitor - Times every command sent to MongoDB, and traces it as a child of the span of the context it was
+// sent with. Command bodies are left out of spans as they hold the orders.
+func commandMonitor() *event.CommandMonitor {
+	var spans sync.Map
+	finish := func(e event.CommandFinishedEvent, failure string) {
+		outcome := "success"
+		if failure != "" {
+			outcome = "failure"
+		}
+		metrics.MongoCommandDuration.WithLabelValues(e.CommandName, outcome).
+			Observe(time.Duration(e.DurationNanos).Seconds())
+
+		s, ok := spans.LoadAndDelete(commandKey{e.ConnectionID, e.RequestID})
+		if !ok {
+			return
+		}
+		span := s.(trace.Span)
+		if failure != "" {
+			span.SetStatus(codes.Error, failure)
+		}
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			attrs := []attribute.KeyValue{
+				semconv.DBSystemMongoDB,
+				semconv.DBNameKey.String(e.DatabaseName),
+				semconv.DBOperationKey.String(e.CommandName),
+			}
+			// Most commands are named after the collection they work on
+			if collection, ok := e.Command.Lookup(e.CommandName).StringValueOK(); ok {
+				attrs = append(attrs, semconv.DBMongoDBCollectionKey.String(collection))
+			}
+			_, span := tracer.Start(ctx, "mongodb."+e.CommandName,
+				trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+			spans.Store(commandKey{e.ConnectionID, e.RequestID}, span)
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			finish(e.CommandFinishedEvent, "")
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			finish(e.CommandFinishedEvent, e.Failure)
+		},
+	}
+}
+
+// poolMonitor - Keeps track of the connections pooled for each server, and of those handed out
+func poolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				metrics.MongoPoolConnections.WithLabelValues(e.Address, "open").Inc()
+			case event.ConnectionClosed:
+				metrics.MongoPoolConnections.WithLabelValues(e.Address, "open").Dec()
+			case event.GetSucceeded:
+				metrics.MongoPoolConnections.WithLabelValues(e.Address, "in_use").Inc()
+			case event.ConnectionReturned:
+				metrics.MongoPoolConnections.WithLabelValues(e.Address, "in_use").Dec()
+			case event.GetFailed:
+				metrics.MongoPoolCheckoutFailures.WithLabelValues(e.Address, e.Reason).Inc()
+			}
+		},
+	}
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rameshsunkara/go-rest-api-example/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPoolMonitor(t *testing.T) {
+	const addr = "monitored:27017"
+	monitor := poolMonitor()
+	for _, e := range []string{event.ConnectionCreated, event.ConnectionCreated, event.GetSucceeded,
+		event.GetSucceeded, event.ConnectionReturned, event.ConnectionClosed, event.GetFailed} {
+		monitor.Event(&event.PoolEvent{Type: e, Address: addr, Reason: "timeout"})
+	}
+
+	assert.EqualValues(t, 1, testutil.ToFloat64(metrics.MongoPoolConnections.WithLabelValues(addr, "open")))
+	assert.EqualValues(t, 1, testutil.ToFloat64(metrics.MongoPoolConnections.WithLabelValues(addr, "in_use")))
+	assert.EqualValues(t, 1, testutil.ToFloat64(metrics.MongoPoolCheckoutFailures.WithLabelValues(addr, "timeout")))
+}
+
+func TestCommandMonitor(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	ctx, parent := startSpan(context.Background(), OrdersCollection, "ordersRepo.GetById")
+	before := testutil.CollectAndCount(metrics.MongoCommandDuration)
+
+	monitor := commandMonitor()
+	find, _ := bson.Marshal(bson.D{primitive.E{Key: "monitoredFind", Value: OrdersCollection}})
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: find, DatabaseName: "ecommerce",
+		CommandName: "monitoredFind", ConnectionID: "conn", RequestID: 1})
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: find, DatabaseName: "ecommerce",
+		CommandName: "monitoredFind", ConnectionID: "conn", RequestID: 2})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{
+		CommandName: "monitoredFind", ConnectionID: "conn", RequestID: 1, DurationNanos: int64(time.Millisecond)}})
+	monitor.Failed(ctx, &event.CommandFailedEvent{Failure: "boom", CommandFinishedEvent: event.CommandFinishedEvent{
+		CommandName: "monitoredFind", ConnectionID: "conn", RequestID: 2, DurationNanos: int64(time.Millisecond)}})
+	parent.End()
+
+	assert.EqualValues(t, before+2, testutil.CollectAndCount(metrics.MongoCommandDuration))
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 3) {
+		for _, span := range spans[:2] {
+			assert.EqualValues(t, "mongodb.monitoredFind", span.Name())
+			assert.EqualValues(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+			assert.Contains(t, span.Attributes(), semconv.DBMongoDBCollectionKey.String(OrdersCollection))
+		}
+		assert.EqualValues(t, codes.Unset, spans[0].Status().Code)
+		assert.EqualValues(t, codes.Error, spans[1].Status().Code)
+		assert.EqualValues(t, "ordersRepo.GetById", spans[2].Name())
+	}
+}
@@ -3,8 +3,13 @@ package db
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/rs/zerolog/log"
 
+	"github.com/rameshsunkara/go-rest-api-example/internal/metrics"
 	"github.com/rameshsunkara/go-rest-api-example/internal/models"
 	"github.com/rameshsunkara/go-rest-api-example/pkg/util"
 
@@ -17,51 +22,126 @@ import (
 const (
 	OrdersCollection = "purchaseorders"
 	PageSize         = 100
+	StreamBatchSize  = 500
+)
+
+var (
+	InvalidOrderIdErr = errors.New("invalid order id")
+	OrderNotFoundErr  = errors.New("order not found")
+	InvalidFieldErr   = errors.New("invalid field")
 )
 
-// OrdersDataService  TODO: Strong type method definitions
+// OrderFields - Fields of an order that can be requested individually, mapped to their path in the collection
+var OrderFields = map[string]string{
+	"order_id":            "_id",
+	"last_updated_at":     "last_updated_at",
+	"products":            "products",
+	"products.name":       "products.name",
+	"products.updated_at": "products.updated_at",
+	"products.price":      "products.price",
+	"products.status":     "products.status",
+	"products.remarks":    "products.remarks",
+}
+
+// OrdersDataService - Every method only sees the orders the caller in ctx can see, see models.Visibility, and orders
+// outside of that are reported as not found. Orders created get the caller as owner.
+// TODO: Strong type method definitions
 type OrdersDataService interface {
 	Create(ctx context.Context, purchaseOrder interface{}) (*mongo.InsertOneResult, error)
+	CreateMany(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error)
 	Update(ctx context.Context, purchaseOrder interface{}) (int64, error)
-	GetAll(ctx context.Context) (interface{}, error)
-	GetById(ctx context.Context, id string) (interface{}, error)
+	Replace(ctx context.Context, id string, purchaseOrder interface{}, upsert bool) (bool, error)
+	GetAll(ctx context.Context, fields ...string) (interface{}, error)
+	GetById(ctx context.Context, id string, fields ...string) (interface{}, error)
+	Count(ctx context.Context, exact bool) (int64, error)
+	Stream(ctx context.Context, each func(order *models.Order) error, fields ...string) error
 	DeleteById(ctx context.Context, id string) (int64, error)
+	DeleteSeeded(ctx context.Context) (int64, error)
 }
 
 func NewOrderDataService(db MongoDatabase) OrdersDataService {
 	iDBSvc := &ordersRepo{
-		collection: db.Collection(OrdersCollection),
+		db: db,
 	}
 	return iDBSvc
 }
 
 // ordersRepo - Implements OrdersDataService
 type ordersRepo struct {
-	collection *mongo.Collection
+	db      MongoDatabase
+	indexes indexes
+}
+
+// collection - Orders collection of the client in use, see MongoManager.Database
+func (ordDataSvc *ordersRepo) collection() *mongo.Collection {
+	return ordDataSvc.db.Collection(OrdersCollection)
 }
 
 func (ordDataSvc *ordersRepo) Create(ctx context.Context, po interface{}) (*mongo.InsertOneResult, error) {
-	if vErr := validate(ordDataSvc.collection); vErr != nil {
+	if vErr := validate(ordDataSvc.collection()); vErr != nil {
 		return nil, vErr
 	}
+	ctx, span := startSpan(ctx, OrdersCollection, "ordersRepo.Create")
+	defer span.End()
+	ordDataSvc.indexes.ensure(ctx, OrdersCollection, ordDataSvc.ensureIndexes)
 	purchaseOrder := po.(*models.Order)
 	if !purchaseOrder.ID.IsZero() {
 		return nil, errors.New("invalid request")
 	}
 	purchaseOrder.LastUpdatedAt = util.CurrentISOTime()
+	stamp(ctx, purchaseOrder)
 
-	result, err := ordDataSvc.collection.InsertOne(ctx, purchaseOrder)
+	result, err := ordDataSvc.collection().InsertOne(ctx, purchaseOrder)
 	if err != nil {
 		return nil, err
 	}
+	metrics.OrdersCreated.Inc()
 	return result, nil
 }
 
+// CreateMany - Inserts the orders in a single round trip. Orders are inserted independently of each other, so one
+// failing (e.g. duplicate id) doesn't stop the others; a mongo.BulkWriteException tells which ones failed.
+func (ordDataSvc *ordersRepo) CreateMany(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error) {
+	if vErr := validate(ordDataSvc.collection()); vErr != nil {
+		return nil, vErr
+	}
+	ctx, span := startSpan(ctx, OrdersCollection, "ordersRepo.CreateMany")
+	defer span.End()
+	if len(purchaseOrders) == 0 {
+		return &mongo.InsertManyResult{}, nil
+	}
+	ordDataSvc.indexes.ensure(ctx, OrdersCollection, ordDataSvc.ensureIndexes)
+
+	now := util.CurrentISOTime()
+	docs := make([]interface{}, len(purchaseOrders))
+	for i, purchaseOrder := range purchaseOrders {
+		// Bulk loads can carry their own history
+		if purchaseOrder.LastUpdatedAt == "" {
+			purchaseOrder.LastUpdatedAt = now
+		}
+		stamp(ctx, purchaseOrder)
+		docs[i] = purchaseOrder
+	}
+	result, err := ordDataSvc.collection().InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if result != nil {
+		// Ids are listed for every order, including those which failed
+		created := len(result.InsertedIDs)
+		var bulkErr mongo.BulkWriteException
+		if errors.As(err, &bulkErr) {
+			created -= len(bulkErr.WriteErrors)
+		}
+		metrics.OrdersCreated.Add(float64(created))
+	}
+	return result, err
+}
+
 // Update - Create and Update can be merged using upsert, but this is to demonstrate CRUD rest API so ...
 func (ordDataSvc *ordersRepo) Update(ctx context.Context, po interface{}) (int64, error) {
-	if vErr := validate(ordDataSvc.collection); vErr != nil {
+	if vErr := validate(ordDataSvc.collection()); vErr != nil {
 		return 0, vErr
 	}
+	ctx, span := startSpan(ctx, OrdersCollection, "ordersRepo.Update")
+	defer span.End()
 
 	purchaseOrder := po.(*models.Order)
 	if primitive.ObjectID.IsZero(purchaseOrder.ID) || !primitive.IsValidObjectID(purchaseOrder.ID.Hex()) {
@@ -71,37 +151,121 @@ func (ordDataSvc *ordersRepo) Update(ctx context.Context, po interface{}) (int64
 	purchaseOrder.LastUpdatedAt = util.CurrentISOTime()
 
 	opts := options.Update().SetUpsert(true)
-	filter := bson.D{primitive.E{Key: "_id", Value: purchaseOrder.ID}}
-	update := bson.D{primitive.E{Key: "$set", Value: purchaseOrder}}
-	result, err := ordDataSvc.collection.UpdateOne(ctx, filter, update, opts)
+	filter := visibleTo(ctx, bson.D{primitive.E{Key: "_id", Value: purchaseOrder.ID}})
+	update := bson.D{}
+	if p := models.PrincipalFromContext(ctx); p != nil {
+		// Ownership never changes, and is the caller's for a new order
+		purchaseOrder.Owner, purchaseOrder.Org = "", ""
+		update = append(update, primitive.E{Key: "$setOnInsert", Value: bson.D{
+			primitive.E{Key: "owner", Value: p.Subject},
+			primitive.E{Key: "org", Value: p.Org},
+		}})
+	}
+	update = append(update, primitive.E{Key: "$set", Value: purchaseOrder})
+	result, err := ordDataSvc.collection().UpdateOne(ctx, filter, update, opts)
 
 	if err != nil {
-		log.Err(err).Msg("Error occurred while updating order")
+		// The order exists, out of the caller's sight
+		if mongo.IsDuplicateKeyError(err) {
+			return 0, OrderNotFoundErr
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("Error occurred while updating order")
+		return 0, err
 	}
 
 	if result.MatchedCount != 0 {
-		log.Info().Msg("matched and replaced an existing document")
+		log.Ctx(ctx).Info().Msg("matched and replaced an existing document")
+		metrics.OrdersUpdated.Inc()
 		return result.MatchedCount, nil
 	}
 
 	if result.UpsertedCount != 0 {
-		log.Info().Msg("inserted a new order with ID")
+		log.Ctx(ctx).Info().Msg("inserted a new order with ID")
+		metrics.OrdersCreated.Inc()
 		return result.MatchedCount, nil
 	}
 
 	return 0, nil
 }
 
-func (ordDataSvc *ordersRepo) GetAll(ctx context.Context) (interface{}, error) {
-	if vErr := validate(ordDataSvc.collection); vErr != nil {
+// Replace - Replaces the whole order identified by id. When upsert is set and no such order exists, it is created with
+// the given id. Returns true if a new order was created.
+func (ordDataSvc *ordersRepo) Replace(ctx context.Context, id string, po interface{}, upsert bool) (bool, error) {
+	if vErr := validate(ordDataSvc.collection()); vErr != nil {
+		return false, vErr
+	}
+	ctx, span := startSpan(ctx, OrdersCollection, "ordersRepo.Replace")
+	defer span.End()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, InvalidOrderIdErr
+	}
+
+	purchaseOrder := po.(*models.Order)
+	purchaseOrder.ID = docID
+	purchaseOrder.LastUpdatedAt = util.CurrentISOTime()
+	filter := visibleTo(ctx, bson.D{primitive.E{Key: "_id", Value: docID}})
+
+	// Ownership never changes, and is the caller's for a new order
+	var existing models.Order
+	ownerOpts := options.FindOne().SetProjection(bson.D{
+		primitive.E{Key: "owner", Value: 1},
+		primitive.E{Key: "org", Value: 1},
+	})
+	err = ordDataSvc.collection().FindOne(ctx, filter, ownerOpts).Decode(&existing)
+	switch {
+	case err == nil:
+		purchaseOrder.Owner, purchaseOrder.Org = existing.Owner, existing.Org
+	case errors.Is(err, mongo.ErrNoDocuments):
+		stamp(ctx, purchaseOrder)
+	default:
+		return false, err
+	}
+
+	opts := options.Replace().SetUpsert(upsert)
+	result, err := ordDataSvc.collection().ReplaceOne(ctx, filter, purchaseOrder, opts)
+	if err != nil {
+		// The order exists, out of the caller's sight
+		if mongo.IsDuplicateKeyError(err) {
+			return false, OrderNotFoundErr
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("Error occurred while replacing order")
+		return false, err
+	}
+
+	if result.UpsertedCount != 0 {
+		metrics.OrdersCreated.Inc()
+		return true, nil
+	}
+	if result.MatchedCount == 0 {
+		return false, OrderNotFoundErr
+	}
+	metrics.OrdersUpdated.Inc()
+	return false, nil
+}
+
+func (ordDataSvc *ordersRepo) GetAll(ctx context.Context, fields ...string) (interface{}, error) {
+	if vErr := validate(ordDataSvc.collection()); vErr != nil {
 		return nil, vErr
 	}
+	ctx, span := startSpan(ctx, OrdersCollection, "ordersRepo.GetAll")
+	defer span.End()
+	proj, pErr := projection(fields)
+	if pErr != nil {
+		return nil, pErr
+	}
+
+	ordDataSvc.indexes.ensure(ctx, OrdersCollection, ordDataSvc.ensureIndexes)
 
-	filter := bson.M{}
+	filter := visibleTo(ctx, bson.D{})
 	options := options.Find()
 	options.SetLimit(PageSize)
+	if proj != nil {
+		options.SetProjection(proj)
+	}
 
-	cursor, err := ordDataSvc.collection.Find(ctx, filter, options)
+	cursor, err := ordDataSvc.collection().Find(ctx, filter, options)
 	if err != nil {
 		return nil, err
 	}
@@ -113,19 +277,30 @@ func (ordDataSvc *ordersRepo) GetAll(ctx context.Context) (interface{}, error) {
 	return &results, nil
 }
 
-func (ordDataSvc *ordersRepo) GetById(ctx context.Context, id string) (interface{}, error) {
-	if vErr := validate(ordDataSvc.collection); vErr != nil {
+func (ordDataSvc *ordersRepo) GetById(ctx context.Context, id string, fields ...string) (interface{}, error) {
+	if vErr := validate(ordDataSvc.collection()); vErr != nil {
 		return nil, vErr
 	}
+	ctx, span := startSpan(ctx, OrdersCollection, "ordersRepo.GetById")
+	defer span.End()
+	proj, pErr := projection(fields)
+	if pErr != nil {
+		return nil, pErr
+	}
 
 	docID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, errors.New("bad request")
+		return nil, InvalidOrderIdErr
+	}
+	filter := visibleTo(ctx, bson.D{primitive.E{Key: "_id", Value: docID}})
+
+	opts := options.FindOne()
+	if proj != nil {
+		opts.SetProjection(proj)
 	}
-	filter := bson.D{primitive.E{Key: "_id", Value: docID}}
 
 	var result models.Order
-	error := ordDataSvc.collection.FindOne(ctx, filter).Decode(&result)
+	error := ordDataSvc.collection().FindOne(ctx, filter, opts).Decode(&result)
 	if error != nil {
 		if error == mongo.ErrNoDocuments {
 			return nil, nil
@@ -136,25 +311,167 @@ func (ordDataSvc *ordersRepo) GetById(ctx context.Context, id string) (interface
 	return &result, nil
 }
 
+// Stream - Hands every order to each as it is read from the cursor, so that all of them are never held in memory.
+// Stops at the first error returned by each, or when ctx is done.
+func (ordDataSvc *ordersRepo) Stream(ctx context.Context, each func(order *models.Order) error, fields ...string) error {
+	if vErr := validate(ordDataSvc.collection()); vErr != nil {
+		return vErr
+	}
+	ctx, span := startSpan(ctx, OrdersCollection, "ordersRepo.Stream")
+	defer span.End()
+	proj, pErr := projection(fields)
+	if pErr != nil {
+		return pErr
+	}
+
+	opts := options.Find().SetBatchSize(StreamBatchSize)
+	if proj != nil {
+		opts.SetProjection(proj)
+	}
+	ordDataSvc.indexes.ensure(ctx, OrdersCollection, ordDataSvc.ensureIndexes)
+	cursor, err := ordDataSvc.collection().Find(ctx, visibleTo(ctx, bson.D{}), opts)
+	if err != nil {
+		return err
+	}
+	// ctx may already be cancelled, the cursor must be closed on the server regardless
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(ctx) {
+		// Next only notices cancellation when fetching the next batch
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var order models.Order
+		if err := cursor.Decode(&order); err != nil {
+			return err
+		}
+		if err := each(&order); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// Count - Number of orders, either counted exactly or estimated from collection metadata which is much cheaper. Only
+// callers seeing every order get estimates, as the metadata can't tell whose orders they are.
+func (ordDataSvc *ordersRepo) Count(ctx context.Context, exact bool) (int64, error) {
+	if vErr := validate(ordDataSvc.collection()); vErr != nil {
+		return 0, vErr
+	}
+	ctx, span := startSpan(ctx, OrdersCollection, "ordersRepo.Count")
+	defer span.End()
+
+	if filter := visibleTo(ctx, bson.D{}); exact || len(filter) > 0 {
+		return ordDataSvc.collection().CountDocuments(ctx, filter)
+	}
+	return ordDataSvc.collection().EstimatedDocumentCount(ctx)
+}
+
 func (ordDataSvc *ordersRepo) DeleteById(ctx context.Context, id string) (int64, error) {
-	if vErr := validate(ordDataSvc.collection); vErr != nil {
+	if vErr := validate(ordDataSvc.collection()); vErr != nil {
 		return 0, vErr
 	}
+	ctx, span := startSpan(ctx, OrdersCollection, "ordersRepo.DeleteById")
+	defer span.End()
 
 	docID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return 0, errors.New("bad request")
+		return 0, InvalidOrderIdErr
 	}
-	filter := bson.D{primitive.E{Key: "_id", Value: docID}}
+	filter := visibleTo(ctx, bson.D{primitive.E{Key: "_id", Value: docID}})
 
-	res, error := ordDataSvc.collection.DeleteOne(ctx, filter)
+	res, error := ordDataSvc.collection().DeleteOne(ctx, filter)
 	if error != nil {
 		return 0, error
 	}
+	metrics.OrdersDeleted.Add(float64(res.DeletedCount))
+
+	return res.DeletedCount, nil
+}
+
+// DeleteSeeded - Deletes the fake orders inserted to seed the DB
+func (ordDataSvc *ordersRepo) DeleteSeeded(ctx context.Context) (int64, error) {
+	if vErr := validate(ordDataSvc.collection()); vErr != nil {
+		return 0, vErr
+	}
+	ctx, span := startSpan(ctx, OrdersCollection, "ordersRepo.DeleteSeeded")
+	defer span.End()
 
+	res, err := ordDataSvc.collection().DeleteMany(ctx, visibleTo(ctx, bson.D{primitive.E{Key: "seeded", Value: true}}))
+	if err != nil {
+		return 0, err
+	}
+	metrics.OrdersDeleted.Add(float64(res.DeletedCount))
 	return res.DeletedCount, nil
 }
 
+// ensureIndexes - Speeds up finding the orders of a caller or an organization
+func (ordDataSvc *ordersRepo) ensureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{primitive.E{Key: "owner", Value: 1}}},
+		{Keys: bson.D{primitive.E{Key: "org", Value: 1}}},
+	}
+	_, err := ordDataSvc.collection().Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// visibleTo - Adds to filter the condition on the orders, or jobs, the caller in ctx can see. Every query on behalf of
+// a caller goes through it, so that no endpoint can forget it. Without a caller, i.e. authentication disabled or
+// background work such as seeding, everything is visible.
+func visibleTo(ctx context.Context, filter bson.D) bson.D {
+	p := models.PrincipalFromContext(ctx)
+	switch {
+	case p == nil || p.Visibility == models.VisibilityAll:
+		return filter
+	case p.Visibility == models.VisibilityOrg && p.Org != "":
+		return append(filter, primitive.E{Key: "org", Value: p.Org})
+	default:
+		return append(filter, primitive.E{Key: "owner", Value: p.Subject})
+	}
+}
+
+// stamp - Makes the caller in ctx the owner of the order
+func stamp(ctx context.Context, order *models.Order) {
+	if p := models.PrincipalFromContext(ctx); p != nil {
+		order.Owner, order.Org = p.Subject, p.Org
+	}
+}
+
+// projection - Translates the requested fields into a projection, nil when no fields are requested i.e. all are wanted
+func projection(fields []string) (bson.D, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	paths := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		path, ok := OrderFields[f]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", InvalidFieldErr, f)
+		}
+		paths[path] = true
+	}
+
+	// Sort for a stable projection, and drop sub fields of requested fields as Mongo rejects such path collisions
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	proj := bson.D{}
+	if !paths["_id"] {
+		proj = append(proj, primitive.E{Key: "_id", Value: 0})
+	}
+	for _, path := range sorted {
+		if parent, _, nested := strings.Cut(path, "."); nested && paths[parent] {
+			continue
+		}
+		proj = append(proj, primitive.E{Key: path, Value: 1})
+	}
+	return proj, nil
+}
+
 func validate(collection *mongo.Collection) error {
 	if collection == nil {
 		return errors.New("collection is not defined")
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestProjection(t *testing.T) {
+	type projectionTestCase struct {
+		Description string
+		Input       []string
+		Expected    bson.D
+		ExpectedErr error
+	}
+
+	var testCases = []projectionTestCase{
+		{
+			Description: "expect no projection when no fields are requested",
+			Input:       nil,
+			Expected:    nil,
+		},
+		{
+			Description: "expect _id to be excluded unless requested",
+			Input:       []string{"last_updated_at", "products.name"},
+			Expected: bson.D{
+				primitive.E{Key: "_id", Value: 0},
+				primitive.E{Key: "last_updated_at", Value: 1},
+				primitive.E{Key: "products.name", Value: 1},
+			},
+		},
+		{
+			Description: "expect order_id to be mapped to _id",
+			Input:       []string{"order_id", "products.price"},
+			Expected: bson.D{
+				primitive.E{Key: "_id", Value: 1},
+				primitive.E{Key: "products.price", Value: 1},
+			},
+		},
+		{
+			Description: "expect sub fields to be dropped when their parent is requested",
+			Input:       []string{"products.name", "products", "products.name"},
+			Expected: bson.D{
+				primitive.E{Key: "_id", Value: 0},
+				primitive.E{Key: "products", Value: 1},
+			},
+		},
+		{
+			Description: "expect error for unknown fields",
+			Input:       []string{"order_id", "customer"},
+			ExpectedErr: InvalidFieldErr,
+		},
+	}
+
+	for i, tc := range testCases {
+		got, err := projection(tc.Input)
+		if !errors.Is(err, tc.ExpectedErr) {
+			t.Errorf("TestProjection test case %d:%s failed: expected %v; got %v", i, tc.Description, tc.ExpectedErr, err)
+		}
+		assert.Equal(t, tc.Expected, got, tc.Description)
+	}
+}
+
+func TestVisibleTo(t *testing.T) {
+	id := bson.D{primitive.E{Key: "_id", Value: 1}}
+
+	type visibleToTestCase struct {
+		Description string
+		Principal   *models.Principal
+		Expected    bson.D
+	}
+
+	var testCases = []visibleToTestCase{
+		{"no caller sees everything", nil, id},
+		{"own orders", &models.Principal{Subject: "alice", Org: "acme"},
+			append(id, primitive.E{Key: "owner", Value: "alice"})},
+		{"orders of the organization", &models.Principal{Subject: "alice", Org: "acme", Visibility: models.VisibilityOrg},
+			append(id, primitive.E{Key: "org", Value: "acme"})},
+		{"no organization", &models.Principal{Subject: "alice", Visibility: models.VisibilityOrg},
+			append(id, primitive.E{Key: "owner", Value: "alice"})},
+		{"every order", &models.Principal{Subject: "root", Visibility: models.VisibilityAll}, id},
+	}
+
+	for _, tc := range testCases {
+		ctx := context.Background()
+		if tc.Principal != nil {
+			ctx = models.ContextWithPrincipal(ctx, tc.Principal)
+		}
+		filter := append(bson.D{}, id...)
+		assert.Equal(t, tc.Expected, visibleTo(ctx, filter), tc.Description)
+	}
+}
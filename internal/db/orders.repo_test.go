@@ -10,6 +10,7 @@ import (
 	"github.com/rameshsunkara/go-rest-api-example/internal/models"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var orderId primitive.ObjectID
@@ -75,6 +76,53 @@ func TestCreate_InvalidReq(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestCreateManySuccess(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderDataService(d)
+	pos := []*models.Order{
+		{Products: []models.Product{{Name: faker.Name(), Price: (uint)(rand.Intn(90) + 10)}}},
+		{Products: []models.Product{{Name: faker.Name(), Price: (uint)(rand.Intn(90) + 10)}}},
+	}
+	result, err := dSvc.CreateMany(context.TODO(), pos)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, len(result.InsertedIDs))
+}
+
+func TestCreateMany_Duplicate(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderDataService(d)
+	id := primitive.NewObjectID()
+	pos := []*models.Order{
+		{ID: id, Products: []models.Product{{Name: faker.Name(), Price: 10}}},
+		{ID: id, Products: []models.Product{{Name: faker.Name(), Price: 20}}},
+		{Products: []models.Product{{Name: faker.Name(), Price: 30}}},
+	}
+	result, err := dSvc.CreateMany(context.TODO(), pos)
+	var bulkErr mongo.BulkWriteException
+	assert.ErrorAs(t, err, &bulkErr)
+	assert.EqualValues(t, 1, bulkErr.WriteErrors[0].Index)
+	assert.EqualValues(t, 2, len(result.InsertedIDs))
+}
+
+func TestDeleteSeededSuccess(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderDataService(d)
+	pos := []*models.Order{
+		{Products: []models.Product{{Name: faker.Name(), Price: 10}}, Seeded: true, LastUpdatedAt: "2022-01-01T00:00:00Z"},
+		{Products: []models.Product{{Name: faker.Name(), Price: 20}}},
+	}
+	result, err := dSvc.CreateMany(context.TODO(), pos)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "2022-01-01T00:00:00Z", pos[0].LastUpdatedAt)
+
+	count, err := dSvc.DeleteSeeded(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, count >= 1)
+	order, err := dSvc.GetById(context.TODO(), result.InsertedIDs[1].(primitive.ObjectID).Hex())
+	assert.NoError(t, err)
+	assert.NotNil(t, order)
+}
+
 func TestUpdateSuccess(t *testing.T) {
 	d := testDBMgr.Database()
 	dSvc := db.NewOrderDataService(d)
@@ -117,6 +165,52 @@ func TestUpdate_InvalidId(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestReplaceSuccess(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderDataService(d)
+	po := &models.Order{
+		Products: []models.Product{{Name: faker.Name(), Price: 10}},
+	}
+	created, err := dSvc.Replace(context.TODO(), orderId.Hex(), po, false)
+	assert.Nil(t, err)
+	assert.False(t, created)
+	assert.EqualValues(t, orderId, po.ID)
+}
+
+func TestReplace_NotFound(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderDataService(d)
+	po := &models.Order{
+		Products: []models.Product{{Name: faker.Name(), Price: 10}},
+	}
+	created, err := dSvc.Replace(context.TODO(), primitive.NewObjectID().Hex(), po, false)
+	assert.ErrorIs(t, err, db.OrderNotFoundErr)
+	assert.False(t, created)
+}
+
+func TestReplace_Upsert(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderDataService(d)
+	po := &models.Order{
+		Products: []models.Product{{Name: faker.Name(), Price: 10}},
+	}
+	id := primitive.NewObjectID()
+	created, err := dSvc.Replace(context.TODO(), id.Hex(), po, true)
+	assert.Nil(t, err)
+	assert.True(t, created)
+
+	result, _ := dSvc.GetById(context.TODO(), id.Hex())
+	assert.EqualValues(t, id, result.(*models.Order).ID)
+}
+
+func TestReplace_InvalidId(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderDataService(d)
+	created, err := dSvc.Replace(context.TODO(), "i-am-an-invalid-id", &models.Order{}, true)
+	assert.ErrorIs(t, err, db.InvalidOrderIdErr)
+	assert.False(t, created)
+}
+
 func TestGetAllSuccess(t *testing.T) {
 	d := testDBMgr.Database()
 	dSvc := db.NewOrderDataService(d)
@@ -125,6 +219,47 @@ func TestGetAllSuccess(t *testing.T) {
 	assert.EqualValues(t, 100, len(*orders))
 }
 
+func TestCountSuccess(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderDataService(d)
+	exact, err := dSvc.Count(context.TODO(), true)
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, exact, int64(500))
+
+	estimated, err := dSvc.Count(context.TODO(), false)
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, estimated, int64(500))
+}
+
+func TestStreamSuccess(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderDataService(d)
+	total, _ := dSvc.Count(context.TODO(), true)
+	streamed := int64(0)
+	err := dSvc.Stream(context.TODO(), func(order *models.Order) error {
+		assert.True(t, order.ID.IsZero())
+		assert.NotEmpty(t, order.Products)
+		streamed++
+		return nil
+	}, "products.name")
+	assert.Nil(t, err)
+	assert.EqualValues(t, total, streamed)
+}
+
+func TestStream_Cancelled(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderDataService(d)
+	ctx, cancel := context.WithCancel(context.TODO())
+	streamed := 0
+	err := dSvc.Stream(ctx, func(order *models.Order) error {
+		streamed++
+		cancel()
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.EqualValues(t, 1, streamed)
+}
+
 func TestGetByIdSuccess(t *testing.T) {
 	d := testDBMgr.Database()
 	dSvc := db.NewOrderDataService(d)
@@ -175,3 +310,46 @@ func TestDeleteById_InvalidId(t *testing.T) {
 	assert.EqualValues(t, 0, result)
 	assert.Error(t, err)
 }
+
+func TestOrderVisibility(t *testing.T) {
+	dSvc := db.NewOrderDataService(testDBMgr.Database())
+	alice := models.ContextWithPrincipal(context.TODO(), &models.Principal{Subject: "alice", Org: "acme"})
+	bob := models.ContextWithPrincipal(context.TODO(),
+		&models.Principal{Subject: "bob", Org: "acme", Visibility: models.VisibilityOrg})
+	eve := models.ContextWithPrincipal(context.TODO(), &models.Principal{Subject: "eve", Org: "evil"})
+	admin := models.ContextWithPrincipal(context.TODO(),
+		&models.Principal{Subject: "root", Visibility: models.VisibilityAll})
+
+	order := &models.Order{Owner: "mallory", Products: []models.Product{{Name: "pen", Price: 1}}}
+	result, err := dSvc.Create(alice, order)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "alice", order.Owner)
+	assert.EqualValues(t, "acme", order.Org)
+	id := result.InsertedID.(primitive.ObjectID).Hex()
+
+	for _, ctx := range []context.Context{alice, bob, admin} {
+		found, err := dSvc.GetById(ctx, id)
+		assert.Nil(t, err)
+		assert.NotNil(t, found)
+	}
+	found, err := dSvc.GetById(eve, id)
+	assert.Nil(t, err)
+	assert.Nil(t, found)
+
+	// Out of sight is the same as not existing, even with upsert
+	_, err = dSvc.Replace(eve, id, &models.Order{Products: order.Products}, true)
+	assert.ErrorIs(t, err, db.OrderNotFoundErr)
+	deleted, err := dSvc.DeleteById(eve, id)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, deleted)
+
+	// Replacing keeps the owner
+	_, err = dSvc.Replace(admin, id, &models.Order{Products: order.Products}, false)
+	assert.Nil(t, err)
+	replaced, _ := dSvc.GetById(alice, id)
+	assert.EqualValues(t, "alice", replaced.(*models.Order).Owner)
+
+	count, err := dSvc.Count(eve, false)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, count)
+}
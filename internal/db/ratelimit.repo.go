@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/ratelimit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const RateLimitCollection = "ratelimits"
+
+// rateLimitRecord - Bucket of a client, versioned so that replicas updating it at once don't overwrite each other
+type rateLimitRecord struct {
+	Key     string           `bson:"_id"`
+	Bucket  ratelimit.Bucket `bson:"bucket"`
+	Version int64            `bson:"version"`
+	// ExpiresAt - When the bucket is full again, and can be deleted
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// NewRateLimitState - Buckets shared by the replicas through the DB, see ratelimit.SharedStore
+func NewRateLimitState(db MongoDatabase) ratelimit.SharedState {
+	return &rateLimitRepo{
+		db: db,
+	}
+}
+
+// rateLimitRepo - Implements ratelimit.SharedState
+type rateLimitRepo struct {
+	db      MongoDatabase
+	indexes indexes
+}
+
+// collection - Rate limit collection of the client in use, see MongoManager.Database
+func (r *rateLimitRepo) collection() *mongo.Collection {
+	return r.db.Collection(RateLimitCollection)
+}
+
+func (r *rateLimitRepo) Get(ctx context.Context, key string) (*ratelimit.Bucket, int64, error) {
+	if vErr := validate(r.collection()); vErr != nil {
+		return nil, 0, vErr
+	}
+	r.indexes.ensure(ctx, RateLimitCollection, r.ensureIndexes)
+
+	var record rateLimitRecord
+	err := r.collection().FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: key}}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	// Expired but not deleted yet: full again, and replaced by its version
+	if !time.Now().Before(record.ExpiresAt) {
+		return nil, record.Version, nil
+	}
+	return &record.Bucket, record.Version, nil
+}
+
+func (r *rateLimitRepo) CompareAndSwap(ctx context.Context, key string, version int64, b ratelimit.Bucket,
+	ttl time.Duration) (bool, error) {
+	if vErr := validate(r.collection()); vErr != nil {
+		return false, vErr
+	}
+
+	record := rateLimitRecord{Key: key, Bucket: b, Version: version + 1, ExpiresAt: time.Now().UTC().Add(ttl)}
+	if version == 0 {
+		_, err := r.collection().InsertOne(ctx, record)
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	filter := bson.D{primitive.E{Key: "_id", Value: key}, primitive.E{Key: "version", Value: version}}
+	res, err := r.collection().ReplaceOne(ctx, filter, record)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// ensureIndexes - Lets Mongo delete the buckets once they are full again
+func (r *rateLimitRepo) ensureIndexes(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{primitive.E{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	_, err := r.collection().Indexes().CreateOne(ctx, index)
+	return err
+}
@@ -0,0 +1,38 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitCompareAndSwap(t *testing.T) {
+	state := db.NewRateLimitState(testDBMgr.Database())
+	const key = "test-client"
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	b, version, err := state.Get(context.TODO(), key)
+	assert.Nil(t, err)
+	assert.Nil(t, b)
+	assert.EqualValues(t, 0, version)
+
+	swapped, err := state.CompareAndSwap(context.TODO(), key, 0, ratelimit.Bucket{Tokens: 4, Updated: now}, time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, swapped)
+	// Another replica updated it first
+	swapped, err = state.CompareAndSwap(context.TODO(), key, 0, ratelimit.Bucket{Tokens: 3, Updated: now}, time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, swapped)
+
+	b, version, err = state.Get(context.TODO(), key)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 4, b.Tokens)
+	swapped, err = state.CompareAndSwap(context.TODO(), key, version, ratelimit.Bucket{Tokens: 3, Updated: now},
+		time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, swapped)
+}
@@ -0,0 +1,20 @@
+package db
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer - Spans of the repositories and of the commands they send to MongoDB
+var tracer = otel.Tracer("github.com/rameshsunkara/go-rest-api-example/internal/db")
+
+// startSpan - Span of a repository method, the commands it sends become its children
+func startSpan(ctx context.Context, collection string, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(
+		semconv.DBSystemMongoDB,
+		semconv.DBMongoDBCollectionKey.String(collection),
+	))
+}
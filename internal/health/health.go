@@ -0,0 +1,273 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultInterval = 10 * time.Second
+	DefaultTimeout  = 2 * time.Second
+)
+
+var CheckTimeoutErr = errors.New("health check timed out")
+
+type Status string
+
+const (
+	StatusUp      Status = "ok"
+	StatusDown    Status = "down"
+	StatusPending Status = "pending"
+)
+
+// HealthChecker - A dependency the service can't serve requests without. Check must give up once ctx is done.
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type checkerFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (c *checkerFunc) Name() string {
+	return c.name
+}
+
+func (c *checkerFunc) Check(ctx context.Context) error {
+	return c.check(ctx)
+}
+
+// NewChecker - HealthChecker named name, healthy as long as check returns no error
+func NewChecker(name string, check func(ctx context.Context) error) HealthChecker {
+	return &checkerFunc{name: name, check: check}
+}
+
+// Result - Outcome of the last run of a check
+type Result struct {
+	Name        string     `json:"name"`
+	Status      Status     `json:"status"`
+	Latency     string     `json:"latency,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	CheckedAt   *time.Time `json:"checked_at,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+type check struct {
+	checker HealthChecker
+	timeout time.Duration
+	result  Result
+}
+
+type Option func(*Monitor)
+
+// WithInterval - How often the checks are run in the background
+func WithInterval(d time.Duration) Option {
+	return WithIntervalFunc(func() time.Duration {
+		return d
+	})
+}
+
+// WithIntervalFunc - How often the checks are run in the background, asked again after every run so that it can change
+// while the monitor runs
+func WithIntervalFunc(interval func() time.Duration) Option {
+	return func(m *Monitor) {
+		m.interval = interval
+	}
+}
+
+// Monitor - Runs the registered checks in the background and keeps their last results, so that probes and status
+// requests never wait for, nor add load to, the dependencies.
+type Monitor struct {
+	interval func() time.Duration
+
+	mu           sync.RWMutex
+	checks       []*check
+	pending      map[string]bool
+	shuttingDown bool
+}
+
+func NewMonitor(opts ...Option) *Monitor {
+	m := &Monitor{
+		pending: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// nextInterval - Time until the checks run again, DefaultInterval unless a positive one is set
+func (m *Monitor) nextInterval() time.Duration {
+	if m.interval != nil {
+		if d := m.interval(); d > 0 {
+			return d
+		}
+	}
+	return DefaultInterval
+}
+
+// Register - Adds a check, which fails when it takes longer than timeout (DefaultTimeout when 0). It is pending, so
+// the service is not ready, until it first runs.
+func (m *Monitor) Register(checker HealthChecker, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checks = append(m.checks, &check{
+		checker: checker,
+		timeout: timeout,
+		result:  Result{Name: checker.Name(), Status: StatusPending},
+	})
+}
+
+// StartupTask - Keeps the service from being ready until the returned func is called, once the task named name is done
+func (m *Monitor) StartupTask(name string) (done func()) {
+	m.mu.Lock()
+	m.pending[name] = true
+	m.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			delete(m.pending, name)
+			m.mu.Unlock()
+			log.Info().Str("task", name).Msg("startup task done")
+		})
+	}
+}
+
+// ShuttingDown - The service is not ready anymore, whatever its checks, as it is about to stop
+func (m *Monitor) ShuttingDown() {
+	m.mu.Lock()
+	m.shuttingDown = true
+	m.mu.Unlock()
+	log.Info().Msg("not ready anymore, shutting down")
+}
+
+// Start - Runs the checks right away and then every interval, until ctx is done
+func (m *Monitor) Start(ctx context.Context) {
+	go func() {
+		for {
+			m.Refresh(ctx)
+			timer := time.NewTimer(m.nextInterval())
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// Refresh - Runs every check at once, each within its timeout, and records the results
+func (m *Monitor) Refresh(ctx context.Context) {
+	m.mu.RLock()
+	checks := append([]*check(nil), m.checks...)
+	m.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c *check) {
+			defer wg.Done()
+			start := time.Now()
+			err := run(ctx, c)
+			m.record(c, start, err)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// run - Runs the check, not waiting beyond its timeout even when the checker ignores its context
+func run(ctx context.Context, c *check) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.checker.Check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return CheckTimeoutErr
+	}
+}
+
+func (m *Monitor) record(c *check, start time.Time, err error) {
+	now := time.Now().UTC()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous := c.result.Status
+	c.result.Latency = now.Sub(start.UTC()).String()
+	c.result.CheckedAt = &now
+	if err != nil {
+		c.result.Status = StatusDown
+		c.result.LastError = err.Error()
+		if previous != StatusDown {
+			log.Error().Err(err).Str("check", c.result.Name).Msg("health check failed")
+		}
+		return
+	}
+	c.result.Status = StatusUp
+	c.result.LastSuccess = &now
+	if previous == StatusDown {
+		log.Info().Str("check", c.result.Name).Msg("health check recovered")
+	}
+}
+
+// Results - Last result of every check, in the order they were registered
+func (m *Monitor) Results() []Result {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	results := make([]Result, len(m.checks))
+	for i, c := range m.checks {
+		results[i] = c.result
+	}
+	return results
+}
+
+// Healthy - Whether every check passed the last time it ran
+func (m *Monitor) Healthy() bool {
+	for _, r := range m.Results() {
+		if r.Status != StatusUp {
+			return false
+		}
+	}
+	return true
+}
+
+// Ready - Whether the service can take requests: its startup tasks are done, every check passed the last time it ran
+// and it is not shutting down. Otherwise, lists the tasks and checks it is waiting for, or the shutdown.
+func (m *Monitor) Ready() (bool, []string) {
+	var waiting []string
+	m.mu.RLock()
+	if m.shuttingDown {
+		m.mu.RUnlock()
+		return false, []string{"shutdown"}
+	}
+	for task := range m.pending {
+		waiting = append(waiting, task)
+	}
+	m.mu.RUnlock()
+	sort.Strings(waiting)
+
+	for _, r := range m.Results() {
+		if r.Status != StatusUp {
+			waiting = append(waiting, r.Name)
+		}
+	}
+	return len(waiting) == 0, waiting
+}
@@ -0,0 +1,139 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefresh(t *testing.T) {
+	failing := errors.New("connection refused")
+	var calls int32
+	m := NewMonitor()
+	m.Register(NewChecker("up", func(ctx context.Context) error {
+		return nil
+	}), 0)
+	m.Register(NewChecker("down", func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return failing
+		}
+		return nil
+	}), time.Second)
+	m.Register(NewChecker("stuck", func(ctx context.Context) error {
+		// Ignores its context
+		time.Sleep(time.Second)
+		return nil
+	}), 10*time.Millisecond)
+
+	for _, r := range m.Results() {
+		assert.EqualValues(t, StatusPending, r.Status, r.Name)
+	}
+	assert.False(t, m.Healthy())
+
+	start := time.Now()
+	m.Refresh(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	results := m.Results()
+	assert.EqualValues(t, []string{"up", "down", "stuck"}, []string{results[0].Name, results[1].Name, results[2].Name})
+	assert.EqualValues(t, StatusUp, results[0].Status)
+	assert.NotNil(t, results[0].LastSuccess)
+	assert.NotEmpty(t, results[0].Latency)
+	assert.EqualValues(t, StatusDown, results[1].Status)
+	assert.EqualValues(t, failing.Error(), results[1].LastError)
+	assert.Nil(t, results[1].LastSuccess)
+	assert.EqualValues(t, StatusDown, results[2].Status)
+	assert.EqualValues(t, CheckTimeoutErr.Error(), results[2].LastError)
+	assert.False(t, m.Healthy())
+
+	m.Refresh(context.Background())
+	results = m.Results()
+	assert.EqualValues(t, StatusUp, results[1].Status)
+	// The last error is kept for troubleshooting
+	assert.EqualValues(t, failing.Error(), results[1].LastError)
+	assert.NotNil(t, results[1].LastSuccess)
+}
+
+func TestReady(t *testing.T) {
+	m := NewMonitor()
+	m.Register(NewChecker("mongodb", func(ctx context.Context) error {
+		return nil
+	}), 0)
+	migrated := m.StartupTask("migrations")
+	warmed := m.StartupTask("cache")
+
+	ready, waiting := m.Ready()
+	assert.False(t, ready)
+	assert.EqualValues(t, []string{"cache", "migrations", "mongodb"}, waiting)
+
+	m.Refresh(context.Background())
+	migrated()
+	migrated()
+	ready, waiting = m.Ready()
+	assert.False(t, ready)
+	assert.EqualValues(t, []string{"cache"}, waiting)
+
+	warmed()
+	ready, waiting = m.Ready()
+	assert.True(t, ready)
+	assert.Empty(t, waiting)
+
+	m.ShuttingDown()
+	ready, waiting = m.Ready()
+	assert.False(t, ready)
+	assert.EqualValues(t, []string{"shutdown"}, waiting)
+	// Still healthy, only on its way out
+	assert.True(t, m.Healthy())
+}
+
+func TestStart(t *testing.T) {
+	var calls int32
+	m := NewMonitor(WithInterval(10 * time.Millisecond))
+	m.Register(NewChecker("mongodb", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}), 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.Start(ctx)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) >= 3
+	}, time.Second, 5*time.Millisecond)
+	assert.True(t, m.Healthy())
+
+	cancel()
+	time.Sleep(30 * time.Millisecond)
+	stopped := atomic.LoadInt32(&calls)
+	time.Sleep(30 * time.Millisecond)
+	assert.EqualValues(t, stopped, atomic.LoadInt32(&calls))
+}
+
+func TestStart_IntervalChanged(t *testing.T) {
+	var calls int32
+	interval := int64(10 * time.Millisecond)
+	m := NewMonitor(WithIntervalFunc(func() time.Duration {
+		return time.Duration(atomic.LoadInt64(&interval))
+	}))
+	m.Register(NewChecker("mongodb", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}), 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.Start(ctx)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) >= 2
+	}, time.Second, 5*time.Millisecond)
+
+	// Followed from the next run on
+	atomic.StoreInt64(&interval, int64(time.Hour))
+	time.Sleep(30 * time.Millisecond)
+	settled := atomic.LoadInt32(&calls)
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, settled, atomic.LoadInt32(&calls))
+}
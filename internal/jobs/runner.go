@@ -0,0 +1,341 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultConcurrency       = 2
+	DefaultHeartbeatInterval = 15 * time.Second
+	DefaultRecoveryInterval  = db.JobLockTimeOut
+
+	// QueueSize - Jobs waiting for a worker in memory, the ones above are picked up by the next recovery
+	QueueSize = 1000
+	// ProgressInterval - Minimum time between two progress updates written to the DB
+	ProgressInterval = time.Second
+)
+
+var UnknownJobTypeErr = errors.New("unknown job type")
+
+// Handler - Does the work of a job, reporting progress as it goes. The result is stored with the job once it succeeds.
+// The context is cancelled when the job is cancelled or the runner stops.
+type Handler func(ctx context.Context, job *models.Job, progress Progress) (map[string]interface{}, error)
+
+// Progress - Records that done out of total units of work are complete, returns an error once the job must stop
+type Progress func(done, total int) error
+
+type Option func(*Runner)
+
+// WithConcurrency - Number of jobs run at the same time by this instance
+func WithConcurrency(n int) Option {
+	return func(r *Runner) {
+		if n > 0 {
+			r.concurrency = n
+		}
+	}
+}
+
+// WithHeartbeatInterval - How often running jobs tell they are alive, must be well below db.JobLockTimeOut
+func WithHeartbeatInterval(d time.Duration) Option {
+	return func(r *Runner) {
+		if d > 0 {
+			r.heartbeatInterval = d
+		}
+	}
+}
+
+// WithRecoveryInterval - How often queued and interrupted jobs are looked up in the DB
+func WithRecoveryInterval(d time.Duration) Option {
+	return func(r *Runner) {
+		if d > 0 {
+			r.recoveryInterval = d
+		}
+	}
+}
+
+// Runner - Pool of workers running the jobs stored in the DB. Several instances can share the same jobs, a job being
+// claimed by a single one of them.
+type Runner struct {
+	svc               db.JobsDataService
+	handlers          map[string]Handler
+	concurrency       int
+	heartbeatInterval time.Duration
+	recoveryInterval  time.Duration
+	queue             chan string
+
+	mu      sync.Mutex
+	pending map[string]bool
+	running map[string]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewRunner(svc db.JobsDataService, opts ...Option) *Runner {
+	r := &Runner{
+		svc:               svc,
+		handlers:          make(map[string]Handler),
+		concurrency:       DefaultConcurrency,
+		heartbeatInterval: DefaultHeartbeatInterval,
+		recoveryInterval:  DefaultRecoveryInterval,
+		queue:             make(chan string, QueueSize),
+		pending:           make(map[string]bool),
+		running:           make(map[string]context.CancelFunc),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Register - Sets the handler of a type of job, to be done before Start
+func (r *Runner) Register(jobType string, h Handler) {
+	r.handlers[jobType] = h
+}
+
+// Submit - Stores a new job and queues it. Params are stored as their JSON representation, see models.Job.DecodeParams
+func (r *Runner) Submit(ctx context.Context, jobType string, params interface{}) (*models.Job, error) {
+	if _, ok := r.handlers[jobType]; !ok {
+		return nil, UnknownJobTypeErr
+	}
+	job := &models.Job{
+		Type: jobType,
+	}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &job.Params); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.svc.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	r.enqueue(job.ID.Hex())
+	return job, nil
+}
+
+func (r *Runner) Get(ctx context.Context, id string) (*models.Job, error) {
+	return r.svc.GetById(ctx, id)
+}
+
+// Cancel - Cancels the job, a running job stops right away when this instance runs it, else at its next heartbeat
+func (r *Runner) Cancel(ctx context.Context, id string) (*models.Job, error) {
+	job, err := r.svc.Cancel(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	if cancel, ok := r.running[id]; ok {
+		cancel()
+	}
+	r.mu.Unlock()
+	return job, nil
+}
+
+// Start - Starts the workers, and the recovery of jobs queued or interrupted before, until ctx is done
+func (r *Runner) Start(ctx context.Context) {
+	for i := 0; i < r.concurrency; i++ {
+		r.wg.Add(1)
+		go r.work(ctx)
+	}
+	r.wg.Add(1)
+	go r.recoverJobs(ctx)
+}
+
+// Wait - Blocks until the workers stopped, running jobs being queued again for the next start
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// Running - Ids of the jobs being run by this instance
+func (r *Runner) Running() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(r.running))
+	for id := range r.running {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (r *Runner) enqueue(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending[id] {
+		return
+	}
+	select {
+	case r.queue <- id:
+		r.pending[id] = true
+	default:
+		log.Warn().Str("job", id).Msg("job queue is full, job stays queued until the next recovery")
+	}
+}
+
+func (r *Runner) work(ctx context.Context) {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-r.queue:
+			r.mu.Lock()
+			delete(r.pending, id)
+			r.mu.Unlock()
+			r.run(ctx, id)
+		}
+	}
+}
+
+func (r *Runner) recoverJobs(ctx context.Context) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.recoveryInterval)
+	defer ticker.Stop()
+	for {
+		ids, err := r.svc.Recover(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("unable to recover jobs")
+		}
+		for _, id := range ids {
+			r.enqueue(id)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run - Claims the job and runs it to completion
+func (r *Runner) run(ctx context.Context, id string) {
+	job, err := r.svc.Claim(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Str("job", id).Msg("unable to claim job")
+		return
+	}
+	if job == nil {
+		// Cancelled, or claimed by another instance
+		return
+	}
+	logger := log.With().Str("job", id).Str("type", job.Type).Int("attempt", job.Attempts).Logger()
+
+	handler, ok := r.handlers[job.Type]
+	if !ok {
+		logger.Error().Msg("no handler for job")
+		r.finish(id, models.JobFailed, nil, UnknownJobTypeErr.Error())
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r.mu.Lock()
+	r.running[id] = cancel
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.running, id)
+		r.mu.Unlock()
+	}()
+
+	logger.Info().Msg("job started")
+	stopHeartbeat := r.heartbeat(jobCtx, id, cancel)
+	result, err := call(jobCtx, handler, job, r.progress(jobCtx, id, cancel))
+	stopHeartbeat()
+
+	switch {
+	case err == nil:
+		logger.Info().Msg("job succeeded")
+		r.finish(id, models.JobSucceeded, result, "")
+	case ctx.Err() != nil:
+		logger.Warn().Msg("job interrupted, queued again")
+		if rErr := r.svc.Requeue(context.Background(), id); rErr != nil {
+			logger.Error().Err(rErr).Msg("unable to queue job again")
+		}
+	case jobCtx.Err() != nil:
+		logger.Info().Msg("job cancelled")
+		r.finish(id, models.JobCancelled, result, "")
+	default:
+		logger.Error().Err(err).Msg("job failed")
+		r.finish(id, models.JobFailed, result, err.Error())
+	}
+}
+
+// heartbeat - Keeps the job claimed until the returned func is called, cancelling it when requested
+func (r *Runner) heartbeat(ctx context.Context, id string, cancel context.CancelFunc) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(r.heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				stop, err := r.svc.Heartbeat(ctx, id)
+				if err != nil {
+					log.Warn().Err(err).Str("job", id).Msg("unable to send job heartbeat")
+				} else if stop {
+					cancel()
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// progress - Progress of the job, written at most every ProgressInterval except for the final one
+func (r *Runner) progress(ctx context.Context, id string, cancel context.CancelFunc) Progress {
+	var last time.Time
+	return func(done, total int) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if time.Since(last) < ProgressInterval && done != total {
+			return nil
+		}
+		last = time.Now()
+		stop, err := r.svc.ReportProgress(ctx, id, models.JobProgress{Done: done, Total: total})
+		if err != nil {
+			log.Warn().Err(err).Str("job", id).Msg("unable to report job progress")
+		} else if stop {
+			cancel()
+		}
+		return ctx.Err()
+	}
+}
+
+// finish - Records the outcome of the job, even when the runner is stopping
+func (r *Runner) finish(id string, status models.JobStatus, result map[string]interface{}, errMsg string) {
+	if err := r.svc.Finish(context.Background(), id, status, result, errMsg); err != nil {
+		log.Error().Err(err).Str("job", id).Msg("unable to record job outcome")
+	}
+}
+
+// call - Runs the handler, turning a panic into a failure of the job
+func call(ctx context.Context, h Handler, job *models.Job, progress Progress) (result map[string]interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return h(ctx, job, progress)
+}
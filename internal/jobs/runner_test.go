@@ -0,0 +1,260 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/mocks"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type outcome struct {
+	status models.JobStatus
+	result map[string]interface{}
+	errMsg string
+}
+
+// setupMocks - Jobs kept in memory, outcomes are sent to the returned channel
+func setupMocks(queued ...string) (chan outcome, chan string) {
+	outcomes := make(chan outcome, 10)
+	requeued := make(chan string, 10)
+	stored := make(map[string]models.Job)
+	mocks.CreateJobFunc = func(ctx context.Context, job *models.Job) error {
+		job.ID = primitive.NewObjectID()
+		job.Status = models.JobQueued
+		stored[job.ID.Hex()] = *job
+		return nil
+	}
+	mocks.ClaimJobFunc = func(ctx context.Context, id string) (*models.Job, error) {
+		job, ok := stored[id]
+		if !ok {
+			// Recovered job, stored before the runner started
+			job.ID, _ = primitive.ObjectIDFromHex(id)
+			job.Type = "test"
+		}
+		job.Status, job.Attempts = models.JobRunning, job.Attempts+1
+		return &job, nil
+	}
+	mocks.HeartbeatFunc = func(ctx context.Context, id string) (bool, error) {
+		return false, nil
+	}
+	mocks.ReportProgressFunc = func(ctx context.Context, id string, progress models.JobProgress) (bool, error) {
+		return false, nil
+	}
+	mocks.FinishJobFunc = func(ctx context.Context, id string, status models.JobStatus, result map[string]interface{}, errMsg string) error {
+		outcomes <- outcome{status, result, errMsg}
+		return nil
+	}
+	mocks.CancelJobFunc = func(ctx context.Context, id string) (*models.Job, error) {
+		return &models.Job{Status: models.JobRunning, CancelRequested: true}, nil
+	}
+	mocks.RequeueJobFunc = func(ctx context.Context, id string) error {
+		requeued <- id
+		return nil
+	}
+	mocks.RecoverJobsFunc = func(ctx context.Context) ([]string, error) {
+		ids := queued
+		queued = nil
+		return ids, nil
+	}
+	return outcomes, requeued
+}
+
+func waitFor(t *testing.T, outcomes chan outcome) outcome {
+	select {
+	case o := <-outcomes:
+		return o
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not finish")
+		return outcome{}
+	}
+}
+
+func TestSubmit_UnknownType(t *testing.T) {
+	setupMocks()
+	r := NewRunner(&mocks.MockJobsDataService{})
+
+	_, err := r.Submit(context.TODO(), "unknown", nil)
+
+	assert.ErrorIs(t, err, UnknownJobTypeErr)
+}
+
+func TestRunSuccess(t *testing.T) {
+	outcomes, _ := setupMocks()
+	var reported []models.JobProgress
+	mocks.ReportProgressFunc = func(ctx context.Context, id string, progress models.JobProgress) (bool, error) {
+		reported = append(reported, progress)
+		return false, nil
+	}
+	r := NewRunner(&mocks.MockJobsDataService{}, WithConcurrency(1))
+	r.Register("test", func(ctx context.Context, job *models.Job, progress Progress) (map[string]interface{}, error) {
+		assert.EqualValues(t, 42, job.Params["answer"])
+		for i := 1; i <= 100; i++ {
+			if err := progress(i, 100); err != nil {
+				return nil, err
+			}
+		}
+		return map[string]interface{}{"count": 100}, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Start(ctx)
+
+	job, err := r.Submit(ctx, "test", map[string]interface{}{"answer": 42})
+	assert.NoError(t, err)
+	assert.EqualValues(t, models.JobQueued, job.Status)
+
+	o := waitFor(t, outcomes)
+	assert.EqualValues(t, models.JobSucceeded, o.status)
+	assert.EqualValues(t, 100, o.result["count"])
+	// Updates are throttled, but the final progress is always written
+	assert.Less(t, len(reported), 100)
+	assert.EqualValues(t, models.JobProgress{Done: 100, Total: 100}, reported[len(reported)-1])
+
+	cancel()
+	r.Wait()
+}
+
+func TestRunFailure(t *testing.T) {
+	type runFailureTestCase struct {
+		Description string
+		Handler     Handler
+		Error       string
+	}
+
+	var testCases = []runFailureTestCase{
+		{
+			Description: "error",
+			Handler: func(ctx context.Context, job *models.Job, progress Progress) (map[string]interface{}, error) {
+				return nil, errors.New("boom")
+			},
+			Error: "boom",
+		},
+		{
+			Description: "panic",
+			Handler: func(ctx context.Context, job *models.Job, progress Progress) (map[string]interface{}, error) {
+				panic("boom")
+			},
+			Error: "job panicked: boom",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			outcomes, _ := setupMocks()
+			r := NewRunner(&mocks.MockJobsDataService{})
+			r.Register("test", tc.Handler)
+			ctx, cancel := context.WithCancel(context.Background())
+			r.Start(ctx)
+
+			_, err := r.Submit(ctx, "test", nil)
+			assert.NoError(t, err)
+
+			o := waitFor(t, outcomes)
+			assert.EqualValues(t, models.JobFailed, o.status)
+			assert.EqualValues(t, tc.Error, o.errMsg)
+
+			cancel()
+			r.Wait()
+		})
+	}
+}
+
+func TestRun_UnknownType(t *testing.T) {
+	outcomes, _ := setupMocks(primitive.NewObjectID().Hex())
+	r := NewRunner(&mocks.MockJobsDataService{})
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Start(ctx)
+
+	o := waitFor(t, outcomes)
+	assert.EqualValues(t, models.JobFailed, o.status)
+	assert.EqualValues(t, UnknownJobTypeErr.Error(), o.errMsg)
+
+	cancel()
+	r.Wait()
+}
+
+func TestRecover(t *testing.T) {
+	outcomes, _ := setupMocks(primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex())
+	r := NewRunner(&mocks.MockJobsDataService{})
+	r.Register("test", func(ctx context.Context, job *models.Job, progress Progress) (map[string]interface{}, error) {
+		return nil, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Start(ctx)
+
+	assert.EqualValues(t, models.JobSucceeded, waitFor(t, outcomes).status)
+	assert.EqualValues(t, models.JobSucceeded, waitFor(t, outcomes).status)
+
+	cancel()
+	r.Wait()
+}
+
+func TestCancel(t *testing.T) {
+	outcomes, _ := setupMocks()
+	started := make(chan struct{})
+	r := NewRunner(&mocks.MockJobsDataService{})
+	r.Register("test", func(ctx context.Context, job *models.Job, progress Progress) (map[string]interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Start(ctx)
+
+	job, _ := r.Submit(ctx, "test", nil)
+	<-started
+	cancelled, err := r.Cancel(ctx, job.ID.Hex())
+	assert.NoError(t, err)
+	assert.True(t, cancelled.CancelRequested)
+
+	assert.EqualValues(t, models.JobCancelled, waitFor(t, outcomes).status)
+
+	cancel()
+	r.Wait()
+}
+
+func TestCancel_FromHeartbeat(t *testing.T) {
+	outcomes, _ := setupMocks()
+	mocks.HeartbeatFunc = func(ctx context.Context, id string) (bool, error) {
+		// Cancelled through another instance
+		return true, nil
+	}
+	r := NewRunner(&mocks.MockJobsDataService{}, WithHeartbeatInterval(10*time.Millisecond))
+	r.Register("test", func(ctx context.Context, job *models.Job, progress Progress) (map[string]interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Start(ctx)
+
+	_, _ = r.Submit(ctx, "test", nil)
+
+	assert.EqualValues(t, models.JobCancelled, waitFor(t, outcomes).status)
+
+	cancel()
+	r.Wait()
+}
+
+func TestStop_RequeuesRunningJobs(t *testing.T) {
+	_, requeued := setupMocks()
+	started := make(chan struct{})
+	r := NewRunner(&mocks.MockJobsDataService{})
+	r.Register("test", func(ctx context.Context, job *models.Job, progress Progress) (map[string]interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Start(ctx)
+
+	job, _ := r.Submit(ctx, "test", nil)
+	<-started
+	cancel()
+	r.Wait()
+
+	assert.EqualValues(t, job.ID.Hex(), <-requeued)
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+)
+
+// Registry - Every metric of the service, as served on /metrics. The default registry of the Prometheus client is left
+// alone so that dependencies registering there can't break or pollute ours.
+var Registry = prometheus.NewRegistry()
+
+// HTTP
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests being served, by route.",
+	}, []string{"method", "route"})
+)
+
+// MongoDB
+var (
+	MongoCommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongodb_command_duration_seconds",
+		Help:    "Time taken by MongoDB commands, by command and outcome.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"command", "outcome"})
+
+	MongoPoolConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_pool_connections",
+		Help: "Connections in the MongoDB connection pool of each server, by state (open or in_use).",
+	}, []string{"address", "state"})
+
+	MongoPoolCheckoutFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongodb_pool_checkout_failures_total",
+		Help: "Failed attempts to get a connection from the MongoDB connection pool of each server, by reason.",
+	}, []string{"address", "reason"})
+)
+
+// Orders
+var (
+	OrdersCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orders_created_total",
+		Help: "Orders created.",
+	})
+
+	OrdersUpdated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orders_updated_total",
+		Help: "Existing orders updated or replaced.",
+	})
+
+	OrdersDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orders_deleted_total",
+		Help: "Orders deleted.",
+	})
+)
+
+var buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "build_info",
+	Help: "Always 1, labeled with the service and the version it was built from.",
+}, []string{"service", "version", "environment", "goversion"})
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPRequestDuration, HTTPRequestsInFlight,
+		MongoCommandDuration, MongoPoolConnections, MongoPoolCheckoutFailures,
+		OrdersCreated, OrdersUpdated, OrdersDeleted,
+		buildInfo,
+	)
+}
+
+// SetBuildInfo - Labels build_info with what the service is and which version of it runs
+func SetBuildInfo(s *models.ServiceInfo) {
+	buildInfo.Reset()
+	buildInfo.WithLabelValues(s.Name, s.Version, s.Environment, runtime.Version()).Set(1)
+}
+
+// Handler - Serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
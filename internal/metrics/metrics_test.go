@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetBuildInfo(t *testing.T) {
+	SetBuildInfo(&models.ServiceInfo{Name: "orders", Version: "v1", Environment: "test"})
+	SetBuildInfo(&models.ServiceInfo{Name: "orders", Version: "v2", Environment: "test"})
+
+	// Only the running version is reported
+	assert.EqualValues(t, 1, testutil.CollectAndCount(buildInfo))
+	assert.EqualValues(t, 1, testutil.ToFloat64(buildInfo))
+}
+
+func TestHandler(t *testing.T) {
+	SetBuildInfo(&models.ServiceInfo{Name: "orders", Version: "v1", Environment: "test"})
+	OrdersCreated.Inc()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+	Handler().ServeHTTP(w, req)
+
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain"))
+	for _, name := range []string{`build_info{environment="test",goversion=`, "orders_created_total 1",
+		"go_goroutines", "process_start_time_seconds"} {
+		assert.Contains(t, w.Body.String(), name)
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/auth"
+	"github.com/rs/zerolog/log"
+)
+
+const WWWAuthenticateHeader = "WWW-Authenticate"
+
+// Authenticate - Identifies the caller of every request with the first authenticator recognizing its credentials, and
+// rejects the request with 401 when there are none or they are invalid. Paths listed as public, exactly or as a prefix
+// ending with '*', and OPTIONS requests which carry no credentials, go through without authentication.
+func Authenticate(publicPaths []string, authenticators ...auth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodOptions || isPublic(c.Request.URL.Path, publicPaths) {
+			c.Next()
+			return
+		}
+
+		for _, a := range authenticators {
+			p, err := a.Authenticate(c.Request)
+			if errors.Is(err, auth.UnavailableErr) {
+				log.Ctx(c).Error().Err(err).Str("path", c.Request.URL.Path).Msg("unable to authenticate")
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "unable to check credentials"})
+				return
+			}
+			if err != nil {
+				log.Ctx(c).Warn().Err(err).Str("path", c.Request.URL.Path).Msg("authentication failed")
+				c.Header(WWWAuthenticateHeader, `Bearer error="invalid_token"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "invalid credentials"})
+				return
+			}
+			if p != nil {
+				auth.SetPrincipal(c, p)
+				c.Next()
+				return
+			}
+		}
+
+		c.Header(WWWAuthenticateHeader, "Bearer")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "authentication required"})
+	}
+}
+
+func isPublic(path string, publicPaths []string) bool {
+	for _, p := range publicPaths {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if path == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/auth"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// headerAuthenticator - Authenticates requests carrying its header, the value being the subject or 'bad'
+type headerAuthenticator string
+
+func (h headerAuthenticator) Authenticate(r *http.Request) (*models.Principal, error) {
+	switch v := r.Header.Get(string(h)); v {
+	case "":
+		return nil, nil
+	case "bad":
+		return nil, errors.New("bad credentials")
+	default:
+		return &models.Principal{Subject: v, Method: string(h)}, nil
+	}
+}
+
+func authRouter(seen **models.Principal) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Authenticate([]string{"/status", "/swagger/*"}, headerAuthenticator("X-First"), headerAuthenticator("X-Second")))
+	handler := func(c *gin.Context) {
+		*seen = auth.PrincipalFrom(c)
+		c.Status(http.StatusOK)
+	}
+	r.GET("/status", handler)
+	r.GET("/swagger/*any", handler)
+	r.GET("/api/v1/orders", handler)
+	r.OPTIONS("/api/v1/orders", handler)
+	return r
+}
+
+func TestAuthenticate(t *testing.T) {
+	type authenticateTestCase struct {
+		Description string
+		Method      string
+		Path        string
+		Headers     map[string]string
+		Status      int
+		Subject     string
+	}
+
+	var testCases = []authenticateTestCase{
+		{"public path", http.MethodGet, "/status", nil, http.StatusOK, ""},
+		{"public prefix", http.MethodGet, "/swagger/index.html", nil, http.StatusOK, ""},
+		{"preflight", http.MethodOptions, "/api/v1/orders", nil, http.StatusOK, ""},
+		{"no credentials", http.MethodGet, "/api/v1/orders", nil, http.StatusUnauthorized, ""},
+		{"invalid credentials", http.MethodGet, "/api/v1/orders", map[string]string{"X-First": "bad"}, http.StatusUnauthorized, ""},
+		{"first authenticator", http.MethodGet, "/api/v1/orders", map[string]string{"X-First": "alice"}, http.StatusOK, "alice"},
+		{"next authenticator", http.MethodGet, "/api/v1/orders", map[string]string{"X-Second": "bob"}, http.StatusOK, "bob"},
+		{"credentials on public path", http.MethodGet, "/status", map[string]string{"X-First": "bad"}, http.StatusOK, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			var seen *models.Principal
+			req, _ := http.NewRequest(tc.Method, tc.Path, nil)
+			for name, value := range tc.Headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+
+			authRouter(&seen).ServeHTTP(w, req)
+
+			assert.EqualValues(t, tc.Status, w.Code)
+			if tc.Status == http.StatusUnauthorized {
+				assert.Contains(t, w.Header().Get(WWWAuthenticateHeader), "Bearer")
+			}
+			if tc.Subject != "" {
+				assert.EqualValues(t, tc.Subject, seen.Subject)
+			} else {
+				assert.Nil(t, seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/auth"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+const MIMEProblemJSON = "application/problem+json"
+
+// RequirePermission - Only lets through callers the policy grants the permission, 401 for anonymous callers and 403
+// naming the missing permission for the others
+func RequirePermission(policy *auth.Policy, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := auth.PrincipalFrom(c)
+		if p == nil {
+			abortProblem(c, models.Problem{
+				Status: http.StatusUnauthorized,
+				Detail: "authentication required",
+			})
+			return
+		}
+		if !policy.Allowed(p, permission) {
+			log.Ctx(c.Request.Context()).Warn().Str("permission", permission).Str("path", c.Request.URL.Path).
+				Msg("permission denied")
+			abortProblem(c, models.Problem{
+				Status:     http.StatusForbidden,
+				Detail:     "missing permission " + permission,
+				Permission: permission,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Visibility - Works out which orders the caller can see, for the repositories to scope their queries with. Callers
+// left out see only their own orders.
+func Visibility(policy *auth.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p := auth.PrincipalFrom(c); p != nil {
+			p.Visibility = policy.Visibility(p)
+		}
+		c.Next()
+	}
+}
+
+// abortProblem - Ends the request with an RFC 7807 problem, filling in what the caller left out
+func abortProblem(c *gin.Context, problem models.Problem) {
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+	if problem.Instance == "" {
+		problem.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", MIMEProblemJSON)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/auth"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequirePermission(t *testing.T) {
+	type requirePermissionTestCase struct {
+		Description string
+		Principal   *models.Principal
+		Status      int
+	}
+
+	var testCases = []requirePermissionTestCase{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"missing permission", &models.Principal{Subject: "alice", Roles: []string{"writer"}}, http.StatusForbidden},
+		{"granted", &models.Principal{Subject: "alice", Roles: []string{"reader", "admin"}}, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				if tc.Principal != nil {
+					auth.SetPrincipal(c, tc.Principal)
+				}
+			})
+			policy := auth.NewPolicy(auth.DefaultRoles)
+			r.DELETE("/orders/:id", RequirePermission(policy, models.PermOrdersDelete), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodDelete, "/orders/1", nil)
+
+			r.ServeHTTP(w, req)
+
+			assert.EqualValues(t, tc.Status, w.Code)
+			if tc.Status == http.StatusOK {
+				return
+			}
+			var problem models.Problem
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.EqualValues(t, MIMEProblemJSON, w.Header().Get("Content-Type"))
+			assert.EqualValues(t, tc.Status, problem.Status)
+			assert.EqualValues(t, "/orders/1", problem.Instance)
+			if tc.Status == http.StatusForbidden {
+				assert.EqualValues(t, models.PermOrdersDelete, problem.Permission)
+				assert.Contains(t, problem.Detail, models.PermOrdersDelete)
+			}
+		})
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := &models.Principal{Subject: "alice", Roles: []string{"admin"}}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		auth.SetPrincipal(c, p)
+	}, Visibility(auth.NewPolicy(auth.DefaultRoles)))
+	r.GET("/orders", func(c *gin.Context) {
+		assert.EqualValues(t, models.VisibilityAll, models.PrincipalFromContext(c.Request.Context()).Visibility)
+		c.Status(http.StatusOK)
+	})
+	req, _ := http.NewRequest(http.MethodGet, "/orders", nil)
+
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.EqualValues(t, models.VisibilityAll, p.Visibility)
+}
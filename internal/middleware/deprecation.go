@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DeprecationHeader = "Deprecation"
+	LinkHeader        = "Link"
+)
+
+// Deprecated - Marks every response of the route as deprecated and points clients to the route replacing it
+func Deprecated(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		MarkDeprecated(c, successor)
+		c.Next()
+	}
+}
+
+// MarkDeprecated - Adds deprecation headers to the response, used when only some requests of a route are deprecated
+func MarkDeprecated(c *gin.Context, successor string) {
+	c.Header(DeprecationHeader, "true")
+	if successor != "" {
+		c.Header(LinkHeader, fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+	}
+}
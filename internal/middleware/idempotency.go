@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/auth"
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	MaxIdempotencyKeyLength  = 255
+	IdempotencyStoreTimeout  = 5 * time.Second
+)
+
+// IdempotencyRenewInterval - How often the request holding a key renews it, well within db.IdempotencyLease
+var IdempotencyRenewInterval = db.IdempotencyLease / 3
+
+// replayedHeaders - Response headers describing the outcome of a request, stored and replayed along with its body.
+// Others, such as the request id or rate limit headers, belong to the request they were sent with.
+var replayedHeaders = []string{"Content-Type", "ETag", "Last-Modified", "Location", "Deprecation"}
+
+// Idempotency - Makes retries of a request carrying an Idempotency-Key header safe. The first response is stored and
+// replayed for every repeat, a key reused with a different request is rejected with 422 and a repeat arriving while the
+// first request is still being processed gets 409. The key is held for as long as the first request runs, and freed for
+// a retry when it fails with a server error or a panic. Bodies are fingerprinted as they are read, so that they are
+// streamed to the handler rather than held in memory.
+func Idempotency(store db.IdempotencyDataService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > MaxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Idempotency-Key is too long"})
+			return
+		}
+		// Keys of different callers never collide, nor replay responses to someone else
+		if p := auth.PrincipalFrom(c); p != nil {
+			key = p.Subject + "/" + key
+		}
+
+		record, err := store.Begin(c, key)
+		if err != nil {
+			log.Ctx(c).Error().Err(err).Msg("unable to reserve idempotency key")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Unexpected Error occurred"})
+			return
+		}
+		if record != nil {
+			replay(c, record)
+			return
+		}
+
+		fingerprint := newFingerprint(c.Request)
+		body := c.Request.Body
+		if body == nil {
+			body = http.NoBody
+		}
+		c.Request.Body = readCloser{Reader: io.TeeReader(body, fingerprint), Closer: body}
+		recorder := newBodyRecorder(c.Writer)
+		c.Writer = recorder
+		finished := false
+		defer func() {
+			// The handler panicked, the client must be able to retry
+			if !finished {
+				releaseKey(c, store, key)
+			}
+		}()
+		stopRenewing := holdKey(c, store, key)
+		defer stopRenewing()
+		c.Next()
+		finished = true
+		stopRenewing()
+
+		// Whatever the handler left unread is part of the request too. Server errors are not final, the client must be
+		// able to retry them.
+		_, readErr := io.Copy(fingerprint, body)
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError || readErr != nil {
+			releaseKey(c, store, key)
+			return
+		}
+
+		// The outcome must be recorded even when the client is gone by now
+		ctx, cancel := context.WithTimeout(context.Background(), IdempotencyStoreTimeout)
+		defer cancel()
+
+		headers := make(map[string]string)
+		for _, name := range replayedHeaders {
+			if value := recorder.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		if err := store.Complete(ctx, key, fingerprint.String(), status, headers, recorder.body.Bytes()); err != nil {
+			log.Ctx(c).Error().Err(err).Msg("unable to store response for idempotency key")
+		}
+	}
+}
+
+// replay - Answers a repeat of the request which reserved record, with its response once it completed
+func replay(c *gin.Context, record *models.IdempotencyRecord) {
+	if !record.Completed {
+		c.AbortWithStatusJSON(http.StatusConflict,
+			gin.H{"message": "a request with the same Idempotency-Key is still in progress"})
+		return
+	}
+
+	fingerprint := newFingerprint(c.Request)
+	if _, err := io.Copy(fingerprint, c.Request.Body); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "unable to read request body"})
+		return
+	}
+	if record.Fingerprint != fingerprint.String() {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity,
+			gin.H{"message": "Idempotency-Key was already used with a different request"})
+		return
+	}
+
+	for _, name := range replayedHeaders {
+		if value, ok := record.Headers[name]; ok {
+			c.Header(name, value)
+		}
+	}
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Data(record.StatusCode, record.Headers["Content-Type"], record.Body)
+	c.Abort()
+}
+
+// releaseKey - Frees key for a retry of the request, even when the client is gone by now
+func releaseKey(c *gin.Context, store db.IdempotencyDataService, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), IdempotencyStoreTimeout)
+	defer cancel()
+	if err := store.Release(ctx, key); err != nil {
+		log.Ctx(c).Error().Err(err).Msg("unable to release idempotency key")
+	}
+}
+
+// holdKey - Renews key every IdempotencyRenewInterval, until the returned func is called once the request is done. It
+// returns once renewing stopped, and can be called again.
+func holdKey(c *gin.Context, store db.IdempotencyDataService, key string) (stop func()) {
+	logger := log.Ctx(c)
+	ticker := time.NewTicker(IdempotencyRenewInterval)
+	done, stopped := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), IdempotencyStoreTimeout)
+				if err := store.Renew(ctx, key); err != nil {
+					logger.Warn().Err(err).Msg("unable to renew idempotency key")
+				}
+				cancel()
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+		<-stopped
+	}
+}
+
+// fingerprint - Identifies a request by its target, query included, its payload and the representations it sends and
+// asks for, as the same payload in another format or asking for another format is a different request. The payload is
+// written to it.
+type fingerprint struct {
+	hash.Hash
+}
+
+func newFingerprint(r *http.Request) fingerprint {
+	h := sha256.New()
+	for _, part := range []string{r.Method, r.URL.RequestURI(), r.Header.Get("Accept"), r.Header.Get("Content-Type")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return fingerprint{Hash: h}
+}
+
+func (f fingerprint) String() string {
+	return hex.EncodeToString(f.Sum(nil))
+}
+
+// readCloser - Reader closed by Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
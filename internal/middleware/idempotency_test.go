@@ -0,0 +1,328 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/auth"
+	"github.com/rameshsunkara/go-rest-api-example/internal/mocks"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func idempotentRouter(handlerCalls *int, status int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/orders", Idempotency(&mocks.MockIdempotencyDataService{}), func(c *gin.Context) {
+		*handlerCalls++
+		c.Header("Location", "/orders/1")
+		c.Header("X-RateLimit-Remaining", "9")
+		c.JSON(status, gin.H{"order_id": "1"})
+	})
+	return r
+}
+
+func idempotentRequest(key string, body string) *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewBufferString(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	return req
+}
+
+func TestIdempotency_NoKey(t *testing.T) {
+	calls := 0
+	mocks.BeginFunc = func(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+		t.Error("key must not be reserved without Idempotency-Key header")
+		return nil, nil
+	}
+
+	w := httptest.NewRecorder()
+	idempotentRouter(&calls, http.StatusCreated).ServeHTTP(w, idempotentRequest("", "{}"))
+
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.EqualValues(t, 1, calls)
+}
+
+func TestIdempotency_FirstRequest(t *testing.T) {
+	calls := 0
+	var stored *models.IdempotencyRecord
+	mocks.BeginFunc = func(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+		return nil, nil
+	}
+	mocks.CompleteFunc = func(ctx context.Context, key string, fp string, statusCode int, headers map[string]string,
+		body []byte) error {
+		stored = &models.IdempotencyRecord{Key: key, StatusCode: statusCode, Headers: headers, Body: body}
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	idempotentRouter(&calls, http.StatusCreated).ServeHTTP(w, idempotentRequest("key-1", "{}"))
+
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.EqualValues(t, 1, calls)
+	assert.NotNil(t, stored)
+	assert.EqualValues(t, "key-1", stored.Key)
+	assert.EqualValues(t, http.StatusCreated, stored.StatusCode)
+	assert.EqualValues(t, map[string]string{"Location": "/orders/1", "Content-Type": "application/json; charset=utf-8"},
+		stored.Headers)
+	assert.JSONEq(t, `{"order_id":"1"}`, string(stored.Body))
+}
+
+func TestIdempotency_Replay(t *testing.T) {
+	calls := 0
+	var fingerprint string
+	mocks.BeginFunc = func(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+		return nil, nil
+	}
+	mocks.CompleteFunc = func(ctx context.Context, key string, fp string, statusCode int, headers map[string]string,
+		body []byte) error {
+		fingerprint = fp
+		return nil
+	}
+	router := idempotentRouter(&calls, http.StatusCreated)
+	router.ServeHTTP(httptest.NewRecorder(), idempotentRequest("key-1", `{"a":1}`))
+
+	// Records stored before the allowlist may hold any header, the request id of the first request is not replayed
+	headers := map[string]string{"Location": "/orders/1", "Content-Type": "application/json; charset=utf-8",
+		"X-Request-Id": "first"}
+	mocks.BeginFunc = func(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+		return &models.IdempotencyRecord{
+			Key:         key,
+			Fingerprint: fingerprint,
+			Completed:   true,
+			StatusCode:  http.StatusCreated,
+			Headers:     headers,
+			Body:        []byte(`{"order_id":"1"}`),
+		}, nil
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, idempotentRequest("key-1", `{"a":1}`))
+
+	assert.EqualValues(t, 1, calls)
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.EqualValues(t, "/orders/1", w.Header().Get("Location"))
+	assert.EqualValues(t, "true", w.Header().Get(IdempotentReplayedHeader))
+	assert.Empty(t, w.Header().Get("X-Request-Id"))
+	assert.JSONEq(t, `{"order_id":"1"}`, w.Body.String())
+}
+
+func TestIdempotency_Conflicts(t *testing.T) {
+	type conflictTestCase struct {
+		Description  string
+		Fingerprint  string
+		Completed    bool
+		ExpectedCode int
+	}
+
+	var testCases = []conflictTestCase{
+		{"key reused with a different request", "other", true, http.StatusUnprocessableEntity},
+		{"first request still in progress", "", false, http.StatusConflict},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			calls := 0
+			mocks.BeginFunc = func(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+				return &models.IdempotencyRecord{Key: key, Fingerprint: tc.Fingerprint, Completed: tc.Completed}, nil
+			}
+
+			w := httptest.NewRecorder()
+			idempotentRouter(&calls, http.StatusCreated).ServeHTTP(w, idempotentRequest("key-1", `{"a":1}`))
+
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+			assert.EqualValues(t, 0, calls)
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	fingerprint := func(accept string, contentType string) string {
+		req := idempotentRequest("key-1", `{"a":1}`)
+		req.Header.Set("Accept", accept)
+		req.Header.Set("Content-Type", contentType)
+		f := newFingerprint(req)
+		_, _ = f.Write([]byte(`{"a":1}`))
+		return f.String()
+	}
+
+	same := fingerprint("application/json", "application/json")
+	assert.EqualValues(t, same, fingerprint("application/json", "application/json"))
+	assert.NotEqualValues(t, same, fingerprint("text/csv", "application/json"))
+	assert.NotEqualValues(t, same, fingerprint("application/json", "application/x-yaml"))
+
+	dryRun, _ := http.NewRequest(http.MethodPost, "/orders/import?dry_run=true", nil)
+	run, _ := http.NewRequest(http.MethodPost, "/orders/import?dry_run=false", nil)
+	assert.NotEqualValues(t, newFingerprint(dryRun).String(), newFingerprint(run).String())
+}
+
+func TestIdempotency_StreamedBody(t *testing.T) {
+	var fingerprint string
+	mocks.BeginFunc = func(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+		return nil, nil
+	}
+	mocks.CompleteFunc = func(ctx context.Context, key string, fp string, statusCode int, headers map[string]string,
+		body []byte) error {
+		fingerprint = fp
+		return nil
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/orders", Idempotency(&mocks.MockIdempotencyDataService{}), func(c *gin.Context) {
+		// Reads only part of the body, a line at a time as imports do
+		line, _ := bufio.NewReader(c.Request.Body).ReadString('\n')
+		c.String(http.StatusOK, line)
+	})
+	body := strings.Repeat(`{"a":1}`+"\n", 10000)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, idempotentRequest("key-1", body))
+
+	expected := newFingerprint(idempotentRequest("key-1", body))
+	_, _ = expected.Write([]byte(body))
+	assert.EqualValues(t, `{"a":1}`+"\n", w.Body.String())
+	assert.EqualValues(t, expected.String(), fingerprint)
+}
+
+func TestIdempotency_RenewedWhileInProgress(t *testing.T) {
+	defer func(interval time.Duration) {
+		IdempotencyRenewInterval = interval
+	}(IdempotencyRenewInterval)
+	IdempotencyRenewInterval = 5 * time.Millisecond
+
+	var renewed int32
+	mocks.BeginFunc = func(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+		return nil, nil
+	}
+	mocks.RenewFunc = func(ctx context.Context, key string) error {
+		atomic.AddInt32(&renewed, 1)
+		return nil
+	}
+	mocks.CompleteFunc = func(ctx context.Context, key string, fp string, statusCode int, headers map[string]string,
+		body []byte) error {
+		return nil
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/orders", Idempotency(&mocks.MockIdempotencyDataService{}), func(c *gin.Context) {
+		time.Sleep(50 * time.Millisecond)
+		c.Status(http.StatusCreated)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), idempotentRequest("key-1", "{}"))
+
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&renewed), int32(2))
+	// Not anymore once the request is done
+	done := atomic.LoadInt32(&renewed)
+	time.Sleep(20 * time.Millisecond)
+	assert.EqualValues(t, done, atomic.LoadInt32(&renewed))
+}
+
+func TestIdempotency_ReleaseOnServerError(t *testing.T) {
+	calls := 0
+	released := false
+	mocks.BeginFunc = func(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+		return nil, nil
+	}
+	mocks.ReleaseFunc = func(ctx context.Context, key string) error {
+		released = true
+		return nil
+	}
+	mocks.CompleteFunc = func(ctx context.Context, key string, fp string, statusCode int, headers map[string]string,
+		body []byte) error {
+		t.Error("server errors must not be stored")
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	idempotentRouter(&calls, http.StatusInternalServerError).ServeHTTP(w, idempotentRequest("key-1", "{}"))
+
+	assert.EqualValues(t, http.StatusInternalServerError, w.Code)
+	assert.True(t, released)
+}
+
+func TestIdempotency_ReleaseOnPanic(t *testing.T) {
+	defer func(interval time.Duration) {
+		IdempotencyRenewInterval = interval
+	}(IdempotencyRenewInterval)
+	IdempotencyRenewInterval = 5 * time.Millisecond
+
+	var renewed, released int32
+	mocks.BeginFunc = func(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+		return nil, nil
+	}
+	mocks.RenewFunc = func(ctx context.Context, key string) error {
+		atomic.AddInt32(&renewed, 1)
+		return nil
+	}
+	mocks.ReleaseFunc = func(ctx context.Context, key string) error {
+		atomic.AddInt32(&released, 1)
+		return nil
+	}
+	mocks.CompleteFunc = func(ctx context.Context, key string, fp string, statusCode int, headers map[string]string,
+		body []byte) error {
+		t.Error("panics must not be stored")
+		return nil
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Recovery())
+	r.POST("/orders", Idempotency(&mocks.MockIdempotencyDataService{}), func(c *gin.Context) {
+		time.Sleep(20 * time.Millisecond)
+		panic("handler failed")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, idempotentRequest("key-1", "{}"))
+
+	assert.EqualValues(t, http.StatusInternalServerError, w.Code)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&released))
+	done := atomic.LoadInt32(&renewed)
+	time.Sleep(20 * time.Millisecond)
+	assert.EqualValues(t, done, atomic.LoadInt32(&renewed))
+}
+
+func TestIdempotency_StoreError(t *testing.T) {
+	calls := 0
+	mocks.BeginFunc = func(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+		return nil, errors.New("db error")
+	}
+
+	w := httptest.NewRecorder()
+	idempotentRouter(&calls, http.StatusCreated).ServeHTTP(w, idempotentRequest("key-1", "{}"))
+
+	assert.EqualValues(t, http.StatusInternalServerError, w.Code)
+	assert.EqualValues(t, 0, calls)
+}
+
+func TestIdempotency_KeyPerCaller(t *testing.T) {
+	var reserved string
+	mocks.BeginFunc = func(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+		reserved = key
+		return nil, nil
+	}
+	mocks.CompleteFunc = func(ctx context.Context, key string, fp string, statusCode int, headers map[string]string,
+		body []byte) error {
+		return nil
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/orders", func(c *gin.Context) {
+		auth.SetPrincipal(c, &models.Principal{Subject: "alice"})
+	}, Idempotency(&mocks.MockIdempotencyDataService{}), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), idempotentRequest("key-1", "{}"))
+
+	assert.EqualValues(t, "alice/key-1", reserved)
+}
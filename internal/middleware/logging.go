@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// unmatchedRoute - Route of the requests matching none, e.g. 404s
+const unmatchedRoute = "unmatched"
+
+// AccessLog - Logs every request as a JSON line through zerolog: 5xx as errors, 4xx as warnings and the others as info.
+// Only one in every sampleSuccess 2xx requests is logged, all of them when it is 0 or 1, and requests to skipPaths,
+// exactly or as a prefix ending with '*', are not logged at all.
+func AccessLog(skipPaths []string, sampleSuccess uint32) gin.HandlerFunc {
+	sampler := &zerolog.BasicSampler{N: sampleSuccess}
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		c.Next()
+
+		if isPublic(path, skipPaths) {
+			return
+		}
+		status := c.Writer.Status()
+		// Carries the request ID, and the principal once the request is authenticated
+		logger := log.Ctx(c.Request.Context())
+		var event *zerolog.Event
+		switch {
+		case status >= http.StatusInternalServerError:
+			event = logger.Error()
+		case status >= http.StatusBadRequest:
+			event = logger.Warn()
+		case status < http.StatusMultipleChoices && sampleSuccess > 1 && !sampler.Sample(zerolog.InfoLevel):
+			return
+		default:
+			event = logger.Info()
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+		event.Str("method", c.Request.Method).
+			Str("route", route).
+			Str("path", path).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Int("bytes", size).
+			Str("client_ip", c.ClientIP()).
+			Str("user_agent", c.Request.UserAgent())
+		if len(c.Errors) > 0 {
+			event.Str("errors", c.Errors.String())
+		}
+		event.Msg("request")
+	}
+}
+
+// Recovery - Turns panics into 500 responses, logging them through zerolog rather than gin's plain text output
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err interface{}) {
+		log.Ctx(c.Request.Context()).Error().
+			Interface("panic", err).
+			Str("path", c.Request.URL.Path).
+			Bytes("stack", debug.Stack()).
+			Msg("recovered from panic")
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
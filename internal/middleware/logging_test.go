@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/auth"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// loggedRouter - Router logging requests into out
+func loggedRouter(out *bytes.Buffer, sampleSuccess uint32) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		logger := zerolog.New(out)
+		c.Request = c.Request.WithContext(logger.WithContext(c.Request.Context()))
+	}, RequestID(), AccessLog([]string{"/status", "/swagger/*"}, sampleSuccess), Recovery())
+	r.GET("/status", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/orders/:id", func(c *gin.Context) {
+		auth.SetPrincipal(c, &models.Principal{Subject: "alice"})
+		c.String(http.StatusOK, "order")
+	})
+	r.GET("/missing", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	return r
+}
+
+func logLines(out *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]interface{}{}
+		_ = json.Unmarshal([]byte(line), &entry)
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func serve(r *gin.Engine, path string) int {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set(RequestIDHeader, "req-1")
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAccessLog(t *testing.T) {
+	var out bytes.Buffer
+	r := loggedRouter(&out, 1)
+
+	assert.EqualValues(t, http.StatusOK, serve(r, "/orders/1"))
+
+	lines := logLines(&out)
+	assert.Len(t, lines, 1)
+	entry := lines[0]
+	assert.EqualValues(t, "info", entry["level"])
+	assert.EqualValues(t, "GET", entry["method"])
+	assert.EqualValues(t, "/orders/:id", entry["route"])
+	assert.EqualValues(t, "/orders/1", entry["path"])
+	assert.EqualValues(t, 200, entry["status"])
+	assert.EqualValues(t, 5, entry["bytes"])
+	assert.EqualValues(t, "test-agent", entry["user_agent"])
+	assert.EqualValues(t, "alice", entry["principal"].(map[string]interface{})["subject"])
+	assert.EqualValues(t, 1, strings.Count(out.String(), `"principal"`))
+	assert.EqualValues(t, "req-1", entry["request_id"])
+	assert.Contains(t, entry, "latency")
+	assert.Contains(t, entry, "client_ip")
+}
+
+func TestAccessLog_Levels(t *testing.T) {
+	type levelTestCase struct {
+		Path   string
+		Status int
+		Level  string
+		Route  string
+	}
+
+	var testCases = []levelTestCase{
+		{"/missing", http.StatusNotFound, "warn", "/missing"},
+		{"/nowhere", http.StatusNotFound, "warn", "unmatched"},
+		{"/panic", http.StatusInternalServerError, "error", "/panic"},
+	}
+
+	for _, tc := range testCases {
+		var out bytes.Buffer
+		r := loggedRouter(&out, 1)
+
+		assert.EqualValues(t, tc.Status, serve(r, tc.Path), tc.Path)
+
+		lines := logLines(&out)
+		last := lines[len(lines)-1]
+		assert.EqualValues(t, tc.Level, last["level"], tc.Path)
+		assert.EqualValues(t, tc.Route, last["route"], tc.Path)
+		assert.EqualValues(t, tc.Status, last["status"], tc.Path)
+	}
+}
+
+func TestAccessLog_Skipped(t *testing.T) {
+	var out bytes.Buffer
+	r := loggedRouter(&out, 1)
+
+	serve(r, "/status")
+	serve(r, "/swagger/index.html")
+
+	assert.Empty(t, out.String())
+}
+
+func TestAccessLog_Sampling(t *testing.T) {
+	var out bytes.Buffer
+	r := loggedRouter(&out, 3)
+
+	for i := 0; i < 6; i++ {
+		serve(r, "/orders/1")
+	}
+	serve(r, "/missing")
+
+	lines := logLines(&out)
+	// Two in six successes, every failure
+	assert.Len(t, lines, 3)
+	assert.EqualValues(t, 404, lines[2]["status"])
+}
+
+func TestRecovery(t *testing.T) {
+	var out bytes.Buffer
+	r := loggedRouter(&out, 1)
+
+	assert.EqualValues(t, http.StatusInternalServerError, serve(r, "/panic"))
+
+	lines := logLines(&out)
+	assert.Len(t, lines, 2)
+	assert.EqualValues(t, "boom", lines[0]["panic"])
+	assert.Contains(t, lines[0], "stack")
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rameshsunkara/go-rest-api-example/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Metrics())
+	var inFlight float64
+	r.GET("/metered/:id", func(c *gin.Context) {
+		inFlight = testutil.ToFloat64(metrics.HTTPRequestsInFlight.WithLabelValues(http.MethodGet, "/metered/:id"))
+		c.Status(http.StatusAccepted)
+	})
+
+	requests := func(route, status string) float64 {
+		return testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, route, status))
+	}
+	matched, unmatched := requests("/metered/:id", "202"), requests(unmatchedRoute, "404")
+
+	for _, path := range []string{"/metered/1", "/metered/2", "/missing"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.EqualValues(t, 1, inFlight)
+	assert.EqualValues(t, 0, testutil.ToFloat64(metrics.HTTPRequestsInFlight.WithLabelValues(http.MethodGet,
+		"/metered/:id")))
+	assert.EqualValues(t, matched+2, requests("/metered/:id", "202"))
+	assert.EqualValues(t, unmatched+1, requests(unmatchedRoute, "404"))
+	assert.GreaterOrEqual(t, testutil.CollectAndCount(metrics.HTTPRequestDuration), 2)
+}
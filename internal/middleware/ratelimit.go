@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/auth"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/rameshsunkara/go-rest-api-example/internal/ratelimit"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RetryAfterHeader         = "Retry-After"
+)
+
+// RateLimit - Limits the requests of each client to the routes of a group, rejecting those over the limit with 429.
+// Clients are told about their quota in RateLimit-* headers. Clients are told apart by API key, then by user, then by
+// IP address. Requests go through when the store fails, an outage of the store must not take the API down.
+func RateLimit(store ratelimit.Store, group string, limit ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := group + "|" + clientKey(c)
+		r, err := store.Take(c, key, limit, time.Now())
+		if err != nil {
+			log.Ctx(c.Request.Context()).Warn().Err(err).Str("group", group).Msg("unable to apply rate limit")
+			c.Next()
+			return
+		}
+
+		c.Header(RateLimitLimitHeader, strconv.Itoa(r.Limit))
+		c.Header(RateLimitRemainingHeader, strconv.Itoa(r.Remaining))
+		c.Header(RateLimitResetHeader, seconds(r.Reset))
+		if !r.Allowed {
+			c.Header(RetryAfterHeader, seconds(r.RetryAfter))
+			abortProblem(c, models.Problem{
+				Status: http.StatusTooManyRequests,
+				Detail: "rate limit of " + group + " exceeded, retry in " + seconds(r.RetryAfter) + "s",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientKey - Who the request is counted against
+func clientKey(c *gin.Context) string {
+	if p := auth.PrincipalFrom(c); p != nil {
+		if p.KeyID != "" {
+			return "key:" + p.KeyID
+		}
+		return "user:" + p.Subject
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// seconds - Duration in whole seconds, rounded up so that clients never come back too early
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/auth"
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/rameshsunkara/go-rest-api-example/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func rateLimitedRouter(store ratelimit.Store) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if sub := c.GetHeader("X-Subject"); sub != "" {
+			auth.SetPrincipal(c, &models.Principal{Subject: sub, KeyID: c.GetHeader("X-Key-Id")})
+		}
+	})
+	r.GET("/orders", RateLimit(store, "orders", ratelimit.Limit{Rate: 0.5, Burst: 2}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func rateLimitedRequest(r *gin.Engine, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, "/orders", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	r := rateLimitedRouter(ratelimit.NewMemoryStore())
+
+	w := rateLimitedRequest(r, nil)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, "2", w.Header().Get(RateLimitLimitHeader))
+	assert.EqualValues(t, "1", w.Header().Get(RateLimitRemainingHeader))
+	assert.EqualValues(t, "2", w.Header().Get(RateLimitResetHeader))
+
+	rateLimitedRequest(r, nil)
+	w = rateLimitedRequest(r, nil)
+	assert.EqualValues(t, http.StatusTooManyRequests, w.Code)
+	assert.EqualValues(t, "0", w.Header().Get(RateLimitRemainingHeader))
+	assert.EqualValues(t, "2", w.Header().Get(RetryAfterHeader))
+	assert.EqualValues(t, MIMEProblemJSON, w.Header().Get("Content-Type"))
+}
+
+func TestRateLimit_PerClient(t *testing.T) {
+	r := rateLimitedRouter(ratelimit.NewMemoryStore())
+	for i := 0; i < 2; i++ {
+		rateLimitedRequest(r, nil)
+	}
+
+	type perClientTestCase struct {
+		Description string
+		Headers     map[string]string
+	}
+
+	// Each gets a bucket of its own, unaffected by the exhausted one of the IP address
+	var testCases = []perClientTestCase{
+		{"user", map[string]string{"X-Subject": "alice"}},
+		{"other user", map[string]string{"X-Subject": "bob"}},
+		{"api key of the user", map[string]string{"X-Subject": "alice", "X-Key-Id": "1"}},
+		{"other ip", map[string]string{"X-Forwarded-For": "10.0.0.2"}},
+	}
+
+	for _, tc := range testCases {
+		w := rateLimitedRequest(r, tc.Headers)
+		assert.EqualValues(t, http.StatusOK, w.Code, tc.Description)
+	}
+}
+
+// failingStore - Store which is down
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit, time.Time) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store down")
+}
+
+func TestRateLimit_StoreError(t *testing.T) {
+	r := rateLimitedRouter(failingStore{})
+
+	for i := 0; i < 3; i++ {
+		w := rateLimitedRequest(r, nil)
+		assert.EqualValues(t, http.StatusOK, w.Code)
+	}
+}
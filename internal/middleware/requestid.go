@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RequestIDHeader    = "X-Request-ID"
+	TraceparentHeader  = "traceparent"
+	RequestIDKey       = "request_id"
+	MaxRequestIDLength = 128
+)
+
+// TraceContext - Trace the request is part of, as carried by a W3C traceparent header
+type TraceContext struct {
+	TraceID  string
+	ParentID string
+	Flags    string
+}
+
+func (t TraceContext) String() string {
+	return "00-" + t.TraceID + "-" + t.ParentID + "-" + t.Flags
+}
+
+// RequestID - Identifies every request, with the X-Request-ID sent by the client or, when there is none, with the id of
+// the trace it is part of. The trace is the one of the span of the request when it is traced, else the one of the
+// traceparent header sent by the client, or a new one. Both are echoed in the response, every line logged with the
+// logger of the request context carries them, and JSON error responses include the request ID.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		trace, ok := spanTrace(c.Request.Context())
+		if !ok {
+			if trace, ok = ParseTraceparent(c.GetHeader(TraceparentHeader)); !ok {
+				trace = TraceContext{TraceID: randomHex(16), Flags: "00"}
+			}
+			// This service's part of the trace, for whoever it calls next
+			trace.ParentID = randomHex(8)
+		}
+
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = trace.TraceID
+		}
+
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Header(TraceparentHeader, trace.String())
+		logger := log.Ctx(c.Request.Context()).With().
+			Str(RequestIDKey, id).
+			Str("trace_id", trace.TraceID).
+			Logger()
+		c.Request = c.Request.WithContext(logger.WithContext(c.Request.Context()))
+		c.Writer = &requestIDWriter{ResponseWriter: c.Writer, id: id}
+		c.Next()
+	}
+}
+
+// RequestIDFrom - ID of the request, empty when it went through no RequestID middleware
+func RequestIDFrom(c *gin.Context) string {
+	return c.GetString(RequestIDKey)
+}
+
+// ParseTraceparent - Reads a traceparent header of version 00, see https://www.w3.org/TR/trace-context/#traceparent-header
+func ParseTraceparent(header string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || parts[0] == "ff" || !isHex(parts[0], 2) || (parts[0] == "00" && len(parts) != 4) {
+		return TraceContext{}, false
+	}
+	t := TraceContext{TraceID: parts[1], ParentID: parts[2], Flags: parts[3]}
+	if !isHex(t.TraceID, 32) || !isHex(t.ParentID, 16) || !isHex(t.Flags, 2) ||
+		strings.Trim(t.TraceID, "0") == "" || strings.Trim(t.ParentID, "0") == "" {
+		return TraceContext{}, false
+	}
+	return t, true
+}
+
+// spanTrace - Trace of the span in ctx, set up by the tracing middleware
+func spanTrace(ctx context.Context) (TraceContext, bool) {
+	sc := oteltrace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return TraceContext{}, false
+	}
+	return TraceContext{
+		TraceID:  sc.TraceID().String(),
+		ParentID: sc.SpanID().String(),
+		Flags:    sc.TraceFlags().String(),
+	}, true
+}
+
+// isHex - Whether s is made of n lowercase hex digits
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// validRequestID - Request IDs from clients end up in logs and headers, so only short visible ASCII ones are accepted
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' || r == '"' || r == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDWriter - Adds the request ID to JSON error responses, whichever handler writes them
+type requestIDWriter struct {
+	gin.ResponseWriter
+	id string
+}
+
+func (w *requestIDWriter) Write(b []byte) (int, error) {
+	if w.Status() < http.StatusBadRequest || w.Size() > 0 || len(b) < 2 || b[0] != '{' ||
+		!strings.Contains(w.Header().Get("Content-Type"), "json") {
+		return w.ResponseWriter.Write(b)
+	}
+
+	quoted, _ := json.Marshal(w.id)
+	var body bytes.Buffer
+	body.WriteString(`{"` + RequestIDKey + `":`)
+	body.Write(quoted)
+	if len(bytes.TrimSpace(b[1:])) > 1 {
+		body.WriteByte(',')
+	}
+	body.Write(b[1:])
+	if _, err := w.ResponseWriter.Write(body.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+func requestIDRouter(out *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		logger := zerolog.New(out)
+		c.Request = c.Request.WithContext(logger.WithContext(c.Request.Context()))
+	}, RequestID())
+	r.GET("/orders", func(c *gin.Context) {
+		log.Ctx(c.Request.Context()).Info().Msg("listing orders")
+		c.JSON(http.StatusOK, gin.H{"request": RequestIDFrom(c)})
+	})
+	r.GET("/missing", func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "order not found"})
+	})
+	r.GET("/empty", func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, gin.H{})
+	})
+	r.GET("/text", func(c *gin.Context) {
+		c.String(http.StatusInternalServerError, "{not json")
+	})
+	return r
+}
+
+func TestRequestID(t *testing.T) {
+	type requestIDTestCase struct {
+		Description string
+		Headers     map[string]string
+		RequestID   string
+		TraceID     string
+	}
+
+	var testCases = []requestIDTestCase{
+		{"client request id", map[string]string{RequestIDHeader: "abc-123"}, "abc-123", ""},
+		{"trace id as request id", map[string]string{TraceparentHeader: "00-" + testTraceID + "-00f067aa0ba902b7-01"},
+			testTraceID, testTraceID},
+		{"both", map[string]string{RequestIDHeader: "abc-123", TraceparentHeader: "00-" + testTraceID + "-00f067aa0ba902b7-01"},
+			"abc-123", testTraceID},
+		{"invalid request id", map[string]string{RequestIDHeader: "has space"}, "", ""},
+		{"too long request id", map[string]string{RequestIDHeader: strings.Repeat("a", MaxRequestIDLength+1)}, "", ""},
+		{"invalid traceparent", map[string]string{TraceparentHeader: "00-" + testTraceID + "-0000000000000000-01"}, "", ""},
+		{"none", nil, "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			var out bytes.Buffer
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/orders", nil)
+			for name, value := range tc.Headers {
+				req.Header.Set(name, value)
+			}
+
+			requestIDRouter(&out).ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			trace, ok := ParseTraceparent(w.Header().Get(TraceparentHeader))
+			assert.True(t, ok)
+			if tc.RequestID != "" {
+				assert.EqualValues(t, tc.RequestID, id)
+			} else {
+				assert.EqualValues(t, trace.TraceID, id)
+			}
+			if tc.TraceID != "" {
+				assert.EqualValues(t, tc.TraceID, trace.TraceID)
+				assert.NotEqual(t, "00f067aa0ba902b7", trace.ParentID)
+				assert.EqualValues(t, "01", trace.Flags)
+			}
+			assert.JSONEq(t, `{"request":"`+id+`"}`, w.Body.String())
+
+			var entry map[string]interface{}
+			assert.Nil(t, json.Unmarshal(out.Bytes(), &entry))
+			assert.EqualValues(t, id, entry[RequestIDKey])
+			assert.EqualValues(t, trace.TraceID, entry["trace_id"])
+		})
+	}
+}
+
+func TestRequestID_Span(t *testing.T) {
+	traceID, _ := oteltrace.TraceIDFromHex(testTraceID)
+	spanID, _ := oteltrace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: oteltrace.FlagsSampled,
+	})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(oteltrace.ContextWithSpanContext(c.Request.Context(), sc))
+	}, RequestID())
+	r.GET("/orders", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/orders", nil)
+	// The span already continues the caller's trace
+	req.Header.Set(TraceparentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	r.ServeHTTP(w, req)
+
+	assert.EqualValues(t, testTraceID, w.Header().Get(RequestIDHeader))
+	assert.EqualValues(t, "00-"+testTraceID+"-00f067aa0ba902b7-01", w.Header().Get(TraceparentHeader))
+}
+
+func TestRequestID_ErrorResponses(t *testing.T) {
+	type errorResponseTestCase struct {
+		Path     string
+		Expected string
+	}
+
+	var testCases = []errorResponseTestCase{
+		{"/missing", `{"request_id":"abc-123","message":"order not found"}`},
+		{"/empty", `{"request_id":"abc-123"}`},
+		{"/text", `{not json`},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, tc.Path, nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+
+		requestIDRouter(&bytes.Buffer{}).ServeHTTP(w, req)
+
+		assert.EqualValues(t, tc.Expected, w.Body.String(), tc.Path)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	valid := []string{
+		"00-" + testTraceID + "-00f067aa0ba902b7-01",
+		"00-" + testTraceID + "-00f067aa0ba902b7-00",
+		// Later versions may carry more fields
+		"01-" + testTraceID + "-00f067aa0ba902b7-01-extra",
+	}
+	for _, header := range valid {
+		_, ok := ParseTraceparent(header)
+		assert.True(t, ok, header)
+	}
+
+	invalid := []string{
+		"",
+		"garbage",
+		"ff-" + testTraceID + "-00f067aa0ba902b7-01",
+		"00-" + testTraceID + "-00f067aa0ba902b7-01-extra",
+		"00-" + strings.ToUpper(testTraceID) + "-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-" + testTraceID + "-00f067aa0ba902b7-1",
+	}
+	for _, header := range invalid {
+		_, ok := ParseTraceparent(header)
+		assert.False(t, ok, header)
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"bytes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bodyRecorder - Keeps a copy of everything written to the response
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func newBodyRecorder(w gin.ResponseWriter) *bodyRecorder {
+	return &bodyRecorder{ResponseWriter: w, body: &bytes.Buffer{}}
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
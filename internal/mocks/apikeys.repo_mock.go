@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+)
+
+var (
+	CreateAPIKeyFunc  func(ctx context.Context, key *models.APIKey) error
+	GetAPIKeyByIdFunc func(ctx context.Context, id string) (*models.APIKey, error)
+	GetAllAPIKeysFunc func(ctx context.Context, owner string) ([]models.APIKey, error)
+	RotateAPIKeyFunc  func(ctx context.Context, id string, hash string) (*models.APIKey, error)
+	RevokeAPIKeyFunc  func(ctx context.Context, id string) (*models.APIKey, error)
+	TouchAPIKeyFunc   func(ctx context.Context, id string, at time.Time) error
+)
+
+type MockAPIKeysDataService struct{}
+
+func (m *MockAPIKeysDataService) Create(ctx context.Context, key *models.APIKey) error {
+	return CreateAPIKeyFunc(ctx, key)
+}
+
+func (m *MockAPIKeysDataService) GetById(ctx context.Context, id string) (*models.APIKey, error) {
+	return GetAPIKeyByIdFunc(ctx, id)
+}
+
+func (m *MockAPIKeysDataService) GetAll(ctx context.Context, owner string) ([]models.APIKey, error) {
+	return GetAllAPIKeysFunc(ctx, owner)
+}
+
+func (m *MockAPIKeysDataService) Rotate(ctx context.Context, id string, hash string) (*models.APIKey, error) {
+	return RotateAPIKeyFunc(ctx, id, hash)
+}
+
+func (m *MockAPIKeysDataService) Revoke(ctx context.Context, id string) (*models.APIKey, error) {
+	return RevokeAPIKeyFunc(ctx, id)
+}
+
+func (m *MockAPIKeysDataService) Touch(ctx context.Context, id string, at time.Time) error {
+	return TouchAPIKeyFunc(ctx, id, at)
+}
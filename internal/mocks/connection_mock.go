@@ -1,27 +1,41 @@
 package mocks
 
 import (
+	"context"
+
 	"github.com/rameshsunkara/go-rest-api-example/internal/db"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
-	PingFunc func() error
+	PingFunc       func(ctx context.Context) error
+	ReconnectFunc  func(connUrl string) error
+	DisconnectFunc func() error
 )
 
 type MockMongoMgr struct{}
 
-func (m *MockMongoMgr) Ping() error {
-	return PingFunc()
+func (m *MockMongoMgr) Ping(ctx context.Context) error {
+	return PingFunc(ctx)
 }
 
 func (m *MockMongoMgr) Database() db.MongoDatabase {
 	return &MockMongoDataBase{}
 }
 
+func (m *MockMongoMgr) Reconnect(connUrl string) error {
+	if ReconnectFunc == nil {
+		return nil
+	}
+	return ReconnectFunc(connUrl)
+}
+
 func (m *MockMongoMgr) Disconnect() error {
-	return nil
+	if DisconnectFunc == nil {
+		return nil
+	}
+	return DisconnectFunc()
 }
 
 type MockMongoDataBase struct{}
@@ -0,0 +1,34 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+)
+
+var (
+	BeginFunc    func(ctx context.Context, key string) (*models.IdempotencyRecord, error)
+	RenewFunc    func(ctx context.Context, key string) error
+	CompleteFunc func(ctx context.Context, key string, fingerprint string, statusCode int, headers map[string]string,
+		body []byte) error
+	ReleaseFunc func(ctx context.Context, key string) error
+)
+
+type MockIdempotencyDataService struct{}
+
+func (m *MockIdempotencyDataService) Begin(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+	return BeginFunc(ctx, key)
+}
+
+func (m *MockIdempotencyDataService) Renew(ctx context.Context, key string) error {
+	return RenewFunc(ctx, key)
+}
+
+func (m *MockIdempotencyDataService) Complete(ctx context.Context, key string, fingerprint string, statusCode int,
+	headers map[string]string, body []byte) error {
+	return CompleteFunc(ctx, key, fingerprint, statusCode, headers, body)
+}
+
+func (m *MockIdempotencyDataService) Release(ctx context.Context, key string) error {
+	return ReleaseFunc(ctx, key)
+}
@@ -0,0 +1,57 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+)
+
+var (
+	CreateJobFunc      func(ctx context.Context, job *models.Job) error
+	GetJobByIdFunc     func(ctx context.Context, id string) (*models.Job, error)
+	ClaimJobFunc       func(ctx context.Context, id string) (*models.Job, error)
+	HeartbeatFunc      func(ctx context.Context, id string) (bool, error)
+	ReportProgressFunc func(ctx context.Context, id string, progress models.JobProgress) (bool, error)
+	FinishJobFunc      func(ctx context.Context, id string, status models.JobStatus, result map[string]interface{}, errMsg string) error
+	CancelJobFunc      func(ctx context.Context, id string) (*models.Job, error)
+	RequeueJobFunc     func(ctx context.Context, id string) error
+	RecoverJobsFunc    func(ctx context.Context) ([]string, error)
+)
+
+type MockJobsDataService struct{}
+
+func (m *MockJobsDataService) Create(ctx context.Context, job *models.Job) error {
+	return CreateJobFunc(ctx, job)
+}
+
+func (m *MockJobsDataService) GetById(ctx context.Context, id string) (*models.Job, error) {
+	return GetJobByIdFunc(ctx, id)
+}
+
+func (m *MockJobsDataService) Claim(ctx context.Context, id string) (*models.Job, error) {
+	return ClaimJobFunc(ctx, id)
+}
+
+func (m *MockJobsDataService) Heartbeat(ctx context.Context, id string) (bool, error) {
+	return HeartbeatFunc(ctx, id)
+}
+
+func (m *MockJobsDataService) ReportProgress(ctx context.Context, id string, progress models.JobProgress) (bool, error) {
+	return ReportProgressFunc(ctx, id, progress)
+}
+
+func (m *MockJobsDataService) Finish(ctx context.Context, id string, status models.JobStatus, result map[string]interface{}, errMsg string) error {
+	return FinishJobFunc(ctx, id, status, result, errMsg)
+}
+
+func (m *MockJobsDataService) Cancel(ctx context.Context, id string) (*models.Job, error) {
+	return CancelJobFunc(ctx, id)
+}
+
+func (m *MockJobsDataService) Requeue(ctx context.Context, id string) error {
+	return RequeueJobFunc(ctx, id)
+}
+
+func (m *MockJobsDataService) Recover(ctx context.Context) ([]string, error) {
+	return RecoverJobsFunc(ctx)
+}
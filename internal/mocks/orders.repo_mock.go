@@ -3,15 +3,22 @@ package mocks
 import (
 	"context"
 
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var (
-	CreateFunc     func(ctx context.Context, purchaseOrder interface{}) (*mongo.InsertOneResult, error)
-	UpdateFunc     func(ctx context.Context, purchaseOrder interface{}) (int64, error)
-	GetAllFunc     func(ctx context.Context) (interface{}, error)
-	GetByIdFunc    func(ctx context.Context, id string) (interface{}, error)
-	DeleteByIdFunc func(ctx context.Context, id string) (int64, error)
+	CreateFunc       func(ctx context.Context, purchaseOrder interface{}) (*mongo.InsertOneResult, error)
+	CreateManyFunc   func(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error)
+	UpdateFunc       func(ctx context.Context, purchaseOrder interface{}) (int64, error)
+	ReplaceFunc      func(ctx context.Context, id string, purchaseOrder interface{}, upsert bool) (bool, error)
+	GetAllFunc       func(ctx context.Context, fields ...string) (interface{}, error)
+	GetByIdFunc      func(ctx context.Context, id string, fields ...string) (interface{}, error)
+	CountFunc        func(ctx context.Context, exact bool) (int64, error)
+	StreamFunc       func(ctx context.Context, each func(order *models.Order) error, fields ...string) error
+	DeleteByIdFunc   func(ctx context.Context, id string) (int64, error)
+	DeleteSeededFunc func(ctx context.Context) (int64, error)
 )
 
 type MockOrdersDataService struct{}
@@ -20,18 +27,38 @@ func (m *MockOrdersDataService) Create(ctx context.Context, purchaseOrder interf
 	return CreateFunc(ctx, purchaseOrder)
 }
 
+func (m *MockOrdersDataService) CreateMany(ctx context.Context, purchaseOrders []*models.Order) (*mongo.InsertManyResult, error) {
+	return CreateManyFunc(ctx, purchaseOrders)
+}
+
 func (m *MockOrdersDataService) Update(ctx context.Context, purchaseOrder interface{}) (int64, error) {
 	return UpdateFunc(ctx, purchaseOrder)
 }
 
-func (m *MockOrdersDataService) GetAll(ctx context.Context) (interface{}, error) {
-	return GetAllFunc(ctx)
+func (m *MockOrdersDataService) Replace(ctx context.Context, id string, purchaseOrder interface{}, upsert bool) (bool, error) {
+	return ReplaceFunc(ctx, id, purchaseOrder, upsert)
 }
 
-func (m *MockOrdersDataService) GetById(ctx context.Context, id string) (interface{}, error) {
-	return GetByIdFunc(ctx, id)
+func (m *MockOrdersDataService) GetAll(ctx context.Context, fields ...string) (interface{}, error) {
+	return GetAllFunc(ctx, fields...)
+}
+
+func (m *MockOrdersDataService) GetById(ctx context.Context, id string, fields ...string) (interface{}, error) {
+	return GetByIdFunc(ctx, id, fields...)
+}
+
+func (m *MockOrdersDataService) Count(ctx context.Context, exact bool) (int64, error) {
+	return CountFunc(ctx, exact)
+}
+
+func (m *MockOrdersDataService) Stream(ctx context.Context, each func(order *models.Order) error, fields ...string) error {
+	return StreamFunc(ctx, each, fields...)
 }
 
 func (m *MockOrdersDataService) DeleteById(ctx context.Context, id string) (int64, error) {
 	return DeleteByIdFunc(ctx, id)
 }
+
+func (m *MockOrdersDataService) DeleteSeeded(ctx context.Context) (int64, error) {
+	return DeleteSeededFunc(ctx)
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ScopeOrdersRead  = "orders:read"
+	ScopeOrdersWrite = "orders:write"
+	ScopeAdmin       = "admin"
+)
+
+// APIKeyScopes - Scopes an API key can be granted
+var APIKeyScopes = []string{ScopeOrdersRead, ScopeOrdersWrite, ScopeAdmin}
+
+// APIKey - Credentials of a machine client. Only a hash of the secret is kept, the key itself is shown once.
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name       string             `bson:"name" json:"name"`
+	Owner      string             `bson:"owner" json:"owner"`
+	Org        string             `bson:"org,omitempty" json:"org,omitempty"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	Hash       string             `bson:"hash" json:"-"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt  *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time         `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	RotatedAt  *time.Time         `bson:"rotated_at,omitempty" json:"rotated_at,omitempty"`
+	RevokedAt  *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+// Active - Whether the key can be used at the given time
+func (k *APIKey) Active(at time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || at.Before(*k.ExpiresAt))
+}
+
+// APIKeyRequest - What a new API key is for
+type APIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Owner     string     `json:"owner"`
+	Org       string     `json:"org"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// IssuedAPIKey - API key along with its secret, returned once when the key is created or rotated
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// IdempotencyRecord - Outcome of a request made with an Idempotency-Key, replayed when the key is used again
+type IdempotencyRecord struct {
+	Key string `bson:"_id"`
+	// Fingerprint - Identifies the request, known once it completed as its body is read while it's served
+	Fingerprint string            `bson:"fingerprint,omitempty"`
+	Completed   bool              `bson:"completed"`
+	StatusCode  int               `bson:"status_code,omitempty"`
+	Headers     map[string]string `bson:"headers,omitempty"`
+	Body        []byte            `bson:"body,omitempty"`
+	CreatedAt   time.Time         `bson:"created_at"`
+	// ExpiresAt - When the record is deleted, and the key can be used for another request
+	ExpiresAt time.Time `bson:"expires_at"`
+	// LockedUntil - Until when the request in progress holds the key, which it keeps pushing back until it completes
+	LockedUntil time.Time `bson:"locked_until,omitempty"`
+}
@@ -0,0 +1,20 @@
+package models
+
+// ImportReport - Outcome of a bulk import, rows are identified by their line in the uploaded file
+type ImportReport struct {
+	DryRun   bool             `json:"dry_run"`
+	Accepted int              `json:"accepted"`
+	Rejected int              `json:"rejected"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+type ImportRowError struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// Reject - Records that the order starting at line was not imported
+func (r *ImportReport) Reject(line int, reason string) {
+	r.Rejected++
+	r.Errors = append(r.Errors, ImportRowError{Line: line, Reason: reason})
+}
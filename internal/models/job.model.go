@@ -0,0 +1,61 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// Job - Long running operation executed in the background, its state is persisted so that it survives restarts
+type Job struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Type   string             `bson:"type" json:"type"`
+	Status JobStatus          `bson:"status" json:"status"`
+	// Owner, Org - Who submitted the job, set from the caller and decisive for who else can see or cancel it
+	Owner           string                 `bson:"owner,omitempty" json:"owner,omitempty"`
+	Org             string                 `bson:"org,omitempty" json:"org,omitempty"`
+	Params          map[string]interface{} `bson:"params,omitempty" json:"params,omitempty"`
+	Progress        JobProgress            `bson:"progress" json:"progress"`
+	Result          map[string]interface{} `bson:"result,omitempty" json:"result,omitempty"`
+	Error           string                 `bson:"error,omitempty" json:"error,omitempty"`
+	CancelRequested bool                   `bson:"cancel_requested" json:"cancel_requested"`
+	Attempts        int                    `bson:"attempts" json:"attempts"`
+	CreatedAt       time.Time              `bson:"created_at" json:"created_at"`
+	StartedAt       *time.Time             `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	FinishedAt      *time.Time             `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	HeartbeatAt     *time.Time             `bson:"heartbeat_at,omitempty" json:"-"`
+}
+
+// JobProgress - Units of work done out of the total, when the total is known
+type JobProgress struct {
+	Done  int `bson:"done" json:"done"`
+	Total int `bson:"total" json:"total"`
+}
+
+// Finished - Whether the job reached a state it will not leave
+func (j *Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// DecodeParams - Fills v from the parameters of the job, which are shaped like the JSON representation of v
+func (j *Job) DecodeParams(v interface{}) error {
+	if len(j.Params) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(j.Params)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
@@ -1,6 +1,11 @@
 package models
 
 import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -21,16 +26,64 @@ func (s ServiceInfo) MarshalZerologObject(e *zerolog.Event) {
 		Str("version", s.Version)
 }
 
+// Order - Fields are omitted from JSON and XML when empty, so that partially fetched orders only carry what was asked for
 type Order struct {
-	ID            primitive.ObjectID `bson:"_id,omitempty" json:"order_id"`
-	LastUpdatedAt string             `bson:"last_updated_at,omitempty"`
-	Products      []Product          `bson:"products,omitempty"`
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"order_id" xml:"order_id"`
+	LastUpdatedAt string             `bson:"last_updated_at,omitempty" json:"LastUpdatedAt,omitempty" xml:"LastUpdatedAt,omitempty"`
+	Products      []Product          `bson:"products,omitempty" json:"Products,omitempty" xml:"Products>Product,omitempty"`
+	// Owner, Org - Who created the order, set from the caller and decisive for who else can see it
+	Owner string `bson:"owner,omitempty" json:"owner,omitempty" xml:"owner,omitempty"`
+	Org   string `bson:"org,omitempty" json:"org,omitempty" xml:"org,omitempty"`
+	// Seeded - Fake order inserted to seed the DB, see SeedParams
+	Seeded bool `bson:"seeded,omitempty" json:"-" xml:"-"`
+}
+
+// MarshalJSON - Leaves out order_id when it isn't set, which omitempty can't do for an ObjectID
+func (o Order) MarshalJSON() ([]byte, error) {
+	type order Order
+	var id *primitive.ObjectID
+	if !o.ID.IsZero() {
+		id = &o.ID
+	}
+	return json.Marshal(struct {
+		ID *primitive.ObjectID `json:"order_id,omitempty"`
+		order
+	}{id, order(o)})
+}
+
+// MarshalXML - Same as MarshalJSON, for XML
+func (o Order) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type order Order
+	var id *primitive.ObjectID
+	if !o.ID.IsZero() {
+		id = &o.ID
+	}
+	return e.EncodeElement(struct {
+		ID *primitive.ObjectID `xml:"order_id,omitempty"`
+		order
+	}{id, order(o)}, start)
+}
+
+// Validate - Checks that the order is complete enough to be stored
+func (o *Order) Validate() error {
+	if len(o.Products) == 0 {
+		return errors.New("order has no products")
+	}
+	for i, p := range o.Products {
+		if strings.TrimSpace(p.Name) == "" {
+			return fmt.Errorf("product %d has no name", i+1)
+		}
+		if p.Price == 0 {
+			return fmt.Errorf("product %d has no price", i+1)
+		}
+	}
+	return nil
 }
 
 type Product struct {
-	Name      string `bson:"name,omitempty"`
-	UpdatedAt string `bson:"updated_at,omitempty"`
-	Price     uint   `bson:"price,omitempty"`
-	Status    string `bson:"status,omitempty"`
-	Remarks   string `bson:"remarks,omitempty"`
+	Name      string `bson:"name,omitempty" json:"Name,omitempty" xml:"Name,omitempty"`
+	UpdatedAt string `bson:"updated_at,omitempty" json:"UpdatedAt,omitempty" xml:"UpdatedAt,omitempty"`
+	Price     uint   `bson:"price,omitempty" json:"Price,omitempty" xml:"Price,omitempty"`
+	Status    string `bson:"status,omitempty" json:"Status,omitempty" xml:"Status,omitempty"`
+	Remarks   string `bson:"remarks,omitempty" json:"Remarks,omitempty" xml:"Remarks,omitempty"`
 }
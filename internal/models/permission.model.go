@@ -0,0 +1,25 @@
+package models
+
+// Permissions checked by the routes, granted to callers through their roles
+const (
+	PermOrdersRead    = "orders:read"
+	PermOrdersWrite   = "orders:write"
+	PermOrdersDelete  = "orders:delete"
+	PermOrdersOrg     = "orders:org" // See the orders of the caller's organization, not only their own
+	PermOrdersAll     = "orders:all" // See every order
+	PermJobsRead      = "jobs:read"
+	PermJobsCancel    = "jobs:cancel"
+	PermDBSeed        = "db:seed"
+	PermDebugRead     = "debug:read"
+	PermAPIKeysManage = "apikeys:manage"
+)
+
+// Problem - Error response as described in RFC 7807
+type Problem struct {
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Status     int    `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	Instance   string `json:"instance,omitempty"`
+	Permission string `json:"permission,omitempty"`
+}
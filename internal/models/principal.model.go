@@ -0,0 +1,63 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// PrincipalKey - Key of the principal in the gin context
+const PrincipalKey = "principal"
+
+type principalKey struct{}
+
+// Visibility - Orders a caller can see and change, their own unless granted more
+type Visibility int
+
+const (
+	VisibilityOwn Visibility = iota // Orders the caller owns
+	VisibilityOrg                   // Orders of the caller's organization
+	VisibilityAll                   // Every order
+)
+
+// Principal - Caller identified by the credentials of a request
+type Principal struct {
+	Subject    string     `json:"subject"`
+	Issuer     string     `json:"issuer,omitempty"`
+	Method     string     `json:"method"`
+	KeyID      string     `json:"key_id,omitempty"`
+	Org        string     `json:"org,omitempty"`
+	Scopes     []string   `json:"scopes,omitempty"`
+	Roles      []string   `json:"roles,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at,omitempty"`
+	Visibility Visibility `json:"-"`
+}
+
+func (p Principal) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("subject", p.Subject).
+		Str("method", p.Method)
+	if p.Issuer != "" {
+		e.Str("issuer", p.Issuer)
+	}
+	if p.KeyID != "" {
+		e.Str("key_id", p.KeyID)
+	}
+	if p.Org != "" {
+		e.Str("org", p.Org)
+	}
+}
+
+// ContextWithPrincipal - Copy of ctx carrying the caller
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext - Caller ctx belongs to, nil when there is none. Gin contexts keep it under PrincipalKey.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	if p, ok := ctx.Value(principalKey{}).(*Principal); ok {
+		return p
+	}
+	p, _ := ctx.Value(PrincipalKey).(*Principal)
+	return p
+}
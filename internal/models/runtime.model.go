@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// RuntimeStats - Snapshot of the Go runtime of the service
+type RuntimeStats struct {
+	GoVersion  string      `json:"go_version"`
+	Uptime     string      `json:"uptime"`
+	NumCPU     int         `json:"num_cpu"`
+	GOMAXPROCS int         `json:"gomaxprocs"`
+	Goroutines int         `json:"goroutines"`
+	CgoCalls   int64       `json:"cgo_calls"`
+	Memory     MemoryStats `json:"memory"`
+	GC         GCStats     `json:"gc"`
+	Collected  time.Time   `json:"collected_at"`
+}
+
+// MemoryStats - Bytes, and objects, allocated by the service
+type MemoryStats struct {
+	Alloc        uint64 `json:"alloc"`
+	TotalAlloc   uint64 `json:"total_alloc"`
+	Sys          uint64 `json:"sys"`
+	HeapAlloc    uint64 `json:"heap_alloc"`
+	HeapInuse    uint64 `json:"heap_inuse"`
+	HeapIdle     uint64 `json:"heap_idle"`
+	HeapReleased uint64 `json:"heap_released"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	StackInuse   uint64 `json:"stack_inuse"`
+	Mallocs      uint64 `json:"mallocs"`
+	Frees        uint64 `json:"frees"`
+}
+
+// GCStats - Garbage collections so far
+type GCStats struct {
+	NumGC         uint32     `json:"num_gc"`
+	NumForcedGC   uint32     `json:"num_forced_gc"`
+	PauseTotal    string     `json:"pause_total"`
+	LastPause     string     `json:"last_pause"`
+	LastGC        *time.Time `json:"last_gc,omitempty"`
+	NextGC        uint64     `json:"next_gc"`
+	GCCPUFraction float64    `json:"gc_cpu_fraction"`
+}
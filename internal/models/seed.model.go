@@ -0,0 +1,121 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultSeedCount       = 500
+	DefaultSeedProducts    = 2
+	DefaultSeedPeriod      = 30 * 24 * time.Hour
+	MaxSeedCount           = 100000
+	MaxSeedProductsInOrder = 50
+)
+
+var fixtureName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// SeedParams - What to seed the DB with. Given the same params, and Seed in particular, the same orders are generated.
+type SeedParams struct {
+	Count            int                `json:"count,omitempty"`
+	ProductsPerOrder SeedRange          `json:"products_per_order"`
+	Statuses         map[string]float64 `json:"status_distribution,omitempty"`
+	From             time.Time          `json:"from"`
+	To               time.Time          `json:"to"`
+	Seed             *RandomSeed        `json:"seed,omitempty"`
+	// Fixture - Name of a file of orders, without its .json extension, loaded instead of generating orders
+	Fixture string `json:"fixture,omitempty"`
+}
+
+// RandomSeed - Seed of the generated orders. Written as a JSON string so that it stays exact in the params of a job,
+// which are decoded as float64, it's read from a number as well.
+type RandomSeed int64
+
+func (s RandomSeed) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatInt(int64(s), 10))
+}
+
+func (s *RandomSeed) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	text := string(data)
+	if str, ok := raw.(string); ok {
+		text = str
+	}
+	v, err := strconv.ParseInt(text, 10, 64)
+	// Jobs queued before seeds were strings hold them as float64
+	if f, ok := raw.(float64); ok && err != nil && f == math.Trunc(f) {
+		v, err = int64(f), nil
+	}
+	if err != nil {
+		return fmt.Errorf("seed must be an integer: %w", err)
+	}
+	*s = RandomSeed(v)
+	return nil
+}
+
+type SeedRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// ApplyDefaults - Fills what wasn't given: 500 orders of 2 products, updated over the 30 days before now
+func (p *SeedParams) ApplyDefaults(now time.Time) {
+	if p.Count == 0 {
+		p.Count = DefaultSeedCount
+	}
+	if p.ProductsPerOrder.Min == 0 && p.ProductsPerOrder.Max == 0 {
+		p.ProductsPerOrder = SeedRange{Min: DefaultSeedProducts, Max: DefaultSeedProducts}
+	}
+	if p.ProductsPerOrder.Max == 0 {
+		p.ProductsPerOrder.Max = p.ProductsPerOrder.Min
+	}
+	if p.To.IsZero() {
+		p.To = now.UTC().Truncate(time.Second)
+	}
+	if p.From.IsZero() {
+		p.From = p.To.Add(-DefaultSeedPeriod)
+	}
+	if p.Seed == nil {
+		seed := RandomSeed(now.UnixNano())
+		p.Seed = &seed
+	}
+}
+
+// Validate - Checks the params once defaults are applied
+func (p *SeedParams) Validate() error {
+	if p.Fixture != "" {
+		if !fixtureName.MatchString(p.Fixture) {
+			return fmt.Errorf("invalid fixture name %q", p.Fixture)
+		}
+		return nil
+	}
+	if p.Count < 0 || p.Count > MaxSeedCount {
+		return fmt.Errorf("count must be between 1 and %d", MaxSeedCount)
+	}
+	if p.ProductsPerOrder.Min < 1 || p.ProductsPerOrder.Max < p.ProductsPerOrder.Min ||
+		p.ProductsPerOrder.Max > MaxSeedProductsInOrder {
+		return fmt.Errorf("products_per_order must be a range within 1 and %d", MaxSeedProductsInOrder)
+	}
+	if !p.From.Before(p.To) {
+		return errors.New("from must be before to")
+	}
+	total := 0.0
+	for status, weight := range p.Statuses {
+		if weight < 0 {
+			return fmt.Errorf("weight of status %q is negative", status)
+		}
+		total += weight
+	}
+	if len(p.Statuses) > 0 && total == 0 {
+		return errors.New("status_distribution has no positive weight")
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SweepInterval - How often buckets which are full again, and hence no different from missing ones, are dropped
+const SweepInterval = time.Minute
+
+type memoryBucket struct {
+	Bucket
+	full time.Time
+}
+
+// MemoryStore - Buckets kept in the memory of the replica, so each replica enforces the limits on its own
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*memoryBucket)}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	var current *Bucket
+	if b, ok := s.buckets[key]; ok {
+		current = &b.Bucket
+	}
+	next, r := limit.take(current, now)
+	s.buckets[key] = &memoryBucket{Bucket: next, full: now.Add(r.Reset)}
+	return r, nil
+}
+
+// Len - Number of buckets held
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < SweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+var InvalidLimitErr = errors.New("rate must be positive and burst at least 1")
+
+// Limit - Token bucket: it holds up to Burst tokens, refills at Rate tokens per second and every request takes one
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l Limit) Validate() error {
+	if l.Rate <= 0 || l.Burst < 1 {
+		return InvalidLimitErr
+	}
+	return nil
+}
+
+// Bucket - State of the bucket of a client
+type Bucket struct {
+	Tokens  float64   `json:"tokens" bson:"tokens"`
+	Updated time.Time `json:"updated" bson:"updated"`
+}
+
+// Result - Outcome of taking a token, along with what the client needs to know about its quota
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset - Time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter - Time until a token is available, zero when the request is allowed
+	RetryAfter time.Duration
+}
+
+// Store - Keeps the buckets of the clients. Limits hold across replicas with a store they share, see SharedStore.
+type Store interface {
+	// Take - Takes a token from the bucket under key, when there is one
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// take - Refills the bucket for the time elapsed since its last update and takes a token from it. A nil bucket is a
+// full one.
+func (l Limit) take(b *Bucket, now time.Time) (Bucket, Result) {
+	burst := float64(l.Burst)
+	tokens := burst
+	if b != nil {
+		elapsed := now.Sub(b.Updated).Seconds()
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		tokens = math.Min(burst, b.Tokens+elapsed*l.Rate)
+	}
+
+	r := Result{Limit: l.Burst}
+	if tokens >= 1 {
+		tokens--
+		r.Allowed = true
+	} else {
+		r.RetryAfter = l.duration(1 - tokens)
+	}
+	r.Remaining = int(math.Floor(tokens))
+	r.Reset = l.duration(burst - tokens)
+	return Bucket{Tokens: tokens, Updated: now}, r
+}
+
+// duration - Time it takes to refill the given number of tokens
+func (l Limit) duration(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / l.Rate * float64(time.Second)))
+}
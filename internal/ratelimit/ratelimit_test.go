@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+
+func TestLimitTake(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 3}
+
+	type takeTestCase struct {
+		Description string
+		At          time.Duration
+		Allowed     bool
+		Remaining   int
+		RetryAfter  time.Duration
+	}
+
+	var testCases = []takeTestCase{
+		{"full bucket", 0, true, 2, 0},
+		{"burst", 0, true, 1, 0},
+		{"last token", 0, true, 0, 0},
+		{"empty", 0, false, 0, 500 * time.Millisecond},
+		{"partly refilled", 250 * time.Millisecond, false, 0, 250 * time.Millisecond},
+		{"refilled a token", 500 * time.Millisecond, true, 0, 0},
+		{"refilled up to burst", time.Hour, true, 2, 0},
+	}
+
+	var b *Bucket
+	for _, tc := range testCases {
+		next, r := limit.take(b, start.Add(tc.At))
+		b = &next
+		assert.EqualValues(t, tc.Allowed, r.Allowed, tc.Description)
+		assert.EqualValues(t, tc.Remaining, r.Remaining, tc.Description)
+		assert.EqualValues(t, tc.RetryAfter, r.RetryAfter, tc.Description)
+		assert.EqualValues(t, 3, r.Limit, tc.Description)
+	}
+}
+
+func TestLimitTake_Reset(t *testing.T) {
+	_, r := Limit{Rate: 0.5, Burst: 2}.take(nil, start)
+
+	assert.EqualValues(t, 2*time.Second, r.Reset)
+}
+
+func TestLimitValidate(t *testing.T) {
+	assert.Nil(t, Limit{Rate: 0.1, Burst: 1}.Validate())
+	assert.ErrorIs(t, Limit{Rate: 0, Burst: 1}.Validate(), InvalidLimitErr)
+	assert.ErrorIs(t, Limit{Rate: 1, Burst: 0}.Validate(), InvalidLimitErr)
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 1}
+
+	r, _ := s.Take(context.TODO(), "a", limit, start)
+	assert.True(t, r.Allowed)
+	r, _ = s.Take(context.TODO(), "a", limit, start)
+	assert.False(t, r.Allowed)
+	// Buckets are per key
+	r, _ = s.Take(context.TODO(), "b", limit, start)
+	assert.True(t, r.Allowed)
+	assert.EqualValues(t, 2, s.Len())
+
+	// Full buckets are dropped
+	r, _ = s.Take(context.TODO(), "c", limit, start.Add(SweepInterval))
+	assert.True(t, r.Allowed)
+	assert.EqualValues(t, 1, s.Len())
+}
+
+func TestSharedStore(t *testing.T) {
+	limit := Limit{Rate: 0.001, Burst: 10}
+	state := NewLocalState()
+	// Replicas sharing the state
+	replicas := []Store{NewSharedStore(state), NewSharedStore(state), NewSharedStore(state)}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(s Store) {
+			defer wg.Done()
+			r, err := s.Take(context.TODO(), "a", limit, time.Now())
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil && r.Allowed {
+				allowed++
+			}
+		}(replicas[i%len(replicas)])
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, allowed, limit.Burst)
+	assert.Greater(t, allowed, 0)
+}
+
+func TestLocalState_Expiry(t *testing.T) {
+	state := NewLocalState()
+	now := start
+	state.now = func() time.Time { return now }
+
+	swapped, _ := state.CompareAndSwap(context.TODO(), "a", 0, Bucket{Tokens: 1}, time.Second)
+	assert.True(t, swapped)
+	b, version, _ := state.Get(context.TODO(), "a")
+	assert.NotNil(t, b)
+	assert.EqualValues(t, 1, version)
+
+	// A stale version never wins
+	swapped, _ = state.CompareAndSwap(context.TODO(), "a", 0, Bucket{}, time.Second)
+	assert.False(t, swapped)
+
+	now = now.Add(time.Second)
+	b, version, _ = state.Get(context.TODO(), "a")
+	assert.Nil(t, b)
+	assert.EqualValues(t, 0, version)
+}
+
+// contendedState - Another replica always updates the bucket first
+type contendedState struct{}
+
+func (contendedState) Get(context.Context, string) (*Bucket, int64, error) {
+	return nil, 0, nil
+}
+
+func (contendedState) CompareAndSwap(context.Context, string, int64, Bucket, time.Duration) (bool, error) {
+	return false, nil
+}
+
+func TestSharedStore_Contention(t *testing.T) {
+	_, err := NewSharedStore(contendedState{}).Take(context.TODO(), "a", Limit{Rate: 1, Burst: 1}, start)
+
+	assert.ErrorIs(t, err, ContentionErr)
+}
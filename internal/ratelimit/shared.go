@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// MaxAttempts - How many times SharedStore tries to update a bucket other replicas keep updating
+const MaxAttempts = 5
+
+var ContentionErr = errors.New("bucket kept changing while being updated")
+
+// SharedState - Storage shared by the replicas, such as Redis or Mongo, holding versioned buckets
+type SharedState interface {
+	// Get - Bucket stored under key and its version, nil and 0 when there is none. A bucket full again may be nil
+	// along with its version, to be replaced.
+	Get(ctx context.Context, key string) (*Bucket, int64, error)
+	// CompareAndSwap - Stores the bucket under key as long as its version is still the given one, and returns whether
+	// it did. The bucket can be dropped after ttl, as it is full again by then.
+	CompareAndSwap(ctx context.Context, key string, version int64, b Bucket, ttl time.Duration) (bool, error)
+}
+
+// SharedStore - Buckets kept in state shared by the replicas, so that limits hold across them. Concurrent updates
+// are resolved optimistically, the loser of a race reads the bucket again and retries.
+type SharedStore struct {
+	state SharedState
+}
+
+func NewSharedStore(state SharedState) *SharedStore {
+	return &SharedStore{state: state}
+}
+
+func (s *SharedStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	for attempt := 0; attempt < MaxAttempts; attempt++ {
+		current, version, err := s.state.Get(ctx, key)
+		if err != nil {
+			return Result{}, err
+		}
+		next, r := limit.take(current, now)
+		swapped, err := s.state.CompareAndSwap(ctx, key, version, next, r.Reset)
+		if err != nil {
+			return Result{}, err
+		}
+		if swapped {
+			return r, nil
+		}
+	}
+	return Result{}, ContentionErr
+}
+
+type localEntry struct {
+	bucket  Bucket
+	version int64
+	expires time.Time
+}
+
+// LocalState - SharedState in the memory of the process, standing in for a shared one in tests
+type LocalState struct {
+	mu      sync.Mutex
+	entries map[string]*localEntry
+	now     func() time.Time
+}
+
+func NewLocalState() *LocalState {
+	return &LocalState{entries: make(map[string]*localEntry), now: time.Now}
+}
+
+func (l *LocalState) Get(_ context.Context, key string) (*Bucket, int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[key]
+	if !ok || !l.now().Before(e.expires) {
+		return nil, 0, nil
+	}
+	b := e.bucket
+	return &b, e.version, nil
+}
+
+func (l *LocalState) CompareAndSwap(_ context.Context, key string, version int64, b Bucket, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[key]
+	current := int64(0)
+	if ok && l.now().Before(e.expires) {
+		current = e.version
+	}
+	if current != version {
+		return false, nil
+	}
+	// Versions keep increasing even across expiry, so a stale read never matches
+	next := version + 1
+	if ok && e.version >= next {
+		next = e.version + 1
+	}
+	l.entries[key] = &localEntry{bucket: b, version: next, expires: l.now().Add(ttl)}
+	return true, nil
+}
@@ -1,14 +1,29 @@
 package server
 
 import (
+	"context"
+	"errors"
+
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
+	"github.com/rameshsunkara/go-rest-api-example/internal/auth"
 	"github.com/rameshsunkara/go-rest-api-example/internal/controllers"
 	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/health"
+	"github.com/rameshsunkara/go-rest-api-example/internal/jobs"
+	"github.com/rameshsunkara/go-rest-api-example/internal/metrics"
+	"github.com/rameshsunkara/go-rest-api-example/internal/middleware"
+	"github.com/rameshsunkara/go-rest-api-example/internal/ratelimit"
 	"github.com/rameshsunkara/go-rest-api-example/pkg/util"
+	"github.com/rs/zerolog/log"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/rameshsunkara/go-rest-api-example/internal/config"
 	"github.com/rameshsunkara/go-rest-api-example/internal/models"
@@ -16,61 +31,441 @@ import (
 
 var runOnce sync.Once
 
-func Init(serviceInfo *models.ServiceInfo, manager db.MongoManager) {
-	config := config.GetConfig()
-	port := config.GetString("server.port")
+const (
+	livePath  = "/livez"
+	readyPath = "/readyz"
+)
+
+// Init - Serves the service as configured until ctx is done, then shuts it down gracefully, see App.Run. Only the hot
+// reloadable settings of live are followed once serving.
+func Init(ctx context.Context, serviceInfo *models.ServiceInfo, live *config.Live, manager db.MongoManager) error {
+	var err error
 	runOnce.Do(func() {
-		r := WebRouter(serviceInfo, manager)
-		r.Run(":" + port)
+		cfg := live.Get()
+		monitor := NewHealthMonitor(live, manager)
+		runner := NewJobRunner(cfg, manager)
+		app := &App{
+			API: &http.Server{
+				Addr:    cfg.Server.Addr(),
+				Handler: WebRouter(serviceInfo, live, manager, runner, monitor),
+			},
+			Health:          monitor,
+			Runner:          runner,
+			DB:              manager,
+			ShutdownDelay:   cfg.Server.Shutdown.Delay,
+			ShutdownTimeout: cfg.Server.Shutdown.Timeout,
+			WorkersTimeout:  cfg.Server.Shutdown.WorkersTimeout,
+		}
+		if cfg.Admin.Enabled {
+			app.Admin = &http.Server{Addr: cfg.Admin.Addr, Handler: AdminRouter(serviceInfo, live, manager)}
+		}
+		err = app.Run(ctx)
 	})
+	return err
+}
+
+// App - The listeners of the service and what they depend on, started and stopped together
+type App struct {
+	API *http.Server
+	// Admin - Listener of the admin routes, nil when there is none
+	Admin  *http.Server
+	Health *health.Monitor
+	Runner *jobs.Runner
+	DB     db.MongoManager
+	// ShutdownDelay - Time given to load balancers to notice the service is not ready, before its listeners close
+	ShutdownDelay time.Duration
+	// ShutdownTimeout - Deadline for the requests in flight to finish
+	ShutdownTimeout time.Duration
+	// WorkersTimeout - Deadline for the background workers to stop once the requests are drained, whatever time the
+	// requests took
+	WorkersTimeout time.Duration
+}
+
+// Run - Starts the health checks and the background workers, then serves until ctx is done or the API can't be served.
+// It then shuts down in this order: readiness goes false, the listeners close and the requests in flight are drained,
+// the background workers stop, and finally the DB is disconnected. Returns why the API couldn't be served, if so.
+func (a *App) Run(ctx context.Context) error {
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	a.Health.Start(background)
+	// Handlers are registered by the router, so start only once it's built
+	jobsStarted := a.Health.StartupTask("jobs")
+	a.Runner.Start(background)
+	jobsStarted()
+
+	failed := make(chan error, 1)
+	go func() {
+		log.Info().Str("addr", a.API.Addr).Msg("serving API")
+		if err := a.API.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+	if a.Admin != nil {
+		go func() {
+			log.Info().Str("addr", a.Admin.Addr).Msg("serving admin routes")
+			if err := a.Admin.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Str("addr", a.Admin.Addr).Msg("unable to serve admin routes")
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		log.Info().Msg("shutting down")
+	case err = <-failed:
+		log.Error().Err(err).Str("addr", a.API.Addr).Msg("unable to serve API, shutting down")
+	}
+	a.shutdown(stopBackground)
+	return err
+}
+
+func (a *App) shutdown(stopBackground context.CancelFunc) {
+	a.Health.ShuttingDown()
+	time.Sleep(a.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.ShutdownTimeout)
+	defer cancel()
+
+	// No new connections from now on, those in flight get until the deadline
+	var wg sync.WaitGroup
+	for _, srv := range []*http.Server{a.API, a.Admin} {
+		if srv == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Warn().Err(err).Str("addr", srv.Addr).Msg("requests still in flight at the deadline, dropping them")
+				_ = srv.Close()
+			}
+		}(srv)
+	}
+	wg.Wait()
+	log.Info().Msg("listeners closed")
+
+	// Jobs interrupted from here are picked up again by the next instance to start
+	stopBackground()
+	stopped := make(chan struct{})
+	go func() {
+		a.Runner.Wait()
+		close(stopped)
+	}()
+	timer := time.NewTimer(a.WorkersTimeout)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+		log.Info().Msg("background workers stopped")
+	case <-timer.C:
+		log.Warn().Dur("timeout", a.WorkersTimeout).Strs("jobs", a.Runner.Running()).
+			Msg("background workers still running at the deadline, abandoning them and their jobs")
+	}
+
+	// Logs the failure itself
+	_ = a.DB.Disconnect()
 }
 
-func WebRouter(svcInfo *models.ServiceInfo, dbMgr db.MongoManager) (router *gin.Engine) {
+// NewJobRunner - Runner of the background jobs, sized from the configuration
+func NewJobRunner(cfg *config.Config, dbMgr db.MongoManager) *jobs.Runner {
+	return jobs.NewRunner(db.NewJobsDataService(dbMgr.Database(), cfg.Jobs.Retention),
+		jobs.WithConcurrency(cfg.Jobs.Concurrency))
+}
+
+// NewHealthMonitor - Checks of the dependencies of the service, run every health.interval of live as it's reloaded
+func NewHealthMonitor(live *config.Live, dbMgr db.MongoManager) *health.Monitor {
+	cfg := live.Get()
+	monitor := health.NewMonitor(health.WithIntervalFunc(func() time.Duration {
+		return live.Get().Health.Interval
+	}))
+	monitor.Register(health.NewChecker("mongodb", dbMgr.Ping), cfg.Health.CheckTimeout("mongodb"))
+	return monitor
+}
+
+// WebRouter - Routes of the API. Rate limits, access logging and the idempotency TTL follow live as it's reloaded, the
+// rest is set up from the configuration in use when it's called.
+func WebRouter(svcInfo *models.ServiceInfo, live *config.Live, dbMgr db.MongoManager, runner *jobs.Runner,
+	monitor *health.Monitor) (router *gin.Engine) {
+	cfg := live.Get()
 	ginMode := gin.ReleaseMode
 	if util.IsDevMode(svcInfo.Environment) {
 		ginMode = gin.DebugMode
 		gin.ForceConsoleColor()
 	}
 	gin.SetMode(ginMode)
+	gin.DebugPrintRouteFunc = debugPrintRoute
 
 	// Middleware
-	router = gin.Default()
-	pprof.Register(router) // TODO: Add debug routes only for Admins /debug/*
-	// TODO: Enforce there is authorization information with applicable requests
-	// TODO: log everything from gin in json
+	router = gin.New()
+	// Controllers hand the gin context down to repositories, which log and trace with what the request context holds
+	router.ContextWithFallback = true
+	// Outermost, so that requests failing anywhere below are traced and logged too. Spans are only recorded once
+	// tracing is set up.
+	router.Use(otelgin.Middleware(svcInfo.Name, otelgin.WithFilter(notProbe)), middleware.RequestID(),
+		accessLog(live), middleware.Metrics(), middleware.Recovery())
+	if len(cfg.Server.TrustedProxies) > 0 {
+		if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+			log.Fatal().Err(err).Msg("invalid trusted proxies")
+		}
+	}
+
+	// Routes - Probes, open to the orchestrator whatever the authentication
+	status := controllers.NewStatusController(svcInfo, monitor)
+	router.GET(livePath, status.Live)   // /livez
+	router.GET(readyPath, status.Ready) // /readyz
+
+	// Only routes registered after this are authenticated, so keep it first
+	var policy *auth.Policy
+	if authenticators := authenticators(cfg, dbMgr); len(authenticators) > 0 {
+		policy = newPolicy(cfg)
+		router.Use(middleware.Authenticate(cfg.Auth.PublicPaths, authenticators...), middleware.Visibility(policy))
+	}
+	permit := permitter(policy)
+	limit := rateLimiter(live, NewRateLimitStore(cfg, dbMgr))
 
 	// Routes
 
 	// Routes - Status Check
-	status := controllers.NewStatusController(svcInfo, dbMgr)
 	router.GET("/status", status.CheckStatus) // /status
 
+	// Routes - Metrics, along with the other admin routes when there is an admin listener
+	if !cfg.Admin.Enabled {
+		router.GET("/metrics", permit(models.PermDebugRead), gin.WrapH(metrics.Handler())) // /metrics
+	}
+
 	// Dependencies for controllers
 	d := dbMgr.Database()
 	orders := db.NewOrderDataService(d)
+	idempotency := db.NewIdempotencyDataService(d, func() time.Duration {
+		return live.Get().Idempotency.TTL
+	})
 
 	// Routes - Seed DB
 	if util.IsDevMode(svcInfo.Environment) {
-		seed := controllers.NewSeedController(orders)
-		router.POST("/seedDB", seed.SeedDB) // /seedDB
+		seed := controllers.NewSeedController(orders, runner, controllers.WithFixturesDir(cfg.Seed.FixturesDir))
+		seedGroup := router.Group("", limit("seed"), permit(models.PermDBSeed))
+		seedGroup.POST("/seedDB", seed.SeedDB)       // /seedDB
+		seedGroup.DELETE("/seedDB", seed.WipeSeedDB) // /seedDB
 	}
 
 	// Routes - Orders
 	v1 := router.Group("/api/v1")
 	{
-		ordersGroup := v1.Group("orders")
+		ordersGroup := v1.Group("orders", limit("orders"))
 		{
-			orders := controllers.NewOrdersController(orders)
-			ordersGroup.GET("", orders.GetAll)            // api/v1/orders
-			ordersGroup.GET("/:id", orders.GetById)       // api/v1/orders/:id
-			ordersGroup.POST("", orders.Post)             // api/v1/orders
-			ordersGroup.PUT("", orders.Post)              // api/v1/orders
-			ordersGroup.DELETE("/:id", orders.DeleteById) // api/v1/orders/:id
+			orders := controllers.NewOrdersController(orders,
+				controllers.WithUpsertOnReplace(cfg.Orders.UpsertOnReplace),
+				controllers.WithExportFlushInterval(cfg.Orders.Export.FlushInterval))
+			negotiate := controllers.Negotiate()
+
+			read := ordersGroup.Group("", permit(models.PermOrdersRead))
+			read.GET("", negotiate, controllers.ConditionalGet(), orders.GetAll)       // api/v1/orders
+			read.HEAD("", negotiate, controllers.ConditionalGet(), orders.GetAll)      // api/v1/orders
+			read.GET("/export", orders.Export)                                         // api/v1/orders/export
+			read.GET("/:id", negotiate, controllers.ConditionalGet(), orders.GetById)  // api/v1/orders/:id
+			read.HEAD("/:id", negotiate, controllers.ConditionalGet(), orders.GetById) // api/v1/orders/:id
+
+			write := ordersGroup.Group("", permit(models.PermOrdersWrite))
+			write.POST("/import", middleware.Idempotency(idempotency), orders.Import)     // api/v1/orders/import
+			write.POST("", negotiate, middleware.Idempotency(idempotency), orders.Create) // api/v1/orders
+			write.PUT("/:id", negotiate, orders.Replace)                                  // api/v1/orders/:id
+
+			// Deprecated: replaced by PUT /:id, to be removed in the next release
+			write.PUT("", middleware.Deprecated(ordersGroup.BasePath()+"/{id}"), orders.Post) // api/v1/orders
+
+			del := ordersGroup.Group("", permit(models.PermOrdersDelete))
+			del.DELETE("/:id", orders.DeleteById) // api/v1/orders/:id
+		}
+
+		apiKeysGroup := v1.Group("admin/apikeys", limit("apikeys"), permit(models.PermAPIKeysManage))
+		{
+			apiKeys := controllers.NewAPIKeysController(db.NewAPIKeysDataService(d))
+			apiKeysGroup.POST("", apiKeys.Create)            // api/v1/admin/apikeys
+			apiKeysGroup.GET("", apiKeys.GetAll)             // api/v1/admin/apikeys
+			apiKeysGroup.GET("/:id", apiKeys.GetById)        // api/v1/admin/apikeys/:id
+			apiKeysGroup.POST("/:id/rotate", apiKeys.Rotate) // api/v1/admin/apikeys/:id/rotate
+			apiKeysGroup.DELETE("/:id", apiKeys.Revoke)      // api/v1/admin/apikeys/:id
+		}
+
+		jobsGroup := v1.Group("jobs", limit("jobs"))
+		{
+			jobs := controllers.NewJobsController(runner)
+			jobsGroup.GET("/:id", permit(models.PermJobsRead), jobs.GetById)          // api/v1/jobs/:id
+			jobsGroup.POST("/:id/cancel", permit(models.PermJobsCancel), jobs.Cancel) // api/v1/jobs/:id/cancel
 		}
 	}
 
 	// Routes - Swagger
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// Routes - OPTIONS for everything above, so keep this last
+	registerOptions(router)
+
 	return
 }
+
+// AdminRouter - Metrics and debug routes for operators, served on a listener of their own which is not exposed like the
+// API. Callers need the debug:read permission when admin.auth is set.
+func AdminRouter(svcInfo *models.ServiceInfo, live *config.Live, dbMgr db.MongoManager) *gin.Engine {
+	cfg := live.Get()
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(middleware.RequestID(), accessLog(live), middleware.Recovery())
+	if cfg.Admin.Auth {
+		authenticators := authenticators(cfg, dbMgr)
+		if len(authenticators) == 0 {
+			log.Fatal().Msg("admin.auth requires authentication to be enabled")
+		}
+		router.Use(middleware.Authenticate(nil, authenticators...),
+			middleware.RequirePermission(newPolicy(cfg), models.PermDebugRead))
+	}
+
+	router.GET("/metrics", gin.WrapH(metrics.Handler())) // /metrics
+	pprof.Register(router)                               // /debug/pprof/*
+	debug := controllers.NewDebugController(svcInfo)
+	router.GET("/debug/runtime", debug.RuntimeStats) // /debug/runtime
+	return router
+}
+
+// registerOptions - Answers OPTIONS requests of every registered route with the methods it allows
+func registerOptions(router *gin.Engine) {
+	allowed := make(map[string][]string)
+	var paths []string
+	for _, route := range router.Routes() {
+		if _, ok := allowed[route.Path]; !ok {
+			paths = append(paths, route.Path)
+		}
+		allowed[route.Path] = append(allowed[route.Path], route.Method)
+	}
+
+	for _, p := range paths {
+		methods := allowed[p]
+		if contains(methods, http.MethodOptions) {
+			continue
+		}
+		methods = append(methods, http.MethodOptions)
+		sort.Strings(methods)
+		allow := strings.Join(methods, ", ")
+		router.OPTIONS(p, func(c *gin.Context) {
+			c.Header("Allow", allow)
+			c.Status(http.StatusNoContent)
+		})
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// accessLog - Request logging, every request except those to server.accessLog.skipPaths and a sample of the successful
+// ones as set by server.accessLog.successSampling. Set up again whenever the configuration is reloaded.
+func accessLog(live *config.Live) gin.HandlerFunc {
+	var mu sync.Mutex
+	var builtFrom *config.Config
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		cfg := live.Get()
+		mu.Lock()
+		if cfg != builtFrom {
+			builtFrom = cfg
+			handler = middleware.AccessLog(cfg.Server.AccessLog.SkipPaths, cfg.Server.AccessLog.SuccessSampling)
+		}
+		h := handler
+		mu.Unlock()
+		h(c)
+	}
+}
+
+// debugPrintRoute - Lists the routes as they are registered in debug mode, through zerolog like every other log
+func debugPrintRoute(httpMethod, absolutePath, handlerName string, nuHandlers int) {
+	log.Debug().Str("method", httpMethod).Str("route", absolutePath).Str("handler", handlerName).
+		Int("handlers", nuHandlers).Msg("route registered")
+}
+
+// NewRateLimitStore - Store of the rate limit buckets chosen by ratelimit.store, shared by the replicas through the DB
+// or in the memory of this one
+func NewRateLimitStore(cfg *config.Config, dbMgr db.MongoManager) ratelimit.Store {
+	if cfg.RateLimit.Store == config.RateLimitStoreMongo {
+		return ratelimit.NewSharedStore(db.NewRateLimitState(dbMgr.Database()))
+	}
+	return ratelimit.NewMemoryStore()
+}
+
+// rateLimiter - Builds the middleware limiting the requests of each client to a group of routes, as configured under
+// ratelimit.groups.<group> at the time of the request. Groups without a limit, or all of them when rate limiting is
+// disabled, are not limited.
+func rateLimiter(live *config.Live, store ratelimit.Store) func(group string) gin.HandlerFunc {
+	return func(group string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			cfg := live.Get().RateLimit
+			limit, ok := cfg.Groups[group]
+			if !cfg.Enabled || !ok {
+				c.Next()
+				return
+			}
+			middleware.RateLimit(store, group, limit.Limit())(c)
+		}
+	}
+}
+
+func passThrough(c *gin.Context) {
+	c.Next()
+}
+
+// notProbe - Whether the request isn't a liveness or readiness probe, which aren't worth tracing
+func notProbe(r *http.Request) bool {
+	return r.URL.Path != livePath && r.URL.Path != readyPath
+}
+
+// authenticators - Ways callers can authenticate, none when authentication is disabled
+func authenticators(cfg *config.Config, dbMgr db.MongoManager) []auth.Authenticator {
+	if !cfg.Auth.Enabled {
+		log.Warn().Msg("authentication is disabled, every route is open")
+		return nil
+	}
+
+	var authenticators []auth.Authenticator
+	if jwt := cfg.Auth.JWT; jwt.Secret != "" || jwt.JWKS != "" {
+		jwtAuth, err := auth.NewJWTAuthenticator(auth.JWTConfig{
+			Secret:      jwt.Secret,
+			JWKS:        jwt.JWKS,
+			JWKSRefresh: jwt.JWKSRefresh,
+			Issuer:      jwt.Issuer,
+			Audience:    jwt.Audience,
+			ClockSkew:   jwt.ClockSkew,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to set up JWT authentication")
+		}
+		authenticators = append(authenticators, jwtAuth)
+	}
+	return append(authenticators, auth.NewAPIKeyAuthenticator(db.NewAPIKeysDataService(dbMgr.Database())))
+}
+
+// newPolicy - Roles from the configuration, the default ones when there are none
+func newPolicy(cfg *config.Config) *auth.Policy {
+	roles := auth.DefaultRoles
+	if len(cfg.Auth.Roles) > 0 {
+		roles = cfg.Auth.Roles
+	}
+	return auth.NewPolicy(roles)
+}
+
+// permitter - Builds the middleware checking a permission of the caller, which lets everything through when there is
+// no policy i.e. authentication is disabled
+func permitter(policy *auth.Policy) func(permission string) gin.HandlerFunc {
+	if policy == nil {
+		return func(string) gin.HandlerFunc {
+			return passThrough
+		}
+	}
+
+	return func(permission string) gin.HandlerFunc {
+		return middleware.RequirePermission(policy, permission)
+	}
+}
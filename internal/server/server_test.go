@@ -1,15 +1,31 @@
 package server_test
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rameshsunkara/go-rest-api-example/internal/config"
+	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/health"
+	"github.com/rameshsunkara/go-rest-api-example/internal/jobs"
 	"github.com/rameshsunkara/go-rest-api-example/internal/mocks"
 	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/rameshsunkara/go-rest-api-example/internal/ratelimit"
 	"github.com/rameshsunkara/go-rest-api-example/internal/server"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -21,8 +37,17 @@ var (
 	}
 )
 
+// openConfig - Default configuration with authentication off, so that routes are called without credentials
+func openConfig() *config.Config {
+	cfg := config.Default(svcInfo.Environment)
+	cfg.Auth.Enabled = false
+	return cfg
+}
+
 func TestListOfRoutes(t *testing.T) {
-	router := server.WebRouter(svcInfo, &mocks.MockMongoMgr{})
+	cfg := openConfig()
+	router := server.WebRouter(svcInfo, config.NewLive(cfg), &mocks.MockMongoMgr{},
+		jobs.NewRunner(&mocks.MockJobsDataService{}), health.NewMonitor())
 	list := router.Routes()
 	mode := gin.Mode()
 
@@ -33,11 +58,28 @@ func TestListOfRoutes(t *testing.T) {
 		Path:   "/status",
 	})
 
+	// Served by the admin router only
+	assertRouteNotPresent(t, list, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/debug/pprof/",
+	})
+
+	// Without an admin listener
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/metrics",
+	})
+
 	assertRouteNotPresent(t, list, gin.RouteInfo{
 		Method: http.MethodPost,
 		Path:   "/seedDB",
 	})
 
+	assertRouteNotPresent(t, list, gin.RouteInfo{
+		Method: http.MethodDelete,
+		Path:   "/seedDB",
+	})
+
 	assertRoutePresent(t, list, gin.RouteInfo{
 		Method: http.MethodGet,
 		Path:   "/api/v1/orders",
@@ -58,16 +100,396 @@ func TestListOfRoutes(t *testing.T) {
 		Path:   "/api/v1/orders",
 	})
 
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodPut,
+		Path:   "/api/v1/orders/:id",
+	})
+
 	assertRoutePresent(t, list, gin.RouteInfo{
 		Method: http.MethodDelete,
 		Path:   "/api/v1/orders/:id",
 	})
 
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodHead,
+		Path:   "/api/v1/orders",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodHead,
+		Path:   "/api/v1/orders/:id",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/api/v1/orders/export",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodPost,
+		Path:   "/api/v1/orders/import",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/api/v1/jobs/:id",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodPost,
+		Path:   "/api/v1/jobs/:id/cancel",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodOptions,
+		Path:   "/api/v1/orders/:id",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodPost,
+		Path:   "/api/v1/admin/apikeys",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/api/v1/admin/apikeys",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodPost,
+		Path:   "/api/v1/admin/apikeys/:id/rotate",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodDelete,
+		Path:   "/api/v1/admin/apikeys/:id",
+	})
+}
+
+func TestOptions(t *testing.T) {
+	cfg := openConfig()
+	router := server.WebRouter(svcInfo, config.NewLive(cfg), &mocks.MockMongoMgr{},
+		jobs.NewRunner(&mocks.MockJobsDataService{}), health.NewMonitor())
+
+	type optionsTestCase struct {
+		Path          string
+		ExpectedAllow string
+	}
+	var testCases = []optionsTestCase{
+		{"/status", "GET, OPTIONS"},
+		{"/api/v1/orders", "GET, HEAD, OPTIONS, POST, PUT"},
+		{"/api/v1/orders/629536b3fac02728de50c042", "DELETE, GET, HEAD, OPTIONS, PUT"},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodOptions, tc.Path, nil)
+		router.ServeHTTP(w, req)
+
+		assert.EqualValues(t, http.StatusNoContent, w.Code, tc.Path)
+		assert.EqualValues(t, tc.ExpectedAllow, w.Header().Get("Allow"), tc.Path)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	cfg := config.Default(svcInfo.Environment)
+	cfg.Auth.Enabled = true
+	cfg.Auth.PublicPaths = []string{"/status"}
+	cfg.Auth.JWT.Secret = "test-secret"
+	mocks.PingFunc = func(ctx context.Context) error {
+		return nil
+	}
+	monitor := server.NewHealthMonitor(config.NewLive(cfg), &mocks.MockMongoMgr{})
+	monitor.Refresh(context.Background())
+	router := server.WebRouter(svcInfo, config.NewLive(cfg), &mocks.MockMongoMgr{},
+		jobs.NewRunner(&mocks.MockJobsDataService{}), monitor)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/orders", nil)
+	router.ServeHTTP(w, req)
+	assert.EqualValues(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/status", nil)
+	router.ServeHTTP(w, req)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+
+	// Probes are open even when left out of the public paths
+	for _, path := range []string{"/livez", "/readyz"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, req)
+		assert.EqualValues(t, http.StatusOK, w.Code, path)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	cfg := openConfig()
+	mocks.PingFunc = func(ctx context.Context) error {
+		return errors.New("DB Connection Failed")
+	}
+	monitor := server.NewHealthMonitor(config.NewLive(cfg), &mocks.MockMongoMgr{})
+	router := server.WebRouter(svcInfo, config.NewLive(cfg), &mocks.MockMongoMgr{},
+		jobs.NewRunner(&mocks.MockJobsDataService{}), monitor)
+
+	type probeTestCase struct {
+		Path           string
+		ExpectedStatus int
+	}
+	var testCases = []probeTestCase{
+		{"/livez", http.StatusOK},
+		{"/readyz", http.StatusServiceUnavailable},
+		{"/status", http.StatusFailedDependency},
+	}
+
+	// Until the first check, and while the DB is down
+	for i := 0; i < 2; i++ {
+		for _, tc := range testCases {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tc.Path, nil)
+			router.ServeHTTP(w, req)
+			assert.EqualValues(t, tc.ExpectedStatus, w.Code, tc.Path)
+		}
+		monitor.Refresh(context.Background())
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	cfg := config.Default(svcInfo.Environment)
+	cfg.Auth.Enabled = true
+	cfg.Auth.JWT.Secret = "test-secret"
+	router := server.WebRouter(svcInfo, config.NewLive(cfg), &mocks.MockMongoMgr{},
+		jobs.NewRunner(&mocks.MockJobsDataService{}), health.NewMonitor())
+	mocks.GetJobByIdFunc = func(ctx context.Context, id string) (*models.Job, error) {
+		return &models.Job{Status: models.JobRunning}, nil
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "alice",
+		"roles": []string{"reader"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("test-secret"))
+
+	type authorizationTestCase struct {
+		Method string
+		Path   string
+		Status int
+	}
+	var testCases = []authorizationTestCase{
+		{http.MethodGet, "/api/v1/jobs/629536b3fac02728de50c042", http.StatusOK},
+		{http.MethodPost, "/api/v1/jobs/629536b3fac02728de50c042/cancel", http.StatusForbidden},
+		{http.MethodDelete, "/api/v1/orders/629536b3fac02728de50c042", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/admin/apikeys", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.Method, tc.Path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		assert.EqualValues(t, tc.Status, w.Code, tc.Path)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg := openConfig()
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.Groups = map[string]config.RateLimitGroup{"jobs": {Rate: 0.001, Burst: 1}}
+	live := config.NewLive(cfg)
+	router := server.WebRouter(svcInfo, live, &mocks.MockMongoMgr{},
+		jobs.NewRunner(&mocks.MockJobsDataService{}), health.NewMonitor())
+	mocks.GetJobByIdFunc = func(ctx context.Context, id string) (*models.Job, error) {
+		return &models.Job{Status: models.JobRunning}, nil
+	}
+
+	codes := make([]int, 0, 2)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/jobs/629536b3fac02728de50c042", nil)
+		router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	assert.EqualValues(t, []int{http.StatusOK, http.StatusTooManyRequests}, codes)
+
+	// Followed as the configuration is reloaded
+	reloaded := *cfg
+	reloaded.RateLimit.Enabled = false
+	live.Set(&reloaded)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/jobs/629536b3fac02728de50c042", nil)
+	router.ServeHTTP(w, req)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+}
+
+func TestNewRateLimitStore(t *testing.T) {
+	type rateLimitStoreTestCase struct {
+		Description string
+		Store       string
+		Expected    ratelimit.Store
+	}
+	var testCases = []rateLimitStoreTestCase{
+		{"memory", config.RateLimitStoreMemory, &ratelimit.MemoryStore{}},
+		{"shared through the DB", config.RateLimitStoreMongo, &ratelimit.SharedStore{}},
+	}
+
+	for _, tc := range testCases {
+		cfg := openConfig()
+		cfg.RateLimit.Store = tc.Store
+		assert.IsType(t, tc.Expected, server.NewRateLimitStore(cfg, &mocks.MockMongoMgr{}), tc.Description)
+	}
+}
+
+func TestRateLimit_SharedStore(t *testing.T) {
+	cfg := openConfig()
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.Store = config.RateLimitStoreMongo
+	cfg.RateLimit.Groups = map[string]config.RateLimitGroup{"jobs": {Rate: 0.001, Burst: 1}}
+	router := server.WebRouter(svcInfo, config.NewLive(cfg), &mocks.MockMongoMgr{},
+		jobs.NewRunner(&mocks.MockJobsDataService{}), health.NewMonitor())
+	mocks.GetJobByIdFunc = func(ctx context.Context, id string) (*models.Job, error) {
+		return &models.Job{Status: models.JobRunning}, nil
+	}
+
+	// The mocked DB has no collections, requests aren't limited when the buckets can't be read
+	codes := make([]int, 0, 2)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/jobs/629536b3fac02728de50c042", nil)
+		router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	assert.EqualValues(t, []int{http.StatusOK, http.StatusOK}, codes)
+}
+
+func TestRequestID(t *testing.T) {
+	cfg := openConfig()
+	router := server.WebRouter(svcInfo, config.NewLive(cfg), &mocks.MockMongoMgr{},
+		jobs.NewRunner(&mocks.MockJobsDataService{}), health.NewMonitor())
+	mocks.GetJobByIdFunc = func(ctx context.Context, id string) (*models.Job, error) {
+		return nil, db.JobNotFoundErr
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/jobs/629536b3fac02728de50c042", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	router.ServeHTTP(w, req)
+
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+	assert.EqualValues(t, "req-1", w.Header().Get("X-Request-ID"))
+	assert.NotEmpty(t, w.Header().Get("traceparent"))
+	assert.Contains(t, w.Body.String(), `"request_id":"req-1"`)
+}
+
+func TestTracing(t *testing.T) {
+	cfg := openConfig()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	router := server.WebRouter(svcInfo, config.NewLive(cfg), &mocks.MockMongoMgr{},
+		jobs.NewRunner(&mocks.MockJobsDataService{}), health.NewMonitor())
+	mocks.GetJobByIdFunc = func(ctx context.Context, id string) (*models.Job, error) {
+		return &models.Job{Status: models.JobRunning}, nil
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/jobs/629536b3fac02728de50c042", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(w, req)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		span := spans[0]
+		assert.EqualValues(t, "/api/v1/jobs/:id", span.Name())
+		assert.EqualValues(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+		assert.EqualValues(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+		assert.EqualValues(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+span.SpanContext().SpanID().String()+"-01",
+			w.Header().Get("traceparent"))
+	}
+}
+
+func TestAdminRouter(t *testing.T) {
+	cfg := openConfig()
+	list := server.AdminRouter(svcInfo, config.NewLive(cfg), &mocks.MockMongoMgr{}).Routes()
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/debug/pprof/",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/debug/runtime",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/metrics",
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	cfg := openConfig()
+	cfg.Admin.Enabled = true
+	router := server.WebRouter(svcInfo, config.NewLive(cfg), &mocks.MockMongoMgr{},
+		jobs.NewRunner(&mocks.MockJobsDataService{}), health.NewMonitor())
+	assertRouteNotPresent(t, router.Routes(), gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/metrics",
+	})
+	mocks.GetJobByIdFunc = func(ctx context.Context, id string) (*models.Job, error) {
+		return nil, db.JobNotFoundErr
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/jobs/629536b3fac02728de50c042", nil)
+	router.ServeHTTP(w, req)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/metrics", nil)
+	server.AdminRouter(svcInfo, config.NewLive(cfg), &mocks.MockMongoMgr{}).ServeHTTP(w, req)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(),
+		`http_requests_total{method="GET",route="/api/v1/jobs/:id",status="404"}`)
+}
+
+func TestAdminAuthentication(t *testing.T) {
+	cfg := config.Default(svcInfo.Environment)
+	cfg.Auth.Enabled = true
+	cfg.Auth.JWT.Secret = "test-secret"
+	cfg.Admin.Auth = true
+	router := server.AdminRouter(svcInfo, config.NewLive(cfg), &mocks.MockMongoMgr{})
+
+	type adminAuthTestCase struct {
+		Roles  []string
+		Status int
+	}
+	var testCases = []adminAuthTestCase{
+		{nil, http.StatusUnauthorized},
+		{[]string{"reader"}, http.StatusForbidden},
+		{[]string{"admin"}, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/debug/runtime", nil)
+		if tc.Roles != nil {
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"sub":   "alice",
+				"roles": tc.Roles,
+				"exp":   time.Now().Add(time.Hour).Unix(),
+			}).SignedString([]byte("test-secret"))
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+		assert.EqualValues(t, tc.Status, w.Code, tc.Roles)
+	}
 }
 
 func TestModeSpecificRoutes(t *testing.T) {
+	cfg := openConfig()
 	svcInfo.Environment = "dev"
-	router := server.WebRouter(svcInfo, &mocks.MockMongoMgr{})
+	router := server.WebRouter(svcInfo, config.NewLive(cfg), &mocks.MockMongoMgr{},
+		jobs.NewRunner(&mocks.MockJobsDataService{}), health.NewMonitor())
 	list := router.Routes()
 	mode := gin.Mode()
 
@@ -95,3 +517,193 @@ func assertRouteNotPresent(t *testing.T, gotRoutes gin.RoutesInfo, wantRoute gin
 		}
 	}
 }
+
+func TestAppShutdown(t *testing.T) {
+	type shutdownTestCase struct {
+		Description     string
+		ShutdownTimeout time.Duration
+		ExpectDrained   bool
+	}
+	var testCases = []shutdownTestCase{
+		{"drained", time.Second, true},
+		{"deadline", 50 * time.Millisecond, false},
+	}
+
+	for _, tc := range testCases {
+		var mu sync.Mutex
+		var events []string
+		record := func(event string) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, event)
+		}
+		mocks.RecoverJobsFunc = func(ctx context.Context) ([]string, error) {
+			return nil, nil
+		}
+		mocks.DisconnectFunc = func() error {
+			record("disconnected")
+			return nil
+		}
+		defer func() {
+			mocks.DisconnectFunc = nil
+		}()
+
+		router := gin.New()
+		router.GET("/slow", func(c *gin.Context) {
+			time.Sleep(300 * time.Millisecond)
+			record("request done")
+			c.Status(http.StatusOK)
+		})
+		app := &server.App{
+			API:             &http.Server{Addr: freeAddr(t), Handler: router},
+			Admin:           &http.Server{Addr: freeAddr(t), Handler: gin.New()},
+			Health:          health.NewMonitor(),
+			Runner:          jobs.NewRunner(&mocks.MockJobsDataService{}),
+			DB:              &mocks.MockMongoMgr{},
+			ShutdownTimeout: tc.ShutdownTimeout,
+			WorkersTimeout:  time.Second,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- app.Run(ctx)
+		}()
+		assert.Eventually(t, func() bool {
+			conn, err := net.Dial("tcp", app.API.Addr)
+			if err == nil {
+				conn.Close()
+			}
+			return err == nil
+		}, time.Second, 10*time.Millisecond, tc.Description)
+
+		slow := make(chan error)
+		go func() {
+			resp, err := http.Get("http://" + app.API.Addr + "/slow")
+			if err == nil {
+				resp.Body.Close()
+			}
+			slow <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+
+		assert.Nil(t, <-done, tc.Description)
+		ready, _ := app.Health.Ready()
+		assert.False(t, ready, tc.Description)
+		for _, addr := range []string{app.API.Addr, app.Admin.Addr} {
+			_, err := net.Dial("tcp", addr)
+			assert.NotNil(t, err, tc.Description)
+		}
+		if tc.ExpectDrained {
+			assert.Nil(t, <-slow, tc.Description)
+			assert.EqualValues(t, []string{"request done", "disconnected"}, events, tc.Description)
+		} else {
+			assert.NotNil(t, <-slow, tc.Description)
+			mu.Lock()
+			assert.EqualValues(t, []string{"disconnected"}, events, tc.Description)
+			mu.Unlock()
+		}
+		app.Runner.Wait()
+	}
+}
+
+func TestAppShutdown_WorkersTimeout(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	started := make(chan struct{})
+	mocks.RecoverJobsFunc = func(ctx context.Context) ([]string, error) {
+		return []string{"629536b3fac02728de50c042"}, nil
+	}
+	mocks.ClaimJobFunc = func(ctx context.Context, id string) (*models.Job, error) {
+		return &models.Job{Type: "stubborn", Status: models.JobRunning}, nil
+	}
+	mocks.HeartbeatFunc = func(ctx context.Context, id string) (bool, error) {
+		return false, nil
+	}
+	mocks.FinishJobFunc = func(ctx context.Context, id string, status models.JobStatus,
+		result map[string]interface{}, errMsg string) error {
+		record("job done")
+		return nil
+	}
+	mocks.DisconnectFunc = func() error {
+		record("disconnected")
+		return nil
+	}
+	defer func() {
+		mocks.DisconnectFunc = nil
+	}()
+
+	runner := jobs.NewRunner(&mocks.MockJobsDataService{})
+	runner.Register("stubborn", func(ctx context.Context, job *models.Job, progress jobs.Progress) (
+		map[string]interface{}, error) {
+		close(started)
+		// Ignores the cancellation
+		time.Sleep(500 * time.Millisecond)
+		return nil, nil
+	})
+	app := &server.App{
+		API:             &http.Server{Addr: freeAddr(t), Handler: gin.New()},
+		Health:          health.NewMonitor(),
+		Runner:          runner,
+		DB:              &mocks.MockMongoMgr{},
+		ShutdownTimeout: time.Hour,
+		WorkersTimeout:  50 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- app.Run(ctx)
+	}()
+	<-started
+	cancel()
+
+	// Requests had plenty of time left, workers are left behind at their own deadline all the same
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(300 * time.Millisecond):
+		t.Fatal("shutdown waited for the workers past their deadline")
+	}
+	mu.Lock()
+	assert.EqualValues(t, []string{"disconnected"}, events)
+	mu.Unlock()
+	app.Runner.Wait()
+}
+
+func TestAppServeFailure(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	mocks.RecoverJobsFunc = func(ctx context.Context) ([]string, error) {
+		return nil, nil
+	}
+	app := &server.App{
+		API:             &http.Server{Addr: taken.Addr().String(), Handler: gin.New()},
+		Health:          health.NewMonitor(),
+		Runner:          jobs.NewRunner(&mocks.MockJobsDataService{}),
+		DB:              &mocks.MockMongoMgr{},
+		ShutdownTimeout: time.Second,
+		WorkersTimeout:  time.Second,
+	}
+
+	assert.NotNil(t, app.Run(context.Background()))
+}
+
+// freeAddr - Local address nothing listens on
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterNone   = "none"
+)
+
+var (
+	UnknownExporterErr      = errors.New("unknown trace exporter, expected otlp, stdout or none")
+	InvalidSamplingRatioErr = errors.New("trace sampling ratio must be between 0 and 1")
+)
+
+// Config - Where spans are exported to, and how many traces are kept
+type Config struct {
+	// Exporter - otlp to send spans to a collector, stdout to print them, none (or empty) to turn tracing off
+	Exporter string
+	// Endpoint - host:port of the collector's OTLP/HTTP receiver, localhost:4318 when empty
+	Endpoint string
+	// Insecure - Talk to the collector over plain HTTP
+	Insecure bool
+	// SamplingRatio - Share of the traces started by this service which are sampled. Traces of callers follow the
+	// decision they made.
+	SamplingRatio float64
+}
+
+func (c Config) Validate() error {
+	switch c.Exporter {
+	case ExporterOTLP, ExporterStdout, ExporterNone, "":
+	default:
+		return UnknownExporterErr
+	}
+	if c.SamplingRatio < 0 || c.SamplingRatio > 1 {
+		return InvalidSamplingRatioErr
+	}
+	return nil
+}
+
+// Setup - Installs the tracer provider and the W3C trace context propagator used by everything instrumented in the
+// service. Returns what flushes the spans left and stops tracing, which does nothing when tracing is off.
+func Setup(svcInfo *models.ServiceInfo, cfg Config) (func(context.Context) error, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Exporter == ExporterNone || cfg.Exporter == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SamplingRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(svcInfo.Name),
+			semconv.ServiceVersionKey.String(svcInfo.Version),
+			semconv.DeploymentEnvironmentKey.String(svcInfo.Environment),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{},
+		propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+func newExporter(cfg Config) (sdktrace.SpanExporter, error) {
+	if cfg.Exporter == ExporterStdout {
+		return stdouttrace.New()
+	}
+
+	var opts []otlptracehttp.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(context.Background(), opts...)
+}
@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var svcInfo = &models.ServiceInfo{Name: "test-api-service", Version: "rams-fav", Environment: "test"}
+
+func TestConfigValidate(t *testing.T) {
+	type validateTestCase struct {
+		Description string
+		Config      Config
+		ExpectedErr error
+	}
+
+	var testCases = []validateTestCase{
+		{"off", Config{}, nil},
+		{"none", Config{Exporter: ExporterNone}, nil},
+		{"otlp", Config{Exporter: ExporterOTLP, Endpoint: "collector:4318", SamplingRatio: 0.25}, nil},
+		{"stdout", Config{Exporter: ExporterStdout, SamplingRatio: 1}, nil},
+		{"unknown exporter", Config{Exporter: "jaeger"}, UnknownExporterErr},
+		{"negative ratio", Config{Exporter: ExporterStdout, SamplingRatio: -0.1}, InvalidSamplingRatioErr},
+		{"ratio above 1", Config{Exporter: ExporterStdout, SamplingRatio: 1.5}, InvalidSamplingRatioErr},
+	}
+
+	for _, tc := range testCases {
+		assert.ErrorIs(t, tc.Config.Validate(), tc.ExpectedErr, tc.Description)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	stop, err := Setup(svcInfo, Config{Exporter: ExporterNone})
+	assert.Nil(t, err)
+	assert.Nil(t, stop(context.Background()))
+	_, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider)
+	assert.False(t, ok)
+
+	stop, err = Setup(svcInfo, Config{Exporter: ExporterOTLP, Endpoint: "localhost:4318", Insecure: true,
+		SamplingRatio: 1})
+	assert.Nil(t, err)
+	_, ok = otel.GetTracerProvider().(*sdktrace.TracerProvider)
+	assert.True(t, ok)
+	// Nothing was traced, so nothing is sent on the way out
+	assert.Nil(t, stop(context.Background()))
+
+	_, err = Setup(svcInfo, Config{Exporter: "jaeger"})
+	assert.ErrorIs(t, err, UnknownExporterErr)
+}
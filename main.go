@@ -1,19 +1,25 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/rameshsunkara/deferrun"
 	"github.com/rameshsunkara/go-rest-api-example/internal/server"
-	"github.com/rameshsunkara/go-rest-api-example/pkg/util"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/pkgerrors"
+	"gopkg.in/yaml.v3"
 
 	_ "github.com/rameshsunkara/go-rest-api-example/docs"
 	"github.com/rameshsunkara/go-rest-api-example/internal/config"
 	"github.com/rameshsunkara/go-rest-api-example/internal/db"
+	"github.com/rameshsunkara/go-rest-api-example/internal/metrics"
 	"github.com/rameshsunkara/go-rest-api-example/internal/models"
+	"github.com/rameshsunkara/go-rest-api-example/internal/tracing"
 	"github.com/rs/zerolog/log"
 )
 
@@ -34,10 +40,19 @@ var version string
 // @contact.email
 
 // @host      localhost:8080
-// @BasePath  /api/v1
+// @BasePath  /
 func main() {
 	upTime := time.Now()
-	t := deferrun.NewSignalHandler()
+	configFile := flag.String("config", "", "configuration file, config/<environment>.yaml when there is one by default")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// A second signal stops the service at once
+		<-ctx.Done()
+		stop()
+	}()
 
 	env := os.Getenv("environment")
 	if env == "" {
@@ -52,41 +67,95 @@ func main() {
 		Version:     version,
 	}
 
+	// Load Configuration
+	cfg, cErr := config.Load(env, *configFile)
+	if flag.Arg(0) == "config" && flag.Arg(1) == "print" {
+		os.Exit(printConfig(cfg, cErr))
+	}
+	if cErr != nil {
+		log.Fatal().Err(cErr).Msg("unable to load configuration")
+	}
+
 	// Setup : Log
-	setupLog(env)
+	setupLog(cfg.Logging)
 
 	log.Info().Object("Service", serviceInfo).Msg("starting")
+	metrics.SetBuildInfo(serviceInfo)
+
+	// Setup : Config reload, on SIGHUP or when the file changes
+	live := config.NewLive(cfg)
+	reloader := config.NewReloader(env, live)
+	reloader.OnReload(func(cfg *config.Config) {
+		lvl, _ := zerolog.ParseLevel(cfg.Logging.Level)
+		zerolog.SetGlobalLevel(lvl)
+	})
+	if err := reloader.Watch(ctx); err != nil {
+		log.Warn().Err(err).Str("file", cfg.File).Msg("unable to watch configuration file, only SIGHUP reloads it")
+	}
 
-	// Load Configuration
-	c, cErr := config.LoadConfig(env)
-	if cErr != nil {
-		log.Fatal().Err(cErr).Msg("unable to read configuration")
+	// Setup : Tracing, before anything traced starts
+	stopTracing, tErr := tracing.Setup(serviceInfo, cfg.Tracing.Config())
+	if tErr != nil {
+		log.Fatal().Err(tErr).Msg("unable to set up tracing")
 	}
 
 	// Setup : DB
-	dbManager, dErr := db.NewMongoManager(DBName, c.GetString("db.dsn"))
+	dsn, dsnErr := cfg.DB.ResolveDSN()
+	if dsnErr != nil {
+		log.Fatal().Err(dsnErr).Msg("unable to read DB connection string")
+	}
+	dbManager, dErr := db.NewMongoManager(DBName, dsn)
 	if dErr != nil {
 		log.Fatal().Err(dErr).Msg("unable to initialize DB connection")
 	}
-	t.OnSignal(func() {
-		dbManager.Disconnect()
-	})
+	if cfg.DB.FromFiles() && cfg.DB.RefreshInterval > 0 {
+		// Rotated credentials are picked up without a restart
+		go db.RefreshConnUrl(ctx, dbManager, cfg.DB.RefreshInterval, cfg.DB.ResolveDSN)
+	}
 
-	// Setup : Server
-	server.Init(serviceInfo, dbManager)
+	// Setup : Server, until a signal asks it to stop. It disconnects from the DB once done with it.
+	sErr := server.Init(ctx, serviceInfo, live, dbManager)
+
+	if err := stopTracing(context.Background()); err != nil {
+		log.Error().Err(err).Msg("unable to flush traces")
+	}
+	if sErr != nil {
+		log.Fatal().Err(sErr).Str("ServiceName", ServiceName).Msg("Server Exited")
+	}
+	log.Info().Str("ServiceName", ServiceName).Msg("Server Exited")
+}
 
-	log.Fatal().Str("ServiceName", ServiceName).Msg("Server Exited")
+// printConfig - Shows the effective configuration, secrets redacted, along with what is wrong with it. Returns the exit
+// code.
+func printConfig(cfg *config.Config, err error) int {
+	if cfg == nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	out, mErr := yaml.Marshal(cfg.Redacted())
+	if mErr != nil {
+		fmt.Fprintln(os.Stderr, mErr)
+		return 1
+	}
+	fmt.Print(string(out))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
 }
 
-func setupLog(env string) {
+func setupLog(cfg config.Logging) {
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
-	lvl := zerolog.InfoLevel
+	// Validated along with the configuration
+	lvl, _ := zerolog.ParseLevel(cfg.Level)
 	logDest := os.Stdout
 	logger := zerolog.New(logDest).With().Caller().Timestamp().Logger()
-	if util.IsDevMode(env) {
-		lvl = zerolog.TraceLevel
+	if cfg.Format == config.LogFormatConsole {
 		logger = zerolog.New(zerolog.ConsoleWriter{Out: logDest}).With().Caller().Timestamp().Logger()
 	}
 	zerolog.SetGlobalLevel(lvl)
 	log.Logger = logger
+	// Request scoped loggers derive from this one
+	zerolog.DefaultContextLogger = &log.Logger
 }
@@ -1,10 +1,14 @@
 package util
 
 import (
+	"net/url"
 	"strings"
 	"time"
 )
 
+// Redacted - What secrets are replaced with wherever they would show
+const Redacted = "xxxxx"
+
 func FormatTimeToISO(timeToFormat time.Time) string {
 	return timeToFormat.Format(time.RFC3339)
 }
@@ -17,3 +21,15 @@ func CurrentISOTime() string {
 func IsDevMode(s string) bool {
 	return strings.Contains(s, "dev")
 }
+
+// RedactURL - raw with its password masked, all of it when it can't be parsed, as parse errors would show it
+func RedactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Redacted
+	}
+	return u.Redacted()
+}